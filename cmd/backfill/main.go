@@ -0,0 +1,112 @@
+// Command backfill uploads the objects of a bucket prefix that never produced a job,
+// e.g. because the uploader function was down or misconfigured when they were exported.
+// It is configured like the uploader, with uploader.env.yml.
+//
+//	go run ./cmd/backfill -bucket tableland-basin-staging -prefix feeds/ -dry-run
+//
+// The name of the last handled object is written to the state file, an interrupted
+// backfill resumes after it when it is run again with the same state file.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/tablelandnetwork/basin-storage/pkg/storage"
+)
+
+func main() {
+	envFile := flag.String("env-file", "uploader.env.yml", "uploader config, set variables take precedence")
+	bucket := flag.String("bucket", "", "bucket to backfill")
+	prefix := flag.String("prefix", "", "prefix of the objects to backfill")
+	startAfter := flag.String("start-after", "", "object name to start after, overrides the state file")
+	state := flag.String("state", "backfill.state", "file the progress is saved to, empty to disable")
+	concurrency := flag.Int("concurrency", 4, "number of objects checked and uploaded at once")
+	dryRun := flag.Bool("dry-run", false, "only report the objects without a job")
+	flag.Parse()
+
+	if *bucket == "" {
+		log.Fatalf("error: missing bucket")
+	}
+	if err := loadEnv(*envFile); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	opts := storage.BackfillOptions{
+		Bucket:      *bucket,
+		Prefix:      *prefix,
+		StartAfter:  *startAfter,
+		Concurrency: *concurrency,
+		DryRun:      *dryRun,
+	}
+	if *state != "" {
+		if opts.StartAfter == "" {
+			data, err := os.ReadFile(*state)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Fatalf("error: %v", err)
+			}
+			opts.StartAfter = strings.TrimSpace(string(data))
+		}
+		// a dry run does not handle the objects, it must not move the progress
+		if !*dryRun {
+			opts.Checkpoint = func(name string) error {
+				return os.WriteFile(*state, []byte(name+"\n"), 0o600)
+			}
+		}
+	}
+	if opts.StartAfter != "" {
+		fmt.Println("resuming after", opts.StartAfter)
+	}
+
+	ctx := context.Background()
+	u, err := storage.NewFileUploader(ctx, nil, storage.UploaderConfigFromEnv())
+	if err != nil {
+		log.Fatalf("failed to initialize file uploader: %v", err)
+	}
+
+	report, err := u.Backfill(ctx, opts)
+	if report != nil {
+		for _, name := range report.Missing {
+			fmt.Println("missing:", name)
+		}
+		fmt.Printf("listed %d, archived %d, rejected %d, missing %d, uploaded %d, failed %d\n",
+			report.Listed, report.Archived, report.Rejected, len(report.Missing), report.Uploaded, report.Failed)
+	}
+	if err != nil {
+		log.Fatalf("failed to backfill: %v", err)
+	}
+}
+
+// loadEnv sets the variables of the env file that are not set already.
+func loadEnv(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	vars := map[string]string{}
+	if err := yaml.Unmarshal(data, &vars); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for k, v := range vars {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
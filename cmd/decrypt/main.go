@@ -0,0 +1,53 @@
+// Command decrypt decrypts a file that the uploader encrypted before archiving it,
+// e.g. a file retrieved from IPFS or Filecoin, with the key of its namespace.
+//
+//	go run ./cmd/decrypt -key <hex key> < export.parquet.enc > export.parquet
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tablelandnetwork/basin-storage/pkg/storage"
+)
+
+func main() {
+	keyHex := flag.String("key", os.Getenv("ENCRYPTION_KEY"), "hex encoded key of the namespace")
+	in := flag.String("in", "", "encrypted file, defaults to stdin")
+	out := flag.String("out", "", "decrypted file, defaults to stdout")
+	flag.Parse()
+
+	key, err := hex.DecodeString(strings.TrimPrefix(*keyHex, "0x"))
+	if err != nil {
+		log.Fatalf("failed to decode key: %v", err)
+	}
+
+	src := os.Stdin
+	if *in != "" {
+		if src, err = os.Open(*in); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	dst := os.Stdout
+	if *out != "" {
+		if dst, err = os.Create(*out); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	w := bufio.NewWriter(dst)
+	if err := storage.Decrypt(w, bufio.NewReader(src), key); err != nil {
+		log.Fatalf("failed to decrypt: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
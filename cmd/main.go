@@ -8,18 +8,85 @@ import (
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	_ "github.com/tablelandnetwork/basin-storage"
 	"gopkg.in/yaml.v2"
+
+	"github.com/tablelandnetwork/basin-storage/pkg/storage"
 )
 
+type dealProviderVars struct {
+	DealProvider string `yaml:"DEAL_PROVIDER"`
+	W3SToken     string `yaml:"WEB3STORAGE_TOKEN"`
+	HTTPEndpoint string `yaml:"DEAL_HTTP_ENDPOINT"`
+	HTTPToken    string `yaml:"DEAL_HTTP_TOKEN"`
+	LocalDealDir string `yaml:"LOCAL_DEAL_DIR"`
+}
+
+type objectStoreVars struct {
+	ObjectStore   string `yaml:"OBJECT_STORE"`
+	S3Endpoint    string `yaml:"S3_ENDPOINT"`
+	S3AccessKey   string `yaml:"S3_ACCESS_KEY"`
+	S3SecretKey   string `yaml:"S3_SECRET_KEY"`
+	S3Region      string `yaml:"S3_REGION"`
+	S3Insecure    string `yaml:"S3_INSECURE"`
+	LocalStoreDir string `yaml:"LOCAL_STORE_DIR"`
+}
+
 type uploaderVars struct {
-	W3SToken string `yaml:"WEB3STORAGE_TOKEN"`
-	CrdbConn string `yaml:"CRDB_CONN_STRING"`
+	objectStoreVars  `yaml:",inline"`
+	dealProviderVars `yaml:",inline"`
+	CrdbConn         string `yaml:"CRDB_CONN_STRING"`
+	HashAlgorithm    string `yaml:"HASH_ALGORITHM"`
+	SignatureMode    string `yaml:"SIGNATURE_MODE"`
+	ShardSize        string `yaml:"SHARD_SIZE"`
+	MaxAttempts      string `yaml:"MAX_UPLOAD_ATTEMPTS"`
+	RetryBackoff     string `yaml:"RETRY_BACKOFF"`
+	EncryptionKeys   string `yaml:"ENCRYPTION_KEYS"`
+	AggregateSize    string `yaml:"AGGREGATE_SIZE"`
+	AggregateTarget  string `yaml:"AGGREGATE_TARGET"`
+	AggregateWindow  string `yaml:"AGGREGATE_WINDOW"`
+	AutoProvision    string `yaml:"AUTO_PROVISION"`
 }
 
 type statusCheckerVars struct {
-	W3SToken   string `yaml:"WEB3STORAGE_TOKEN"`
-	CrdbConn   string `yaml:"CRDB_CONN_STRING"`
-	PrivateKey string `yaml:"PRIVATE_KEY"`
-	ChainID    string `yaml:"CHAIN_ID"`
+	dealProviderVars `yaml:",inline"`
+	CrdbConn         string `yaml:"CRDB_CONN_STRING"`
+	PrivateKey       string `yaml:"PRIVATE_KEY"`
+	ChainID          string `yaml:"CHAIN_ID"`
+	LeaseDuration    string `yaml:"LEASE_DURATION"`
+	ClaimBatchSize   string `yaml:"CLAIM_BATCH_SIZE"`
+}
+
+type evictorVars struct {
+	objectStoreVars `yaml:",inline"`
+	CrdbConn        string `yaml:"CRDB_CONN_STRING"`
+	DefaultBucket   string `yaml:"DEFAULT_BUCKET"`
+	DryRun          string `yaml:"EVICTOR_DRY_RUN"`
+}
+
+func setDealProviderEnv(setenv func(key, value string), vars dealProviderVars) {
+	setenv("DEAL_PROVIDER", vars.DealProvider)
+	setenv("WEB3STORAGE_TOKEN", vars.W3SToken)
+	setenv("DEAL_HTTP_ENDPOINT", vars.HTTPEndpoint)
+	setenv("DEAL_HTTP_TOKEN", vars.HTTPToken)
+	setenv("LOCAL_DEAL_DIR", vars.LocalDealDir)
+}
+
+func setObjectStoreEnv(setenv func(key, value string), vars objectStoreVars) {
+	setenv("OBJECT_STORE", vars.ObjectStore)
+	setenv("S3_ENDPOINT", vars.S3Endpoint)
+	setenv("S3_ACCESS_KEY", vars.S3AccessKey)
+	setenv("S3_SECRET_KEY", vars.S3SecretKey)
+	setenv("S3_REGION", vars.S3Region)
+	setenv("S3_INSECURE", vars.S3Insecure)
+	setenv("LOCAL_STORE_DIR", vars.LocalStoreDir)
+}
+
+// envSetter returns a function that sets environment variables with the prefix.
+func envSetter(prefix string) func(key, value string) {
+	return func(key, value string) {
+		if err := os.Setenv(prefix+key, value); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
 }
 
 func main() {
@@ -31,7 +98,21 @@ func main() {
 
 	targetFn := os.Getenv("FUNCTION_TARGET")
 
-	if targetFn == "Uploader" {
+	// Without a target, all the functions are served by this process, e.g. for local
+	// development where the uploader and the checker share an in-memory database.
+	// The functions share the environment of the process, so each one reads its variables with
+	// its prefix, otherwise the checker or evictor config would override the uploader config.
+	devMode := targetFn == ""
+	envPrefix := func(prefix string) string {
+		if devMode {
+			return prefix
+		}
+		return ""
+	}
+
+	// The retrier uploads again the failed uploads, and the aggregator archives
+	// the pending small objects, they share the uploader config.
+	if devMode || targetFn == "Uploader" || targetFn == "Retrier" || targetFn == "Aggregator" {
 		data, err := os.ReadFile("uploader.env.yml")
 		if err != nil {
 			log.Fatalf("error: %v", err)
@@ -40,15 +121,23 @@ func main() {
 		if err = yaml.Unmarshal(data, &vars); err != nil {
 			log.Fatalf("error: %v", err)
 		}
-		if err = os.Setenv("WEB3STORAGE_TOKEN", vars.W3SToken); err != nil {
-			log.Fatalf("error: %v", err)
-		}
-		if err = os.Setenv("CRDB_CONN_STRING", vars.CrdbConn); err != nil {
-			log.Fatalf("error: %v", err)
-		}
+		setenv := envSetter(envPrefix(storage.UploaderEnvPrefix))
+		setObjectStoreEnv(setenv, vars.objectStoreVars)
+		setDealProviderEnv(setenv, vars.dealProviderVars)
+		setenv("CRDB_CONN_STRING", vars.CrdbConn)
+		setenv("HASH_ALGORITHM", vars.HashAlgorithm)
+		setenv("SIGNATURE_MODE", vars.SignatureMode)
+		setenv("SHARD_SIZE", vars.ShardSize)
+		setenv("MAX_UPLOAD_ATTEMPTS", vars.MaxAttempts)
+		setenv("RETRY_BACKOFF", vars.RetryBackoff)
+		setenv("ENCRYPTION_KEYS", vars.EncryptionKeys)
+		setenv("AGGREGATE_SIZE", vars.AggregateSize)
+		setenv("AGGREGATE_TARGET", vars.AggregateTarget)
+		setenv("AGGREGATE_WINDOW", vars.AggregateWindow)
+		setenv("AUTO_PROVISION", vars.AutoProvision)
 	}
 
-	if targetFn == "StatusChecker" {
+	if devMode || targetFn == "StatusChecker" {
 		data, err := os.ReadFile("checker.env.yml")
 		if err != nil {
 			log.Fatalf("error: %v", err)
@@ -57,18 +146,29 @@ func main() {
 		if err = yaml.Unmarshal(data, &vars); err != nil {
 			log.Fatalf("error: %v", err)
 		}
-		if err = os.Setenv("WEB3STORAGE_TOKEN", vars.W3SToken); err != nil {
-			log.Fatalf("error: %v", err)
-		}
-		if err = os.Setenv("CRDB_CONN_STRING", vars.CrdbConn); err != nil {
-			log.Fatalf("error: %v", err)
-		}
-		if err = os.Setenv("PRIVATE_KEY", vars.PrivateKey); err != nil {
+		setenv := envSetter(envPrefix(storage.StatusCheckerEnvPrefix))
+		setDealProviderEnv(setenv, vars.dealProviderVars)
+		setenv("CRDB_CONN_STRING", vars.CrdbConn)
+		setenv("PRIVATE_KEY", vars.PrivateKey)
+		setenv("CHAIN_ID", vars.ChainID)
+		setenv("LEASE_DURATION", vars.LeaseDuration)
+		setenv("CLAIM_BATCH_SIZE", vars.ClaimBatchSize)
+	}
+
+	if devMode || targetFn == "Evictor" {
+		data, err := os.ReadFile("evictor.env.yml")
+		if err != nil {
 			log.Fatalf("error: %v", err)
 		}
-		if err = os.Setenv("CHAIN_ID", vars.ChainID); err != nil {
+		vars := evictorVars{}
+		if err = yaml.Unmarshal(data, &vars); err != nil {
 			log.Fatalf("error: %v", err)
 		}
+		setenv := envSetter(envPrefix(storage.EvictorEnvPrefix))
+		setObjectStoreEnv(setenv, vars.objectStoreVars)
+		setenv("CRDB_CONN_STRING", vars.CrdbConn)
+		setenv("DEFAULT_BUCKET", vars.DefaultBucket)
+		setenv("EVICTOR_DRY_RUN", vars.DryRun)
 	}
 
 	if err := funcframework.Start(port); err != nil {
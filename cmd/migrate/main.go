@@ -0,0 +1,80 @@
+// Command migrate applies, reverts and lists the embedded migrations of the database schema.
+// The uploader, the checker and the evictor refuse to start until the schema is up to date.
+//
+//	go run ./cmd/migrate -conn <conn string> up
+//	go run ./cmd/migrate -conn <conn string> -steps 1 down
+//	go run ./cmd/migrate -conn <conn string> status
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	"github.com/tablelandnetwork/basin-storage/pkg/storage"
+)
+
+func main() {
+	conn := flag.String("conn", os.Getenv("CRDB_CONN_STRING"), "connection string of the database")
+	steps := flag.Int("steps", 1, "number of migrations reverted by down")
+	flag.Parse()
+
+	if *conn == "" {
+		log.Fatalf("error: missing connection string")
+	}
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: migrate [flags] up|down|status")
+	}
+
+	db, err := sql.Open("postgres", *conn)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	m, err := storage.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	ctx := context.Background()
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate: %v", err)
+		}
+	case "down":
+		reverted, err := m.Down(ctx, *steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("failed to migrate: %v", err)
+		}
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Fatalf("failed to read status: %v", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		log.Fatalf("unknown command: %s", cmd)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
@@ -17,34 +16,33 @@ func init() {
 	// Register a CloudEvent function with the Functions Framework
 	functions.CloudEvent("Uploader", Uploader)
 	functions.HTTP("StatusChecker", StatusChecker)
+	functions.HTTP("Retrier", Retrier)
+	functions.HTTP("Evictor", Evictor)
+	functions.HTTP("Aggregator", Aggregator)
 }
 
 // Uploader is the CloudEvent function that is called by the Functions Framework.
-// It is triggered by a CloudEvent that is published by the GCS bucket.
+// It is triggered by a CloudEvent that is published by the object store, e.g. a GCS bucket.
 // The CloudEvent contains the name of the bucket and the name of the file.
-// The file is downloaded from GCS and uploaded to web3.storage.
+// On finalized and metadataUpdated events, the file is downloaded from the object store
+// and uploaded to the configured deal provider. On deleted and archived events, its jobs
+// are marked as source deleted. Other events are acknowledged without doing anything.
 func Uploader(ctx context.Context, e event.Event) error {
 	// Set a timeout of 60 minutes, thats the max time a function can run on GCP (gen2)
 	// we want to ensure larger files can be uploaded
 	cctx, cancel := context.WithTimeout(ctx, 60*time.Minute)
 	defer cancel()
 
-	// Read config from environment variables
-	cfg := &storage.UploaderConfig{
-		W3SToken: os.Getenv("WEB3STORAGE_TOKEN"),
-		CrdbConn: os.Getenv("CRDB_CONN_STRING"),
-	}
-
 	// Initialize file uploader
-	u, err := storage.NewFileUploader(cctx, e.Data(), cfg)
+	u, err := storage.NewFileUploader(cctx, e.Data(), storage.UploaderConfigFromEnv())
 	if err != nil {
 		return fmt.Errorf("failed to initialize file uploader: %v", err)
 	}
 
-	// Upload file (from event) to web3.storage
-	err = u.Upload(cctx)
+	// Upload file (from event) to the deal provider, or record its removal
+	err = u.HandleEvent(cctx, e.Type())
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %v", err)
+		return fmt.Errorf("failed to handle %s event: %v", e.Type(), err)
 	}
 
 	return nil
@@ -53,13 +51,16 @@ func Uploader(ctx context.Context, e event.Event) error {
 // StatusChecker is the HTTP function that is called by the Functions Framework.
 func StatusChecker(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	getenv := storage.EnvWithPrefix(storage.StatusCheckerEnvPrefix)
 	cfg := &storage.StatusCheckerConfig{
-		W3SToken:         os.Getenv("WEB3STORAGE_TOKEN"),
-		CrdbConn:         os.Getenv("CRDB_CONN_STRING"),
-		PrivateKey:       os.Getenv("PRIVATE_KEY"),
-		ChainID:          os.Getenv("CHAIN_ID"),
-		BackendURL:       "https://api.calibration.node.glif.io/rpc/v1", // TODO: move to config
-		BasinStorageAddr: "0xaB16d51Fa80EaeAF9668CE102a783237A045FC37",  // TODO: move to config
+		DealProviderConfig: storage.DealProviderConfigFromEnv(getenv),
+		CrdbConn:           getenv("CRDB_CONN_STRING"),
+		PrivateKey:         getenv("PRIVATE_KEY"),
+		ChainID:            getenv("CHAIN_ID"),
+		LeaseDuration:      getenv("LEASE_DURATION"),
+		ClaimBatchSize:     getenv("CLAIM_BATCH_SIZE"),
+		BackendURL:         "https://api.calibration.node.glif.io/rpc/v1", // TODO: move to config
+		BasinStorageAddr:   "0xaB16d51Fa80EaeAF9668CE102a783237A045FC37",  // TODO: move to config
 	}
 
 	if err := r.ParseForm(); err != nil {
@@ -86,3 +87,81 @@ func StatusChecker(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Fprintln(w, "OK")
 }
+
+// Retrier is the HTTP function that is called by the Functions Framework.
+// It uploads again the failed uploads whose backoff has elapsed.
+func Retrier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// There is no event to parse, the objects are read from the failed uploads.
+	u, err := storage.NewFileUploader(ctx, nil, storage.UploaderConfigFromEnv())
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to initialize file uploader: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	if err = u.RetryFailedUploads(ctx); err != nil {
+		errMsg := fmt.Sprintf("failed to retry failed uploads: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+// Aggregator is the HTTP function that is called by the Functions Framework.
+// It archives the pending small objects in aggregates.
+func Aggregator(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// There is no event to parse, the objects are read from the pending aggregates.
+	u, err := storage.NewFileUploader(ctx, nil, storage.UploaderConfigFromEnv())
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to initialize file uploader: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	if err = u.Aggregate(ctx); err != nil {
+		errMsg := fmt.Sprintf("failed to aggregate pending objects: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
+
+// Evictor is the HTTP function that is called by the Functions Framework.
+// It deletes the cached objects of the jobs whose cache expired.
+func Evictor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	getenv := storage.EnvWithPrefix(storage.EvictorEnvPrefix)
+	cfg := &storage.EvictorConfig{
+		ObjectStoreConfig: storage.ObjectStoreConfigFromEnv(getenv),
+		CrdbConn:          getenv("CRDB_CONN_STRING"),
+		DefaultBucket:     getenv("DEFAULT_BUCKET"),
+		DryRun:            getenv("EVICTOR_DRY_RUN") == "true",
+	}
+
+	e, err := storage.NewCacheEvictor(ctx, cfg)
+	if err != nil {
+		errMsg := fmt.Sprintf("failed to initialize cache evictor: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	if err = e.EvictExpired(ctx); err != nil {
+		errMsg := fmt.Sprintf("failed to evict expired jobs: %v", err)
+		fmt.Println(errMsg)
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "OK")
+}
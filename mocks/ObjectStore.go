@@ -0,0 +1,516 @@
+// Code generated by mockery v2.36.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+	io "io"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// ObjectStore is an autogenerated mock type for the ObjectStore type
+type ObjectStore struct {
+	mock.Mock
+}
+
+type ObjectStore_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *ObjectStore) EXPECT() *ObjectStore_Expecter {
+	return &ObjectStore_Expecter{mock: &_m.Mock}
+}
+
+// DeleteObject provides a mock function with given fields: ctx, bName, oName, generation
+func (_m *ObjectStore) DeleteObject(ctx context.Context, bName string, oName string, generation int64) error {
+	ret := _m.Called(ctx, bName, oName, generation)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) error); ok {
+		r0 = rf(ctx, bName, oName, generation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ObjectStore_DeleteObject_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteObject'
+type ObjectStore_DeleteObject_Call struct {
+	*mock.Call
+}
+
+// DeleteObject is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+//   - generation int64
+func (_e *ObjectStore_Expecter) DeleteObject(ctx interface{}, bName interface{}, oName interface{}, generation interface{}) *ObjectStore_DeleteObject_Call {
+	return &ObjectStore_DeleteObject_Call{Call: _e.mock.On("DeleteObject", ctx, bName, oName, generation)}
+}
+
+func (_c *ObjectStore_DeleteObject_Call) Run(run func(ctx context.Context, bName string, oName string, generation int64)) *ObjectStore_DeleteObject_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int64))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_DeleteObject_Call) Return(_a0 error) *ObjectStore_DeleteObject_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *ObjectStore_DeleteObject_Call) RunAndReturn(run func(context.Context, string, string, int64) error) *ObjectStore_DeleteObject_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetObjectGeneration provides a mock function with given fields: ctx, bName, oName
+func (_m *ObjectStore) GetObjectGeneration(ctx context.Context, bName string, oName string) (int64, error) {
+	ret := _m.Called(ctx, bName, oName)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (int64, error)); ok {
+		return rf(ctx, bName, oName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) int64); ok {
+		r0 = rf(ctx, bName, oName)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, bName, oName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_GetObjectGeneration_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectGeneration'
+type ObjectStore_GetObjectGeneration_Call struct {
+	*mock.Call
+}
+
+// GetObjectGeneration is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+func (_e *ObjectStore_Expecter) GetObjectGeneration(ctx interface{}, bName interface{}, oName interface{}) *ObjectStore_GetObjectGeneration_Call {
+	return &ObjectStore_GetObjectGeneration_Call{Call: _e.mock.On("GetObjectGeneration", ctx, bName, oName)}
+}
+
+func (_c *ObjectStore_GetObjectGeneration_Call) Run(run func(ctx context.Context, bName string, oName string)) *ObjectStore_GetObjectGeneration_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectGeneration_Call) Return(_a0 int64, _a1 error) *ObjectStore_GetObjectGeneration_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectGeneration_Call) RunAndReturn(run func(context.Context, string, string) (int64, error)) *ObjectStore_GetObjectGeneration_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetObjectMetadata provides a mock function with given fields: ctx, bName, oName
+func (_m *ObjectStore) GetObjectMetadata(ctx context.Context, bName string, oName string) (map[string]string, error) {
+	ret := _m.Called(ctx, bName, oName)
+
+	var r0 map[string]string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (map[string]string, error)); ok {
+		return rf(ctx, bName, oName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) map[string]string); ok {
+		r0 = rf(ctx, bName, oName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, bName, oName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_GetObjectMetadata_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectMetadata'
+type ObjectStore_GetObjectMetadata_Call struct {
+	*mock.Call
+}
+
+// GetObjectMetadata is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+func (_e *ObjectStore_Expecter) GetObjectMetadata(ctx interface{}, bName interface{}, oName interface{}) *ObjectStore_GetObjectMetadata_Call {
+	return &ObjectStore_GetObjectMetadata_Call{Call: _e.mock.On("GetObjectMetadata", ctx, bName, oName)}
+}
+
+func (_c *ObjectStore_GetObjectMetadata_Call) Run(run func(ctx context.Context, bName string, oName string)) *ObjectStore_GetObjectMetadata_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectMetadata_Call) Return(_a0 map[string]string, _a1 error) *ObjectStore_GetObjectMetadata_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectMetadata_Call) RunAndReturn(run func(context.Context, string, string) (map[string]string, error)) *ObjectStore_GetObjectMetadata_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetObjectRangeReader provides a mock function with given fields: ctx, bName, oName, offset, length
+func (_m *ObjectStore) GetObjectRangeReader(ctx context.Context, bName string, oName string, offset int64, length int64) (io.ReadCloser, error) {
+	ret := _m.Called(ctx, bName, oName, offset, length)
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, int64) (io.ReadCloser, error)); ok {
+		return rf(ctx, bName, oName, offset, length)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64, int64) io.ReadCloser); ok {
+		r0 = rf(ctx, bName, oName, offset, length)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64, int64) error); ok {
+		r1 = rf(ctx, bName, oName, offset, length)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_GetObjectRangeReader_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectRangeReader'
+type ObjectStore_GetObjectRangeReader_Call struct {
+	*mock.Call
+}
+
+// GetObjectRangeReader is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+//   - offset int64
+//   - length int64
+func (_e *ObjectStore_Expecter) GetObjectRangeReader(ctx interface{}, bName interface{}, oName interface{}, offset interface{}, length interface{}) *ObjectStore_GetObjectRangeReader_Call {
+	return &ObjectStore_GetObjectRangeReader_Call{Call: _e.mock.On("GetObjectRangeReader", ctx, bName, oName, offset, length)}
+}
+
+func (_c *ObjectStore_GetObjectRangeReader_Call) Run(run func(ctx context.Context, bName string, oName string, offset int64, length int64)) *ObjectStore_GetObjectRangeReader_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(int64), args[4].(int64))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectRangeReader_Call) Return(_a0 io.ReadCloser, _a1 error) *ObjectStore_GetObjectRangeReader_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectRangeReader_Call) RunAndReturn(run func(context.Context, string, string, int64, int64) (io.ReadCloser, error)) *ObjectStore_GetObjectRangeReader_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetObjectReader provides a mock function with given fields: ctx, bName, oName
+func (_m *ObjectStore) GetObjectReader(ctx context.Context, bName string, oName string) (io.ReadCloser, error) {
+	ret := _m.Called(ctx, bName, oName)
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (io.ReadCloser, error)); ok {
+		return rf(ctx, bName, oName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) io.ReadCloser); ok {
+		r0 = rf(ctx, bName, oName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, bName, oName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_GetObjectReader_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectReader'
+type ObjectStore_GetObjectReader_Call struct {
+	*mock.Call
+}
+
+// GetObjectReader is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+func (_e *ObjectStore_Expecter) GetObjectReader(ctx interface{}, bName interface{}, oName interface{}) *ObjectStore_GetObjectReader_Call {
+	return &ObjectStore_GetObjectReader_Call{Call: _e.mock.On("GetObjectReader", ctx, bName, oName)}
+}
+
+func (_c *ObjectStore_GetObjectReader_Call) Run(run func(ctx context.Context, bName string, oName string)) *ObjectStore_GetObjectReader_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectReader_Call) Return(_a0 io.ReadCloser, _a1 error) *ObjectStore_GetObjectReader_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectReader_Call) RunAndReturn(run func(context.Context, string, string) (io.ReadCloser, error)) *ObjectStore_GetObjectReader_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetObjectSize provides a mock function with given fields: ctx, bName, oName
+func (_m *ObjectStore) GetObjectSize(ctx context.Context, bName string, oName string) (int64, error) {
+	ret := _m.Called(ctx, bName, oName)
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (int64, error)); ok {
+		return rf(ctx, bName, oName)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) int64); ok {
+		r0 = rf(ctx, bName, oName)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, bName, oName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_GetObjectSize_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectSize'
+type ObjectStore_GetObjectSize_Call struct {
+	*mock.Call
+}
+
+// GetObjectSize is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - oName string
+func (_e *ObjectStore_Expecter) GetObjectSize(ctx interface{}, bName interface{}, oName interface{}) *ObjectStore_GetObjectSize_Call {
+	return &ObjectStore_GetObjectSize_Call{Call: _e.mock.On("GetObjectSize", ctx, bName, oName)}
+}
+
+func (_c *ObjectStore_GetObjectSize_Call) Run(run func(ctx context.Context, bName string, oName string)) *ObjectStore_GetObjectSize_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectSize_Call) Return(_a0 int64, _a1 error) *ObjectStore_GetObjectSize_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_GetObjectSize_Call) RunAndReturn(run func(context.Context, string, string) (int64, error)) *ObjectStore_GetObjectSize_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ListObjects provides a mock function with given fields: ctx, bName, prefix, startAfter, limit, fn
+func (_m *ObjectStore) ListObjects(ctx context.Context, bName string, prefix string, startAfter string, limit int, fn func(string, int64) error) error {
+	ret := _m.Called(ctx, bName, prefix, startAfter, limit, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, int, func(string, int64) error) error); ok {
+		r0 = rf(ctx, bName, prefix, startAfter, limit, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ObjectStore_ListObjects_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListObjects'
+type ObjectStore_ListObjects_Call struct {
+	*mock.Call
+}
+
+// ListObjects is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bName string
+//   - prefix string
+//   - startAfter string
+//   - limit int
+//   - fn func(string , int64) error
+func (_e *ObjectStore_Expecter) ListObjects(ctx interface{}, bName interface{}, prefix interface{}, startAfter interface{}, limit interface{}, fn interface{}) *ObjectStore_ListObjects_Call {
+	return &ObjectStore_ListObjects_Call{Call: _e.mock.On("ListObjects", ctx, bName, prefix, startAfter, limit, fn)}
+}
+
+func (_c *ObjectStore_ListObjects_Call) Run(run func(ctx context.Context, bName string, prefix string, startAfter string, limit int, fn func(string, int64) error)) *ObjectStore_ListObjects_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(string), args[4].(int), args[5].(func(string, int64) error))
+	})
+	return _c
+}
+
+func (_c *ObjectStore_ListObjects_Call) Return(_a0 error) *ObjectStore_ListObjects_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *ObjectStore_ListObjects_Call) RunAndReturn(run func(context.Context, string, string, string, int, func(string, int64) error) error) *ObjectStore_ListObjects_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ParseEvent provides a mock function with given fields:
+func (_m *ObjectStore) ParseEvent() (string, string, error) {
+	ret := _m.Called()
+
+	var r0 string
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func() (string, string, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func() string); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func() error); ok {
+		r2 = rf()
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ObjectStore_ParseEvent_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ParseEvent'
+type ObjectStore_ParseEvent_Call struct {
+	*mock.Call
+}
+
+// ParseEvent is a helper method to define mock.On call
+func (_e *ObjectStore_Expecter) ParseEvent() *ObjectStore_ParseEvent_Call {
+	return &ObjectStore_ParseEvent_Call{Call: _e.mock.On("ParseEvent")}
+}
+
+func (_c *ObjectStore_ParseEvent_Call) Run(run func()) *ObjectStore_ParseEvent_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *ObjectStore_ParseEvent_Call) Return(_a0 string, _a1 string, _a2 error) *ObjectStore_ParseEvent_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *ObjectStore_ParseEvent_Call) RunAndReturn(run func() (string, string, error)) *ObjectStore_ParseEvent_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ParseEventGeneration provides a mock function with given fields:
+func (_m *ObjectStore) ParseEventGeneration() (int64, error) {
+	ret := _m.Called()
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (int64, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ObjectStore_ParseEventGeneration_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ParseEventGeneration'
+type ObjectStore_ParseEventGeneration_Call struct {
+	*mock.Call
+}
+
+// ParseEventGeneration is a helper method to define mock.On call
+func (_e *ObjectStore_Expecter) ParseEventGeneration() *ObjectStore_ParseEventGeneration_Call {
+	return &ObjectStore_ParseEventGeneration_Call{Call: _e.mock.On("ParseEventGeneration")}
+}
+
+func (_c *ObjectStore_ParseEventGeneration_Call) Run(run func()) *ObjectStore_ParseEventGeneration_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *ObjectStore_ParseEventGeneration_Call) Return(_a0 int64, _a1 error) *ObjectStore_ParseEventGeneration_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *ObjectStore_ParseEventGeneration_Call) RunAndReturn(run func() (int64, error)) *ObjectStore_ParseEventGeneration_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewObjectStore creates a new instance of ObjectStore. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewObjectStore(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ObjectStore {
+	mock := &ObjectStore{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -1,19 +1,27 @@
 package ethereum
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
-	"time"
 
 	eth "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/textileio/go-tableland/pkg/wallet"
 )
 
+// ErrPubAlreadyExists is returned when creating a pub reverts because the pub exists,
+// whichever its owner.
+var ErrPubAlreadyExists = errors.New("pub already exists")
+
 // BasinStorage is an interface that defines the methods to interact with the BasinStorage smart contract.
 type BasinStorage interface {
 	EstimateGas(ctx context.Context,
@@ -22,11 +30,26 @@ type BasinStorage interface {
 		timestamp int64,
 	) (*bind.TransactOpts, error)
 	GetPendingNonce(ctx context.Context) (uint64, error)
-	AddCID(ctx context.Context,
+	// SignAddCID builds and signs the tx that adds the cid to the contract, without sending it.
+	SignAddCID(ctx context.Context,
 		pub string,
 		cid string,
 		timestamp int64,
-		txOpts *bind.TransactOpts) error
+		txOpts *bind.TransactOpts) (*types.Transaction, error)
+	// SendTx sends a signed tx. Sending a tx that was sent already is harmless, it keeps its hash.
+	SendTx(ctx context.Context, tx *types.Transaction) error
+	// TxReceipt returns the receipt of a tx, or eth.NotFound while the tx is not mined.
+	TxReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	// PubExists tells whether the pub was created on the contract for the owner. The contract only
+	// lists the pubs of an owner, a pub of another owner is found by EstimateCreatePubGas.
+	PubExists(ctx context.Context, owner common.Address, pub string) (bool, error)
+	// EstimateCreatePubGas returns ErrPubAlreadyExists when the pub exists.
+	EstimateCreatePubGas(ctx context.Context, owner common.Address, pub string) (*bind.TransactOpts, error)
+	// SignCreatePub builds and signs the tx that creates the pub for the owner, without sending it.
+	SignCreatePub(ctx context.Context,
+		owner common.Address,
+		pub string,
+		txOpts *bind.TransactOpts) (*types.Transaction, error)
 }
 
 // Client is the Ethereum implementation of the registry client.
@@ -68,6 +91,24 @@ func (c *Client) EstimateGas(
 	cid string,
 	timestamp int64,
 ) (*bind.TransactOpts, error) {
+	return c.estimateGas(ctx, "addCID", pub, cid, big.NewInt(timestamp))
+}
+
+// EstimateCreatePubGas estimates the gas required to execute the CreatePub function of the BasinStorage smart contract.
+func (c *Client) EstimateCreatePubGas(
+	ctx context.Context,
+	owner common.Address,
+	pub string,
+) (*bind.TransactOpts, error) {
+	txOpts, err := c.estimateGas(ctx, "createPub", owner, pub)
+	if err != nil && revertedWith(err, "PubAlreadyExists") {
+		return nil, fmt.Errorf("%w: %s", ErrPubAlreadyExists, pub)
+	}
+	return txOpts, err
+}
+
+// estimateGas returns the tx opts of a call to the method of the BasinStorage smart contract with args.
+func (c *Client) estimateGas(ctx context.Context, method string, args ...interface{}) (*bind.TransactOpts, error) {
 	txOpts, err := bind.NewKeyedTransactorWithChainID(
 		c.wallet.PrivateKey(),
 		big.NewInt(int64(c.chainID)),
@@ -86,8 +127,7 @@ func (c *Client) EstimateGas(
 		return nil, fmt.Errorf("failed to parse ABI: %v", err)
 	}
 
-	data, err := BasinStorageABI.Pack(
-		"addCID", []interface{}{pub, cid, big.NewInt(timestamp)}...)
+	data, err := BasinStorageABI.Pack(method, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to abi pack: %v", err)
 	}
@@ -98,7 +138,7 @@ func (c *Client) EstimateGas(
 		Data: data,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error while calling EstimateGas rpc: %v", err)
+		return nil, fmt.Errorf("error while calling EstimateGas rpc: %w", err)
 	}
 
 	return &bind.TransactOpts{
@@ -110,31 +150,94 @@ func (c *Client) EstimateGas(
 	}, nil
 }
 
+// revertedWith tells whether the call failed with the custom error of the contract.
+func revertedWith(err error, name string) bool {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return false
+	}
+	data, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return false
+	}
+	revert, decodeErr := hexutil.Decode(data)
+	if decodeErr != nil {
+		return false
+	}
+	contractABI, abiErr := ContractMetaData.GetAbi()
+	if abiErr != nil {
+		return false
+	}
+	customErr, ok := contractABI.Errors[name]
+	return ok && bytes.HasPrefix(revert, customErr.ID[:4])
+}
+
 // GetPendingNonce returns the pending nonce of the given wallet.
 func (c *Client) GetPendingNonce(ctx context.Context) (uint64, error) {
 	return c.backend.PendingNonceAt(ctx, c.wallet.Address())
 }
 
-// AddCID adds the given cid to the BasinStorage smart contract for the given pub and ts.
-func (c *Client) AddCID(ctx context.Context,
+// SignAddCID builds and signs the tx that adds the given cid to the BasinStorage smart contract
+// for the given pub and ts. The tx is not sent, so that it can be recorded before.
+func (c *Client) SignAddCID(_ context.Context,
 	pub string,
 	cid string,
 	timestamp int64,
 	txOpts *bind.TransactOpts,
-) error {
-	// TODO: implement retry logic
-	tx, err := c.contract.AddCID(
-		txOpts, pub, cid, big.NewInt(timestamp))
+) (*types.Transaction, error) {
+	opts := *txOpts
+	opts.NoSend = true
+	tx, err := c.contract.AddCID(&opts, pub, cid, big.NewInt(timestamp))
 	if err != nil {
-		return fmt.Errorf("failed to add cid: %v", err)
+		return nil, fmt.Errorf("failed to sign add cid tx: %v", err)
 	}
-	fmt.Printf("tx sent: %v \n", tx.Hash())
-	time.Sleep(150 * time.Second)
-	receipt, err := c.rpcBackend.TransactionReceipt(ctx, tx.Hash())
+
+	return tx, nil
+}
+
+// SignCreatePub builds and signs the tx that creates the given pub for the given owner
+// on the BasinStorage smart contract. The tx is not sent, so that it can be recorded before.
+func (c *Client) SignCreatePub(_ context.Context,
+	owner common.Address,
+	pub string,
+	txOpts *bind.TransactOpts,
+) (*types.Transaction, error) {
+	opts := *txOpts
+	opts.NoSend = true
+	tx, err := c.contract.CreatePub(&opts, owner, pub)
 	if err != nil {
-		return fmt.Errorf("failed to get tx receipt: %v", err)
+		return nil, fmt.Errorf("failed to sign create pub tx: %v", err)
 	}
-	fmt.Printf("got tx receipt: %v \n", receipt)
+
+	return tx, nil
+}
+
+// PubExists tells whether the given pub was created for the given owner.
+func (c *Client) PubExists(ctx context.Context, owner common.Address, pub string) (bool, error) {
+	pubs, err := c.contract.PubsOfOwner(&bind.CallOpts{Context: ctx}, owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to get pubs of owner: %v", err)
+	}
+	for _, p := range pubs {
+		if p == pub {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SendTx sends a signed tx.
+func (c *Client) SendTx(ctx context.Context, tx *types.Transaction) error {
+	if err := c.backend.SendTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("failed to send tx: %v", err)
+	}
+	fmt.Printf("tx sent: %v \n", tx.Hash())
 
 	return nil
 }
+
+// TxReceipt returns the receipt of a tx, or eth.NotFound while the tx is not mined.
+func (c *Client) TxReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return c.rpcBackend.TransactionReceipt(ctx, hash)
+}
@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/ipfs/go-cid"
+	w3fs "github.com/web3-storage/go-w3s-client/fs"
+)
+
+const (
+	// defaultAggregateTarget is the size at which an aggregate is archived without waiting for its window.
+	defaultAggregateTarget = 64 << 20
+	// defaultAggregateWindow is how long small objects wait for other objects of their relation.
+	defaultAggregateWindow = time.Hour
+	// aggregateBatchSize is the maximum number of pending objects read by a single run of the aggregator.
+	aggregateBatchSize = 10000
+)
+
+// PendingAggregate is a small object that was verified by the uploader,
+// and waits to be archived in an aggregate with other objects of its relation.
+type PendingAggregate struct {
+	Job       JobInfo // Job is the job of the object, without the CIDs of the aggregate.
+	Size      int64   // Size is the size of the object in bytes.
+	CreatedAt time.Time
+}
+
+// addPending verifies a small object and queues it for aggregation.
+func (u *FileUploader) addPending(ctx context.Context, job JobInfo, size int64) error {
+	reader, err := u.StorageClient.GetObjectReader(ctx, job.Bucket, job.FileName)
+	if err != nil {
+		return fmt.Errorf("failed to get object reader: %v", err)
+	}
+	digest, err := u.HashAlgorithm.Digest(reader)
+	if cerr := reader.Close(); cerr != nil {
+		log.Fatalf("error when closing cloud storage reader: %v", cerr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read object: %v", err)
+	}
+	if err := verifyHash(u.HashAlgorithm, job.Hash, digest); err != nil {
+		return reject(job.Hash, err)
+	}
+	fmt.Println("Hash verified", job.Bucket, job.FileName)
+
+	if err := u.DBClient.AddPendingAggregate(ctx, job, size); err != nil {
+		return fmt.Errorf("failed to add pending aggregate: %v", err)
+	}
+	fmt.Println("Queued for aggregation", job.Bucket, job.FileName, size)
+
+	return nil
+}
+
+// Aggregate archives the pending small objects, packed in one CAR per relation.
+// The objects of a relation are archived once they add up to the aggregate target,
+// or once the oldest of them waited for the aggregate window. Each object gets its
+// own job, with the root CID of the aggregate and its path and CID within it.
+// A failing aggregate does not stop the others from being archived.
+func (u *FileUploader) Aggregate(ctx context.Context) error {
+	pending, err := u.DBClient.PendingAggregates(ctx, aggregateBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get pending aggregates: %v", err)
+	}
+
+	batches, err := planAggregates(pending, u.AggregateTarget, time.Now().UTC().Add(-u.AggregateWindow))
+	if err != nil {
+		return err
+	}
+
+	var archived, failed int
+	for _, batch := range batches {
+		if err := u.archiveAggregate(ctx, batch); err != nil {
+			log.Printf("ERROR: aggregate failed: %v, files: %d", err, len(batch))
+			failed++
+			continue
+		}
+		archived++
+	}
+	fmt.Printf("archived %d aggregates, %d failed, %d objects pending\n", archived, failed, len(pending))
+
+	return nil
+}
+
+// planAggregates splits the pending objects into the aggregates that are ready to be archived.
+// Objects are aggregated per relation, in the order they were queued. An aggregate is ready
+// once it reaches the target size, or once its oldest object was queued before the deadline.
+// Objects are stored under their base name, an object with the same base name as another
+// object of the aggregate is left for a later aggregate.
+func planAggregates(pending []PendingAggregate, target int64, deadline time.Time) ([][]PendingAggregate, error) {
+	byPub := map[Pub][]PendingAggregate{}
+	var pubs []Pub
+	for _, p := range pending {
+		pub, err := extractPub(p.Job.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract pub: %v", err)
+		}
+		if _, ok := byPub[pub]; !ok {
+			pubs = append(pubs, pub)
+		}
+		byPub[pub] = append(byPub[pub], p)
+	}
+
+	var batches [][]PendingAggregate
+	for _, pub := range pubs {
+		items := byPub[pub]
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		})
+
+		var batch []PendingAggregate
+		var size int64
+		names := map[string]bool{}
+		for _, item := range items {
+			name := path.Base(item.Job.FileName)
+			if names[name] {
+				continue
+			}
+			names[name] = true
+			batch = append(batch, item)
+			size += item.Size
+			if size >= target {
+				batches = append(batches, batch)
+				batch, size, names = nil, 0, map[string]bool{}
+			}
+		}
+		if len(batch) > 0 && batch[0].CreatedAt.Before(deadline) {
+			batches = append(batches, batch)
+		}
+	}
+
+	return batches, nil
+}
+
+// archiveAggregate uploads the objects as the files of one directory, and creates their jobs.
+// Objects that were replaced since they were queued are dropped, their new generation
+// is uploaded on its own.
+func (u *FileUploader) archiveAggregate(ctx context.Context, batch []PendingAggregate) error {
+	var items []PendingAggregate
+	for _, item := range batch {
+		job := item.Job
+		generation, err := u.StorageClient.GetObjectGeneration(ctx, job.Bucket, job.FileName)
+		if err != nil {
+			return fmt.Errorf("failed to get object generation: %v", err)
+		}
+		if generation != job.Generation {
+			fmt.Println("Object replaced, dropping from aggregate", job.Bucket, job.FileName, job.Generation)
+			if err := u.DBClient.DeletePendingAggregate(ctx, job.Bucket, job.FileName, job.Generation); err != nil {
+				return fmt.Errorf("failed to delete pending aggregate: %v", err)
+			}
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	pub, err := extractPub(items[0].Job.FileName)
+	if err != nil {
+		return fmt.Errorf("failed to extract pub: %v", err)
+	}
+	enc, err := u.namespaceEncryption(ctx, items[0].Job.FileName)
+	if err != nil {
+		return err
+	}
+
+	// Both passes must produce the same ciphertext, each file keeps its salt.
+	salts := make([][]byte, len(items))
+	if enc != nil {
+		for i := range salts {
+			if salts[i], err = newSalt(); err != nil {
+				return err
+			}
+		}
+	}
+	dir := func() fs.File {
+		files := make([]fs.File, len(items))
+		for i, item := range items {
+			job, salt := item.Job, salts[i]
+			name, size := enc.name(path.Base(job.FileName)), item.Size
+			if enc != nil {
+				size = EncryptedSize(size)
+			}
+			files[i] = &lazyFile{name: name, size: size, open: func() (io.ReadCloser, error) {
+				reader, err := u.StorageClient.GetObjectReader(ctx, job.Bucket, job.FileName)
+				if err != nil || enc == nil {
+					return reader, err
+				}
+				r, err := newEncryptReader(reader, enc.Key, salt)
+				if err != nil {
+					_ = reader.Close()
+					return nil, fmt.Errorf("failed to encrypt: %v", err)
+				}
+				return struct {
+					io.Reader
+					io.Closer
+				}{r, reader}, nil
+			}}
+		}
+		return w3fs.NewDir(pub.Namespace+"."+pub.Relation, files)
+	}
+
+	localCAR, err := buildCAR(ctx, dir())
+	if err != nil {
+		return fmt.Errorf("failed to build car: %v", err)
+	}
+	fmt.Println("Local CAR built", localCAR.Root, localCAR.Size, localCAR.PieceCid, len(items))
+
+	root, err := u.DealClient.Put(ctx, dir())
+	if err != nil {
+		return fmt.Errorf("failed to upload aggregate: %v", err)
+	}
+
+	// The deal provider must have archived exactly the bytes we built locally.
+	if !root.Equals(localCAR.Root) {
+		mismatch := &CIDMismatchError{Local: localCAR.Root, Provider: root}
+		log.Printf("ERROR: %v, aggregate: %s", mismatch, pub)
+		return fmt.Errorf("failed to upload aggregate: %w", mismatch)
+	}
+	fmt.Println("Aggregate upload successful :", root)
+
+	jobs := make([]JobInfo, len(items))
+	for i, item := range items {
+		job := item.Job
+		job.Path = enc.name(path.Base(job.FileName))
+		subCid, ok := localCAR.Entries[job.Path]
+		if !ok {
+			return fmt.Errorf("missing aggregate entry: %s", job.Path)
+		}
+		job.SubCid = subCid.String()
+		job.Cid = localCAR.Root.String()
+		job.CarSize = localCAR.Size
+		job.PieceCid = localCAR.PieceCid.String()
+		job.KeyRef = enc.ref()
+		jobs[i] = job
+	}
+	if err := u.DBClient.CreateAggregate(ctx, jobs); err != nil {
+		return err
+	}
+	fmt.Println("DB insert successful", root, len(jobs))
+
+	return nil
+}
+
+// lazyFile is a file of an aggregate, it is only opened when it is first read,
+// so the objects of an aggregate are streamed one at a time.
+type lazyFile struct {
+	name   string
+	size   int64
+	open   func() (io.ReadCloser, error)
+	reader io.ReadCloser
+	closed bool
+}
+
+func (f *lazyFile) Stat() (fs.FileInfo, error) {
+	return &fileInfo{name: f.name, size: f.size}, nil
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		reader, err := f.open()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get object reader: %v", err)
+		}
+		f.reader = reader
+	}
+	return f.reader.Read(p)
+}
+
+func (f *lazyFile) Close() error {
+	if f.closed || f.reader == nil {
+		f.closed = true
+		return nil
+	}
+	f.closed = true
+	return f.reader.Close()
+}
+
+// AddPendingAggregate queues a verified small object for aggregation.
+func (db *DBClient) AddPendingAggregate(ctx context.Context, job JobInfo, size int64) error {
+	pub, err := extractPub(job.FileName)
+	if err != nil {
+		return fmt.Errorf("failed to extract pub: %v", err)
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %v", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx,
+		`UPSERT INTO aggregate_pending (bucket, object, generation, namespace, relation, size, job)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		job.Bucket, job.FileName, job.Generation, pub.Namespace, pub.Relation, size, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add pending aggregate: %v", err)
+	}
+
+	return nil
+}
+
+// PendingAggregates returns the objects waiting for aggregation, the oldest first.
+func (db *DBClient) PendingAggregates(ctx context.Context, limit int) ([]PendingAggregate, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		`SELECT job, size, created_at
+		FROM aggregate_pending
+		ORDER BY created_at
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending aggregates: %v", err)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Fatalf("error when closing crdb connection: %v", err)
+		}
+	}()
+
+	var result []PendingAggregate
+	for rows.Next() {
+		var p PendingAggregate
+		var data []byte
+		if err := rows.Scan(&data, &p.Size, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if err := json.Unmarshal(data, &p.Job); err != nil {
+			return nil, fmt.Errorf("failed to decode job: %v", err)
+		}
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// DeletePendingAggregate removes an object from the objects waiting for aggregation.
+func (db *DBClient) DeletePendingAggregate(ctx context.Context, bucket string, fname string, generation int64) error {
+	_, err := db.DB.ExecContext(ctx,
+		"DELETE FROM aggregate_pending WHERE bucket = $1 AND object = $2 AND generation = $3",
+		bucket, fname, generation,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending aggregate: %v", err)
+	}
+
+	return nil
+}
+
+// CreateAggregate creates the jobs of the objects of an aggregate, and removes
+// the objects from the objects waiting for aggregation, in a single transaction.
+func (db *DBClient) CreateAggregate(ctx context.Context, jobs []JobInfo) error {
+	txopts := &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+
+	err := crdb.ExecuteTx(ctx, db.DB, txopts, func(tx *sql.Tx) error {
+		for _, job := range jobs {
+			rootCid, err := cid.Decode(job.Cid)
+			if err != nil {
+				return fmt.Errorf("failed to decode cid: %v", err)
+			}
+			pieceCid, err := cid.Decode(job.PieceCid)
+			if err != nil {
+				return fmt.Errorf("failed to decode piece cid: %v", err)
+			}
+			pub, err := extractPub(job.FileName)
+			if err != nil {
+				return fmt.Errorf("failed to extract table name: %v", err)
+			}
+			if err := createJobTx(tx, rootCid.Bytes(), pieceCid.Bytes(), pub, job); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(
+				"DELETE FROM aggregate_pending WHERE bucket = $1 AND object = $2 AND generation = $3",
+				job.Bucket, job.FileName, job.Generation,
+			); err != nil {
+				return fmt.Errorf("failed to delete pending aggregate: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create aggregate jobs: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAggregates(t *testing.T) {
+	now := time.Now()
+	pending := func(name string, size int64, age time.Duration) PendingAggregate {
+		return PendingAggregate{
+			Job:       JobInfo{FileName: name},
+			Size:      size,
+			CreatedAt: now.Add(-age),
+		}
+	}
+
+	batches, err := planAggregates([]PendingAggregate{
+		pending("ns/full/2023-01-01/a.parquet", 60, time.Minute),
+		pending("ns/full/2023-01-01/b.parquet", 50, time.Minute),
+		pending("ns/full/2023-01-01/c.parquet", 10, time.Minute),
+		// the oldest object of the relation waited for the window
+		pending("ns/old/2023-01-01/a.parquet", 10, 2*time.Hour),
+		pending("ns/old/2023-01-02/a.parquet", 10, time.Minute),
+		pending("ns/old/2023-01-02/b.parquet", 10, time.Minute),
+		// the relation is below the target and within the window
+		pending("ns/new/2023-01-01/a.parquet", 10, time.Minute),
+	}, 100, now.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+
+	names := func(batch []PendingAggregate) []string {
+		var names []string
+		for _, p := range batch {
+			names = append(names, p.Job.FileName)
+		}
+		return names
+	}
+	// c is left for a later aggregate, until the relation reaches the target again
+	assert.Equal(t, []string{"ns/full/2023-01-01/a.parquet", "ns/full/2023-01-01/b.parquet"}, names(batches[0]))
+	// objects with the same base name are not aggregated together
+	assert.Equal(t, []string{"ns/old/2023-01-01/a.parquet", "ns/old/2023-01-02/b.parquet"}, names(batches[1]))
+}
+
+func TestAggregator(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, nil)
+	require.NoError(t, err)
+
+	hash := mockParquetHash()
+	writeObject := func(name string, timestamp int64) {
+		path := filepath.Join(dir, "mybucket", filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, mockParquet(), 0o600))
+		metadata, err := json.Marshal(map[string]string{
+			"timestamp": strconv.FormatInt(timestamp, 10),
+			"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+			"hash":      hash,
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+".metadata.json", metadata, 0o600))
+	}
+
+	names := []string{
+		"foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet",
+		"foo.bar.baz/relname/2023-11-17/202311171920330000000000000000000-3ab461ed932d5f1c-1-2-00000001-relname-1.parquet",
+		"foo.bar.baz/relname/2023-11-17/202311171920340000000000000000000-3ab461ed932d5f1c-1-2-00000002-relname-1.parquet",
+	}
+	for i, name := range names {
+		writeObject(name, 1700248832+int64(i))
+	}
+
+	w3sClient := &mockW3sClient{}
+	db := newTestMemDB(t, "foo.bar.baz")
+	pending := func() []PendingAggregate {
+		p, err := db.PendingAggregates(ctx, len(names))
+		require.NoError(t, err)
+		return p
+	}
+	uploader := FileUploader{
+		StorageClient:   store,
+		DealClient:      newTestW3SProvider(t, w3sClient),
+		DBClient:        db,
+		AggregateSize:   int64(len(mockParquet())),
+		AggregateTarget: int64(2 * len(mockParquet())),
+		AggregateWindow: time.Hour,
+	}
+
+	// small objects are only queued by the uploader
+	for _, name := range names {
+		require.NoError(t, uploader.UploadObject(ctx, "mybucket", name))
+	}
+	assert.Empty(t, w3sClient.Files)
+	assert.Empty(t, createdJobs(db))
+	require.Len(t, pending(), 3)
+
+	// the first two objects reach the target, the last one waits for the window
+	require.NoError(t, uploader.Aggregate(ctx))
+	require.Len(t, w3sClient.Files, 2)
+	assert.Equal(t, filepath.Base(names[0]), w3sClient.Files[0].Name)
+	assert.Equal(t, mockParquet(), w3sClient.Files[0].Data)
+	assert.Equal(t, filepath.Base(names[1]), w3sClient.Files[1].Name)
+	created := createdJobs(db)
+	require.Len(t, created, 2)
+	require.Len(t, pending(), 1)
+	assert.Equal(t, names[2], pending()[0].Job.FileName)
+
+	for i, job := range created {
+		assert.Equal(t, names[i], job.FileName)
+		assert.Equal(t, created[0].Cid, job.Cid)
+		assert.Equal(t, created[0].PieceCid, job.PieceCid)
+		assert.Equal(t, filepath.Base(names[i]), job.Path)
+		// the object fits in a single raw block
+		assert.Equal(t, getCIDFromBytes(mockParquet()).String(), job.SubCid)
+		assert.Equal(t, int64(5), job.Parquet.NumRows)
+	}
+
+	uploader.AggregateWindow = 0
+	require.NoError(t, uploader.Aggregate(ctx))
+	created = createdJobs(db)
+	require.Len(t, created, 3)
+	assert.Empty(t, pending())
+	assert.NotEqual(t, created[0].Cid, created[2].Cid)
+
+	// the root of an aggregate is added to the contract once, with the latest timestamp
+	jobs, err := db.UnfinishedJobs(ctx)
+	require.NoError(t, err)
+	merged := mergeAggregatedJobs(jobs)
+	require.Len(t, merged, 2)
+	assert.Equal(t, int64(1700248833), *merged[0].Timestamp)
+	assert.Equal(t, int64(1700248834), *merged[1].Timestamp)
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+const (
+	// backfillPageSize is the number of objects listed at once by the backfill.
+	backfillPageSize = 1000
+	// defaultBackfillConcurrency is the number of objects checked and uploaded at once by the backfill.
+	defaultBackfillConcurrency = 4
+)
+
+// BackfillOptions defines which objects are backfilled, and how.
+type BackfillOptions struct {
+	Bucket string
+	Prefix string
+	// StartAfter resumes a backfill after the object with this name.
+	StartAfter string
+	// Concurrency is the number of objects checked and uploaded at once. Defaults to 4.
+	Concurrency int
+	// DryRun only reports the missing objects, nothing is uploaded.
+	DryRun bool
+	// Checkpoint, when not nil, is called with the name of the last listed object once
+	// every object up to it was handled. The backfill can be resumed after this name.
+	Checkpoint func(name string) error
+}
+
+// BackfillReport summarizes a backfill.
+type BackfillReport struct {
+	Listed   int // Listed is the number of objects listed.
+	Archived int // Archived is the number of objects that already had a job.
+	Rejected int // Rejected is the number of objects whose generation was already rejected.
+	Uploaded int // Uploaded is the number of missing objects that were uploaded.
+	Failed   int // Failed is the number of missing objects whose upload failed.
+	// Missing are the names of the objects without a job.
+	Missing []string
+	// Last is the name of the last object handled, the backfill can be resumed after it.
+	Last string
+}
+
+// Backfill uploads the objects of a bucket prefix that never produced a job, e.g. because
+// the uploader was down when they were exported. An object has a job if a job exists for
+// its generation, or for content with the hash in its metadata. Missing objects go through
+// the same upload as the objects of events, failures are recorded and retried as usual.
+// An object generation that was already rejected is skipped, it would be rejected again.
+func (u *FileUploader) Backfill(ctx context.Context, opts BackfillOptions) (*BackfillReport, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBackfillConcurrency
+	}
+
+	report := &BackfillReport{Last: opts.StartAfter}
+	var mu sync.Mutex
+	for {
+		var objects []listedObject
+		err := u.StorageClient.ListObjects(ctx, opts.Bucket, opts.Prefix, report.Last, backfillPageSize,
+			func(name string, generation int64) error {
+				objects = append(objects, listedObject{Name: name, Generation: generation})
+				return nil
+			})
+		if err != nil {
+			return report, fmt.Errorf("failed to list objects: %v", err)
+		}
+		if len(objects) == 0 {
+			return report, nil
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		errs := make(chan error, len(objects))
+		for _, object := range objects {
+			object := object
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				rejected, err := u.DBClient.RejectionExists(ctx, opts.Bucket, object.Name, object.Generation)
+				if err != nil {
+					errs <- fmt.Errorf("failed to check existing rejection: %v", err)
+					return
+				}
+				if rejected {
+					mu.Lock()
+					report.Rejected++
+					mu.Unlock()
+					return
+				}
+
+				archived, err := u.objectArchived(ctx, opts.Bucket, object)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if archived {
+					mu.Lock()
+					report.Archived++
+					mu.Unlock()
+					return
+				}
+
+				mu.Lock()
+				report.Missing = append(report.Missing, object.Name)
+				mu.Unlock()
+				if opts.DryRun {
+					return
+				}
+
+				fmt.Println("Backfilling", opts.Bucket, object.Name)
+				err = u.UploadObject(ctx, opts.Bucket, object.Name)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					log.Printf("ERROR: backfill failed: %v, file: %s", err, object.Name)
+					report.Failed++
+					return
+				}
+				report.Uploaded++
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		sort.Strings(report.Missing)
+
+		// The page is only done once every object of it was checked.
+		if err := <-errs; err != nil {
+			return report, err
+		}
+		report.Listed += len(objects)
+		report.Last = objects[len(objects)-1].Name
+		if opts.Checkpoint != nil {
+			if err := opts.Checkpoint(report.Last); err != nil {
+				return report, fmt.Errorf("failed to checkpoint: %v", err)
+			}
+		}
+		fmt.Printf("backfill: listed %d, archived %d, rejected %d, missing %d, uploaded %d, failed %d, last %s\n",
+			report.Listed, report.Archived, report.Rejected, len(report.Missing), report.Uploaded, report.Failed,
+			report.Last)
+	}
+}
+
+// listedObject is an object listed by the backfill.
+type listedObject struct {
+	Name       string
+	Generation int64
+}
+
+// objectArchived tells whether a job exists for the object, by generation or by hash.
+func (u *FileUploader) objectArchived(ctx context.Context, bucket string, object listedObject) (bool, error) {
+	exists, err := u.DBClient.JobExists(ctx, bucket, object.Name, object.Generation)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existing job: %v", err)
+	}
+	if exists {
+		return true, nil
+	}
+
+	metadata, err := u.StorageClient.GetObjectMetadata(ctx, bucket, object.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to get object metadata: %v", err)
+	}
+	// without a valid hash the object is missing, its upload records why it is rejected
+	hash := metadata[MetadataHash]
+	if checkHex(hash, hashLength) != nil {
+		return false, nil
+	}
+	exists, err = u.DBClient.JobExistsByHash(ctx, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existing job: %v", err)
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, nil)
+	require.NoError(t, err)
+
+	writeObject := func(name string, metadata map[string]string) int64 {
+		path := filepath.Join(dir, "mybucket", filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, mockParquet(), 0o600))
+		data, err := json.Marshal(metadata)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+".metadata.json", data, 0o600))
+		generation, err := store.GetObjectGeneration(ctx, "mybucket", name)
+		require.NoError(t, err)
+		return generation
+	}
+
+	prefix := "foo.bar.baz/relname/2023-11-17/"
+	hash := mockParquetHash()
+	otherHash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	sign := func(hash string) map[string]string {
+		return map[string]string{"hash": hash, "signature": signHash(testOwnerKey(), hash, SignatureRaw)}
+	}
+
+	// the job of the generation exists
+	archived := prefix + "202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet"
+	archivedGen := writeObject(archived, sign(otherHash))
+	// a job archived the same content under another name
+	copied := prefix + "202311171920330000000000000000000-3ab461ed932d5f1c-1-2-00000001-relname-1.parquet"
+	writeObject(copied, sign("0x"+otherHash))
+	// the upload of this one never happened
+	missing := prefix + "202311171920340000000000000000000-3ab461ed932d5f1c-1-2-00000002-relname-1.parquet"
+	writeObject(missing, sign(hash))
+	// this one has no metadata, it is rejected by the upload
+	invalid := prefix + "202311171920350000000000000000000-3ab461ed932d5f1c-1-2-00000003-relname-1.parquet"
+	writeObject(invalid, map[string]string{})
+	// objects out of the prefix are not listed
+	writeObject("foo.bar.baz/relname/2023-11-18/202311181920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet", sign(hash)) // nolint:lll
+
+	w3sClient := &mockW3sClient{}
+	db := newTestMemDB(t, "foo.bar.baz")
+	require.NoError(t, db.CreateJob(ctx, JobInfo{
+		Cid:        getCIDFromBytes(mockData()).String(),
+		Bucket:     "mybucket",
+		FileName:   archived,
+		Generation: archivedGen,
+		Hash:       otherHash,
+	}))
+	uploader := FileUploader{
+		StorageClient: store,
+		DealClient:    newTestW3SProvider(t, w3sClient),
+		DBClient:      db,
+	}
+
+	// a dry run only reports the missing objects
+	report, err := uploader.Backfill(ctx, BackfillOptions{Bucket: "mybucket", Prefix: prefix, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Listed)
+	assert.Equal(t, 2, report.Archived)
+	assert.Equal(t, []string{missing, invalid}, report.Missing)
+	assert.Zero(t, report.Uploaded)
+	assert.Empty(t, w3sClient.Files)
+	assert.Len(t, createdJobs(db), 1)
+
+	var checkpoints []string
+	opts := BackfillOptions{
+		Bucket: "mybucket",
+		Prefix: prefix,
+		Checkpoint: func(name string) error {
+			checkpoints = append(checkpoints, name)
+			return nil
+		},
+	}
+	report, err = uploader.Backfill(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{missing, invalid}, report.Missing)
+	assert.Equal(t, 1, report.Uploaded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, []string{invalid}, checkpoints)
+
+	created := createdJobs(db)
+	require.Len(t, created, 2)
+	assert.Equal(t, missing, created[1].FileName)
+	assert.Equal(t, []string{invalid}, rejectedPaths(db))
+
+	// a resumed backfill starts after the last checkpoint
+	opts.StartAfter = checkpoints[0]
+	report, err = uploader.Backfill(ctx, opts)
+	require.NoError(t, err)
+	assert.Zero(t, report.Listed)
+	assert.Equal(t, invalid, report.Last)
+
+	// the missing object has a job now and the rejected generation is skipped
+	opts.StartAfter = ""
+	report, err = uploader.Backfill(ctx, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Missing)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Zero(t, report.Failed)
+	assert.Equal(t, []string{invalid}, rejectedPaths(db))
+}
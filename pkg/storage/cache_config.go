@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// NamespaceDefault is the relation of the cache config that applies to every
+// relation of a namespace without a config of its own.
+const NamespaceDefault = "*"
+
+// CacheConfig is the cache duration, in minutes, of the exports of a relation.
+type CacheConfig struct {
+	Namespace string
+	Relation  string // Relation is the name of the relation, or NamespaceDefault.
+	Duration  int64
+}
+
+// resolveCacheDuration returns the cache duration of an export. The `cache_duration`
+// metadata of the object overrides the relation config, which overrides the namespace default.
+// Each of them is nil when it is not set.
+func resolveCacheDuration(metadata, relation, namespace *int64) int64 {
+	for _, duration := range []*int64{metadata, relation, namespace} {
+		if duration != nil {
+			return *duration
+		}
+	}
+	return 0
+}
+
+// cacheDurationTx resolves the cache duration of a new job from the cache config of its relation.
+func cacheDurationTx(tx *sql.Tx, nsID int, pub Pub, metadata *int64) (int64, error) {
+	if metadata != nil {
+		return *metadata, nil
+	}
+
+	rows, err := tx.Query(
+		`SELECT relation, duration FROM cache_config
+		WHERE ns_id = $1 AND relation IN ($2, $3) AND duration IS NOT NULL`,
+		nsID, pub.Relation, NamespaceDefault)
+	if err != nil {
+		return 0, errors.Wrap(err, "querying cache config")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var relation, namespace *int64
+	for rows.Next() {
+		var name string
+		var duration int64
+		if err := rows.Scan(&name, &duration); err != nil {
+			return 0, errors.Wrap(err, "scanning cache config")
+		}
+		if name == NamespaceDefault {
+			namespace = &duration
+		} else {
+			relation = &duration
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "reading cache config")
+	}
+
+	return resolveCacheDuration(nil, relation, namespace), nil
+}
+
+// CacheConfigs returns the cache configs of a namespace, including its default.
+func (db *DBClient) CacheConfigs(ctx context.Context, ns string) ([]CacheConfig, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		`SELECT namespaces.name, cache_config.relation, cache_config.duration
+		FROM cache_config
+		JOIN namespaces ON namespaces.id = cache_config.ns_id
+		WHERE namespaces.name = $1 AND cache_config.duration IS NOT NULL
+		ORDER BY cache_config.relation`,
+		ns,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cache configs: %v", err)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Fatalf("error when closing crdb connection: %v", err)
+		}
+	}()
+
+	var result []CacheConfig
+	for rows.Next() {
+		var c CacheConfig
+		if err := rows.Scan(&c.Namespace, &c.Relation, &c.Duration); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+// SetCacheConfig inserts or replaces the cache config of a relation, or of a namespace
+// when the relation is NamespaceDefault.
+func (db *DBClient) SetCacheConfig(ctx context.Context, c CacheConfig) error {
+	if c.Duration < 0 {
+		return fmt.Errorf("cache duration must not be negative: %d", c.Duration)
+	}
+
+	res, err := db.DB.ExecContext(ctx,
+		`UPSERT INTO cache_config (ns_id, relation, duration)
+		SELECT id, $2, $3 FROM namespaces WHERE name = $1`,
+		c.Namespace, c.Relation, c.Duration,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set cache config: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("namespace not found: %s", c.Namespace)
+	}
+
+	return nil
+}
+
+// DeleteCacheConfig removes the cache config of a relation, or of a namespace
+// when the relation is NamespaceDefault.
+func (db *DBClient) DeleteCacheConfig(ctx context.Context, ns string, relation string) error {
+	_, err := db.DB.ExecContext(ctx,
+		`DELETE FROM cache_config
+		WHERE ns_id = (SELECT id FROM namespaces WHERE name = $1) AND relation = $2`,
+		ns, relation,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete cache config: %v", err)
+	}
+
+	return nil
+}
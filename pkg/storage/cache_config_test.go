@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tablelandnetwork/basin-storage/mocks"
+)
+
+func TestResolveCacheDuration(t *testing.T) {
+	duration := func(d int64) *int64 { return &d }
+
+	tests := []struct {
+		name      string
+		metadata  *int64
+		relation  *int64
+		namespace *int64
+		expected  int64
+	}{
+		{name: "none", expected: 0},
+		{name: "namespace", namespace: duration(30), expected: 30},
+		{name: "relation", relation: duration(20), namespace: duration(30), expected: 20},
+		{name: "metadata", metadata: duration(10), relation: duration(20), namespace: duration(30), expected: 10},
+		{name: "metadata disables", metadata: duration(0), relation: duration(20), expected: 0},
+		{name: "relation disables", relation: duration(0), namespace: duration(30), expected: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, resolveCacheDuration(tc.metadata, tc.relation, tc.namespace))
+		})
+	}
+}
+
+func TestUploaderCacheConfig(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+
+	// the metadata has no cache duration, the relation config applies
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{
+		Namespace: "foo.bar.baz",
+		Relation:  NamespaceDefault,
+		Duration:  30,
+	}))
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{Namespace: "foo.bar.baz", Relation: "relname", Duration: 20}))
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{Namespace: "foo.bar.baz", Relation: "other", Duration: 10}))
+
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+	}
+
+	require.NoError(t, uploader.Upload(ctx))
+	mockStore.AssertExpectations(t)
+
+	jobs := testJobs(db)
+	require.Equal(t, 1, len(jobs))
+	assert.Nil(t, createdJobs(db)[0].CacheDuration)
+	assert.WithinDuration(t, time.Now().Add(20*time.Minute), jobs[0].ExpiresAt, time.Minute)
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-mfs"
+	"github.com/ipld/go-car"
+	"github.com/web3-storage/go-w3s-client/adder"
+)
+
+// writeCAR encodes the file as UnixFS and writes it as a CAR to w.
+// It uses the same chunking and layout parameters as web3.storage,
+// so the returned root CID matches the one web3.storage derives for the same file.
+func writeCAR(ctx context.Context, file fs.File, w io.Writer) (cid.Cid, error) {
+	root, _, err := writeDAG(ctx, file, w)
+	return root, err
+}
+
+// writeDAG is writeCAR that also returns the CIDs of the entries of a directory, by name.
+// Like web3.storage, a directory is not wrapped in another directory, its root is the directory itself.
+// The blocks of the DAG are kept on disk while the CAR is written, not in memory.
+func writeDAG(ctx context.Context, file fs.File, w io.Writer) (cid.Cid, map[string]cid.Cid, error) {
+	d, err := addDAG(ctx, file)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	defer d.Close()
+
+	if err := car.WriteCar(ctx, d.dag, []cid.Cid{d.Root}, w); err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to write car: %v", err)
+	}
+
+	return d.Root, d.Entries, nil
+}
+
+// tempDAG is the UnixFS DAG of a file, whose blocks are kept in a temporary datastore on disk.
+type tempDAG struct {
+	Root cid.Cid
+	// Entries are the CIDs of the entries of a directory, by name. It is nil for a file.
+	Entries map[string]cid.Cid
+	Blocks  blockstore.Blockstore
+
+	dag     format.DAGService
+	cleanup func()
+}
+
+// Close removes the blocks of the DAG.
+func (d *tempDAG) Close() {
+	d.cleanup()
+}
+
+// addDAG encodes the file as UnixFS, with the same chunking and layout parameters as web3.storage.
+// The DAG must be closed.
+func addDAG(ctx context.Context, file fs.File) (_ *tempDAG, err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	store, cleanup, err := tempDatastore()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+	d := &tempDAG{Blocks: blockstore.NewBlockstoreNoPrefix(store), cleanup: cleanup}
+	d.dag = merkledag.NewDAGService(bserv.New(d.Blocks, nil))
+
+	dagFmtr, err := adder.NewAdder(ctx, d.dag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize adder: %v", err)
+	}
+
+	d.Root, err = dagFmtr.Add(file, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add file: %v", err)
+	}
+
+	if info.IsDir() {
+		d.Root, d.Entries, err = dirEntries(ctx, dagFmtr, info.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// tempDatastore creates a datastore in a temporary directory, so that the blocks of a DAG
+// are not held in memory. The directory is removed by cleanup.
+func tempDatastore() (*flatfs.Datastore, func(), error) {
+	dir, err := os.MkdirTemp("", "basin-dag-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create datastore dir: %v", err)
+	}
+	store, err := flatfs.CreateOrOpen(dir, flatfs.NextToLast(2), false)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("failed to create datastore: %v", err)
+	}
+
+	cleanup := func() {
+		if err := store.Close(); err != nil {
+			fmt.Println("failed to close datastore:", err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Println("failed to remove datastore:", err)
+		}
+	}
+	return store, cleanup, nil
+}
+
+// dirEntries returns the CID of the added directory and of each of its entries.
+func dirEntries(ctx context.Context, dagFmtr *adder.Adder, name string) (cid.Cid, map[string]cid.Cid, error) {
+	mr, err := dagFmtr.MfsRoot()
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to get root: %v", err)
+	}
+	child, err := mr.GetDirectory().Child(name)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to get directory: %v", err)
+	}
+	dir, ok := child.(*mfs.Directory)
+	if !ok {
+		return cid.Undef, nil, fmt.Errorf("not a directory: %s", name)
+	}
+	node, err := dir.GetNode()
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to get directory node: %v", err)
+	}
+
+	names, err := dir.ListNames(ctx)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to list directory: %v", err)
+	}
+	entries := make(map[string]cid.Cid, len(names))
+	for _, n := range names {
+		entry, err := dir.Child(n)
+		if err != nil {
+			return cid.Undef, nil, fmt.Errorf("failed to get entry %s: %v", n, err)
+		}
+		entryNode, err := entry.GetNode()
+		if err != nil {
+			return cid.Undef, nil, fmt.Errorf("failed to get entry node %s: %v", n, err)
+		}
+		entries[n] = entryNode.Cid()
+	}
+
+	return node.Cid(), entries, nil
+}
+
+// LocalCAR describes a CAR that was built locally from a file.
+type LocalCAR struct {
+	Root     cid.Cid // Root is the root CID of the UnixFS DAG.
+	Size     int64   // Size is the length of the CAR in bytes.
+	PieceCid cid.Cid // PieceCid is the Filecoin piece commitment (CommP) of the CAR.
+	// Entries are the CIDs of the entries of a directory, by name. It is nil for a file.
+	Entries map[string]cid.Cid
+}
+
+// buildCAR encodes the file as a CAR, and returns its root CID, size and piece commitment.
+// The CAR itself is discarded.
+func buildCAR(ctx context.Context, file fs.File) (*LocalCAR, error) {
+	counter := &countingWriter{}
+	cp := &commp.Calc{}
+
+	root, entries, err := writeDAG(ctx, file, io.MultiWriter(counter, cp))
+	if err != nil {
+		return nil, err
+	}
+
+	commP, _, err := cp.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute piece commitment: %v", err)
+	}
+	pieceCid, err := commcid.DataCommitmentV1ToCID(commP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build piece cid: %v", err)
+	}
+
+	return &LocalCAR{
+		Root:     root,
+		Size:     counter.n,
+		PieceCid: pieceCid,
+		Entries:  entries,
+	}, nil
+}
+
+// CIDMismatchError is returned when the deal provider derived a different root CID
+// than the one that was computed locally for the same file.
+type CIDMismatchError struct {
+	Local    cid.Cid
+	Provider cid.Cid
+}
+
+func (e *CIDMismatchError) Error() string {
+	return fmt.Sprintf("cid mismatch: local root is %s, deal provider returned %s", e.Local, e.Provider)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCAR(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	root, err := writeCAR(ctx, newMockFile(mockData(), "hello.txt"), &buf)
+	require.NoError(t, err)
+
+	localCAR, err := buildCAR(ctx, newMockFile(mockData(), "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, root, localCAR.Root)
+	assert.Equal(t, int64(buf.Len()), localCAR.Size)
+	assert.Equal(t, uint64(cid.FilCommitmentUnsealed), localCAR.PieceCid.Prefix().Codec)
+
+	// the same bytes under another name have another root
+	other, err := buildCAR(ctx, newMockFile(mockData(), "other.txt"))
+	require.NoError(t, err)
+	assert.NotEqual(t, localCAR.Root, other.Root)
+	assert.NotEqual(t, localCAR.PieceCid, other.PieceCid)
+}
+
+func TestBuildCARMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping memory test")
+	}
+	ctx := context.Background()
+	size := int64(64 << 20)
+
+	// the blocks of the DAG are not held in memory while the CAR is written
+	var written int64
+	growth := peakHeapGrowth(func() {
+		var err error
+		written, err = io.Copy(io.Discard, carReader(ctx, randomFile("random.bin", size)))
+		require.NoError(t, err)
+	})
+	assert.Greater(t, written, size)
+	assert.Less(t, growth, uint64(size/4))
+}
+
+// carReader streams the CAR of the file.
+func carReader(ctx context.Context, file fs.File) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		_, err := writeCAR(ctx, file, w)
+		_ = w.CloseWithError(err)
+	}()
+	return r
+}
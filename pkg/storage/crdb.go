@@ -11,8 +11,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 
-	// Blank-import libpq package for SQL.
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
 	"github.com/cockroachdb/cockroach-go/crdb"
@@ -21,12 +20,9 @@ import (
 func createJobTx(
 	tx *sql.Tx,
 	cidBytes []byte,
+	pieceCidBytes []byte,
 	pub Pub,
-	timestamp *int64,
-	fname string,
-	cacheDuration int64,
-	sign string,
-	hash string,
+	job JobInfo,
 ) error {
 	row := tx.QueryRow(
 		"SELECT id FROM namespaces WHERE name = $1", pub.Namespace)
@@ -35,50 +31,171 @@ func createJobTx(
 		return errors.Wrap(err, "error while querying namespace")
 	}
 
+	cacheDuration, err := cacheDurationTx(tx, nsID, pub, job.CacheDuration)
+	if err != nil {
+		return err
+	}
+
 	expiresAt, cachePath := &sql.NullTime{}, &sql.NullString{}
 	if cacheDuration > 0 {
 		_ = expiresAt.Scan(time.Now().Add(time.Minute * time.Duration(cacheDuration)).UTC())
-		_ = cachePath.Scan(fname)
+		_ = cachePath.Scan(job.FileName)
 	}
 
-	signBytes, err := hex.DecodeString(sign)
+	signBytes, err := hex.DecodeString(strings.TrimPrefix(job.Signature, "0x"))
 	if err != nil {
 		return errors.Wrap(err, "decoding sign")
 	}
 
-	hashBytes, err := hex.DecodeString(hash)
+	hashBytes, err := hex.DecodeString(strings.TrimPrefix(job.Hash, "0x"))
 	if err != nil {
 		return errors.Wrap(err, "decoding hash")
 	}
 
-	_, err = tx.Exec(
+	keyRef := &sql.NullString{}
+	if job.KeyRef != "" {
+		_ = keyRef.Scan(job.KeyRef)
+	}
+
+	path := &sql.NullString{}
+	var subCidBytes []byte
+	if job.SubCid != "" {
+		subCid, err := cid.Decode(job.SubCid)
+		if err != nil {
+			return errors.Wrap(err, "decoding sub cid")
+		}
+		subCidBytes = subCid.Bytes()
+		_ = path.Scan(job.Path)
+	}
+
+	var jobID int64
+	err = tx.QueryRow(
 		`insert into jobs (
-			ns_id, cid, relation, timestamp, cache_path, expires_at, signature, hash
+			ns_id, cid, relation, timestamp, cache_path, expires_at, signature, hash, car_size, piece_cid,
+			bucket, object, generation, schema, num_rows, num_row_groups, key_ref, path, sub_cid
 		) 
 		values (
-			$1, $2, $3, $4, $5, $6, $7, $8
-		)`,
-		nsID, cidBytes, pub.Relation, timestamp, cachePath, expiresAt, signBytes, hashBytes)
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19
+		)
+		returning id`,
+		nsID, cidBytes, pub.Relation, job.Timestamp, cachePath, expiresAt, signBytes, hashBytes,
+		job.CarSize, pieceCidBytes, job.Bucket, job.FileName, job.Generation,
+		job.Parquet.Schema, job.Parquet.NumRows, job.Parquet.NumRowGroups, keyRef,
+		path, subCidBytes).Scan(&jobID)
 	if err != nil {
 		return errors.Wrap(err, "updating record")
 	}
 
+	for _, shard := range job.Shards {
+		if err := createShardTx(tx, jobID, shard); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func createShardTx(tx *sql.Tx, jobID int64, shard ShardInfo) error {
+	shardCid, err := cid.Decode(shard.Cid)
+	if err != nil {
+		return errors.Wrap(err, "decoding shard cid")
+	}
+
+	var pieceCidBytes []byte
+	if shard.PieceCid != "" {
+		pieceCid, err := cid.Decode(shard.PieceCid)
+		if err != nil {
+			return errors.Wrap(err, "decoding shard piece cid")
+		}
+		pieceCidBytes = pieceCid.Bytes()
+	}
+
+	_, err = tx.Exec(
+		`insert into job_shards (job_id, idx, cid, byte_offset, size, car_size, piece_cid)
+		values ($1, $2, $3, $4, $5, $6, $7)`,
+		jobID, shard.Index, shardCid.Bytes(), shard.Offset, shard.Size, shard.CarSize, pieceCidBytes)
+	if err != nil {
+		return errors.Wrap(err, "inserting shard")
+	}
+
+	return nil
+}
+
+// ErrJobExists is returned by CreateJob when a job for the same object generation already exists.
+var ErrJobExists = errors.New("job already exists")
+
+// ErrNamespaceNotFound is returned by NamespaceOwner when the namespace does not exist.
+var ErrNamespaceNotFound = errors.New("namespace not found")
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// JobInfo holds the details of an uploaded file that are stored in a new job.
+type JobInfo struct {
+	Cid        string // Cid is the root CID returned by the deal provider.
+	Bucket     string // Bucket is the name of the bucket the file was uploaded from.
+	FileName   string // FileName is the name of the object in the bucket.
+	Generation int64  // Generation is the generation of the object that was uploaded.
+	Timestamp  *int64
+	// CacheDuration is the cache duration in minutes from the object metadata. When nil,
+	// the cache config of the relation, or else of the namespace, is used.
+	CacheDuration *int64
+	Signature     string
+	Hash          string
+	CarSize       int64  // CarSize is the length in bytes of the locally built CAR.
+	PieceCid      string // PieceCid is the piece commitment of the locally built CAR.
+	// Shards are the ordered parts of a sharded object. The Cid of a sharded job is
+	// the CID of its shard manifest.
+	Shards []ShardInfo
+	// Parquet describes the content of the object, as read from its Parquet footer.
+	Parquet ParquetInfo
+	// KeyRef is the reference of the key the archived files were encrypted with, empty if not encrypted.
+	KeyRef string
+	// Path and SubCid are the name and the CID of the file within its aggregate. The Cid of
+	// an aggregated job is the root CID of the aggregate. They are empty if not aggregated.
+	Path   string
+	SubCid string
+}
+
 // Crdb is an interface that defines the methods to interact with CockroachDB.
 type Crdb interface {
-	CreateJob(
-		ctx context.Context,
-		cidStr string,
-		fileName string,
-		timestamp *int64,
-		cacheDuration int64,
-		sign string,
-		hash string,
-	) error
+	CreateJob(ctx context.Context, job JobInfo) error
 	UnfinishedJobs(ctx context.Context) ([]UnfinishedJob, error)
-	UpdateJobStatus(ctx context.Context, cid []byte, activation time.Time) error
+	UpdateJobStatus(ctx context.Context, cid []byte, transition JobTransition) error
+	ClaimJobs(ctx context.Context, worker string, limit int, duration time.Duration) ([]UnfinishedJob, error)
+	RenewJobLease(ctx context.Context, worker string, cid []byte, duration time.Duration) error
+	ReleaseJobLease(ctx context.Context, worker string, cid []byte) error
+	UpsertDeals(ctx context.Context, jobCid []byte, partCid []byte, deals []Deal) error
+	PubDeals(ctx context.Context, pub Pub) ([]JobDeal, error)
+	RecordTx(ctx context.Context, jobCid []byte, tx OnchainTx) error
+	UpdateTx(ctx context.Context, tx OnchainTx) error
+	LatestTx(ctx context.Context, jobCid []byte) (*OnchainTx, error)
+	ProvisionNamespace(ctx context.Context, ns string, owner []byte) error
+	ProvisionPub(ctx context.Context, pub Pub) error
+	ProvisionedPub(ctx context.Context, pub Pub) (*ProvisionedPub, error)
+	UpdateProvisionedPub(ctx context.Context, p ProvisionedPub) error
+	RejectUpload(ctx context.Context, bucket string, fileName string, generation int64, hash string, reason string) error
+	RejectionExists(ctx context.Context, bucket string, fileName string, generation int64) (bool, error)
+	NamespaceOwner(ctx context.Context, ns string) ([]byte, error)
+	IsNamespaceOwner(ctx context.Context, owner []byte) (bool, error)
+	NamespaceKeyRef(ctx context.Context, ns string) (string, error)
+	SetNamespaceKeyRef(ctx context.Context, ns string, ref string) error
+	JobExists(ctx context.Context, bucket string, fileName string, generation int64) (bool, error)
+	JobExistsByHash(ctx context.Context, hash string) (bool, error)
+	FailedUpload(ctx context.Context, bucket string, fileName string) (*FailedUpload, error)
+	RecordFailedUpload(ctx context.Context, failure FailedUpload) error
+	ResolveFailedUpload(ctx context.Context, bucket string, fileName string) error
+	FailedUploadsDue(ctx context.Context, now time.Time, limit int) ([]FailedUpload, error)
+	CacheConfigs(ctx context.Context, ns string) ([]CacheConfig, error)
+	SetCacheConfig(ctx context.Context, config CacheConfig) error
+	DeleteCacheConfig(ctx context.Context, ns string, relation string) error
+	ExpiredJobs(ctx context.Context, now time.Time, limit int) ([]ExpiredJob, error)
+	ClearCachePath(ctx context.Context, jobID int64) error
+	MarkSourceDeleted(ctx context.Context, bucket string, fileName string, generation int64) (int64, error)
+	AddPendingAggregate(ctx context.Context, job JobInfo, size int64) error
+	PendingAggregates(ctx context.Context, limit int) ([]PendingAggregate, error)
+	DeletePendingAggregate(ctx context.Context, bucket string, fileName string, generation int64) error
+	CreateAggregate(ctx context.Context, jobs []JobInfo) error
 }
 
 // DBClient is a Crdb implementation.
@@ -87,13 +204,19 @@ type DBClient struct {
 	DB *sql.DB
 }
 
-// NewDB creates a new DBClient.
+// NewDB creates a new DBClient. It fails if the schema of the database is not
+// at the version of the embedded migrations.
 func NewDB(conn string) (*DBClient, error) {
 	db, err := sql.Open("postgres", conn)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := checkSchemaVersion(context.Background(), db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
 	return &DBClient{
 		DB: db,
 	}, nil
@@ -121,16 +244,17 @@ func extractPub(filename string) (Pub, error) {
 }
 
 // CreateJob creates a new job in the DB.
-func (db *DBClient) CreateJob(
-	ctx context.Context,
-	cidStr string,
-	fname string,
-	timestamp *int64,
-	cacheDuration int64,
-	sign string,
-	hash string,
-) error {
-	cid, err := cid.Decode(cidStr)
+func (db *DBClient) CreateJob(ctx context.Context, job JobInfo) error {
+	var pieceCidBytes []byte
+	if job.PieceCid != "" {
+		pieceCid, err := cid.Decode(job.PieceCid)
+		if err != nil {
+			return fmt.Errorf("failed to decode piece cid: %v", err)
+		}
+		pieceCidBytes = pieceCid.Bytes()
+	}
+
+	cid, err := cid.Decode(job.Cid)
 	if err != nil {
 		return fmt.Errorf("failed to decode cid: %v", err)
 	}
@@ -141,14 +265,18 @@ func (db *DBClient) CreateJob(
 	}
 
 	// Extract the schema and table name from the file name.
-	pub, err := extractPub(fname)
+	pub, err := extractPub(job.FileName)
 	if err != nil {
 		return fmt.Errorf("failed to extract table name: %v", err)
 	}
 
 	err = crdb.ExecuteTx(ctx, db.DB, txopts, func(tx *sql.Tx) error {
-		return createJobTx(tx, cid.Bytes(), pub, timestamp, fname, cacheDuration, sign, hash)
+		return createJobTx(tx, cid.Bytes(), pieceCidBytes, pub, job)
 	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrJobExists
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create new job: %v", err)
 	}
@@ -161,22 +289,34 @@ func (db *DBClient) CreateJob(
 type UnfinishedJob struct {
 	Pub       Pub
 	Cid       []byte
+	Shards    [][]byte // Shards are the CIDs of the shards of the job, in order.
+	Status    JobStatus
 	Activated time.Time
 	Timestamp *int64
 	CachePath string
 	ExpiresAt time.Time
 }
 
-// UnfinishedJobs returns all currently unfinished jobs in the db.
+// UnfinishedJobs returns all the jobs that are not indexed yet, whether they are leased or not.
+// Checkers claim the jobs they process with ClaimJobs.
 func (db *DBClient) UnfinishedJobs(ctx context.Context) ([]UnfinishedJob, error) {
+	return db.queryJobs(ctx, "jobs.status = ANY($1)", pq.Array(unfinishedStatusNames()))
+}
+
+// queryJobs returns the jobs that match the condition, with their shards.
+func (db *DBClient) queryJobs(ctx context.Context, condition string, args ...interface{}) ([]UnfinishedJob, error) {
 	query := `
-		SELECT namespaces.name, jobs.cid, jobs.relation, jobs.timestamp
-		FROM namespaces, jobs
-		WHERE namespaces.id = jobs.ns_id and activated is NULL
+		SELECT namespaces.name, jobs.cid, jobs.relation, jobs.timestamp, jobs.status,
+			array_remove(array_agg(job_shards.cid ORDER BY job_shards.idx), NULL)
+		FROM namespaces
+		JOIN jobs ON namespaces.id = jobs.ns_id
+		LEFT JOIN job_shards ON job_shards.job_id = jobs.id
+		WHERE ` + condition + `
+		GROUP BY jobs.id, namespaces.name, jobs.cid, jobs.relation, jobs.timestamp, jobs.status
 	`
-	rows, err := db.DB.QueryContext(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query unfinished jobs: %v", err)
+		return nil, fmt.Errorf("failed to query jobs: %v", err)
 	}
 
 	defer func() {
@@ -191,7 +331,9 @@ func (db *DBClient) UnfinishedJobs(ctx context.Context) ([]UnfinishedJob, error)
 		var nsName string
 		var relation string
 		var timestamp sql.NullInt64
-		if err := rows.Scan(&nsName, &cid, &relation, &timestamp); err != nil {
+		var status string
+		var shards pq.ByteaArray
+		if err := rows.Scan(&nsName, &cid, &relation, &timestamp, &status, &shards); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %v", err)
 		}
 		var t *int64
@@ -206,6 +348,8 @@ func (db *DBClient) UnfinishedJobs(ctx context.Context) ([]UnfinishedJob, error)
 				Relation:  relation,
 			},
 			Cid:       cid,
+			Shards:    shards,
+			Status:    JobStatus(status),
 			Timestamp: t,
 		})
 	}
@@ -213,15 +357,361 @@ func (db *DBClient) UnfinishedJobs(ctx context.Context) ([]UnfinishedJob, error)
 	return result, nil
 }
 
-// UpdateJobStatus updates the job status in the DB.
-func (db *DBClient) UpdateJobStatus(ctx context.Context, cid []byte, activation time.Time) error {
+// UpdateJobStatus moves the jobs with the CID to the status of the transition, and records
+// the transition. The jobs of an aggregate share its CID, they move together.
+// It returns ErrInvalidJobTransition if a job cannot move to the status from its current status.
+func (db *DBClient) UpdateJobStatus(ctx context.Context, cid []byte, t JobTransition) error {
+	activated := &sql.NullTime{}
+	if t.Status == JobDealsActive {
+		_ = activated.Scan(t.Activation)
+	}
+	reason := &sql.NullString{}
+	if t.Error != "" {
+		_ = reason.Scan(t.Error)
+	}
+
+	txopts := &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	err := crdb.ExecuteTx(ctx, db.DB, txopts, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id, status FROM jobs WHERE cid = $1 FOR UPDATE", cid)
+		if err != nil {
+			return errors.Wrap(err, "querying jobs")
+		}
+		from := map[int64]JobStatus{}
+		for rows.Next() {
+			var id int64
+			var status string
+			if err := rows.Scan(&id, &status); err != nil {
+				_ = rows.Close()
+				return errors.Wrap(err, "scanning job")
+			}
+			from[id] = JobStatus(status)
+		}
+		if err := rows.Close(); err != nil {
+			return errors.Wrap(err, "closing rows")
+		}
+		if len(from) == 0 {
+			return fmt.Errorf("job not found: %x", cid)
+		}
+		for _, status := range from {
+			if !status.CanTransition(t.Status) {
+				return fmt.Errorf("%w: from %s to %s", ErrInvalidJobTransition, status, t.Status)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE jobs SET status = $1, status_updated_at = now(), activated = COALESCE($2, activated)
+			WHERE cid = $3`,
+			t.Status, activated, cid); err != nil {
+			return errors.Wrap(err, "updating jobs")
+		}
+		for id, status := range from {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO job_transitions (job_id, from_status, to_status, error) VALUES ($1, $2, $3, $4)",
+				id, status, t.Status, reason); err != nil {
+				return errors.Wrap(err, "recording transition")
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrInvalidJobTransition) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %v", err)
+	}
+
+	return nil
+}
+
+// RejectUpload records an object generation that was refused by the uploader, e.g. because
+// its content does not match the hash in its metadata.
+func (db *DBClient) RejectUpload(
+	ctx context.Context,
+	bucket string,
+	fname string,
+	generation int64,
+	hash string,
+	reason string,
+) error {
 	_, err := db.DB.ExecContext(ctx,
-		"UPDATE jobs SET activated = $1 WHERE cid = $2",
-		activation, cid,
+		"INSERT INTO rejections (bucket, path, generation, hash, reason) VALUES ($1, $2, $3, $4, $5)",
+		bucket, fname, generation, hash, reason,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update job status: %v", err)
+		return fmt.Errorf("failed to record rejection: %v", err)
+	}
+
+	return nil
+}
+
+// RejectionExists tells whether the object generation was already refused by the uploader.
+func (db *DBClient) RejectionExists(ctx context.Context, bucket string, fname string, generation int64) (bool, error) {
+	var exists bool
+	row := db.DB.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM rejections WHERE bucket = $1 AND path = $2 AND generation = $3)",
+		bucket, fname, generation,
+	)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query rejection: %v", err)
+	}
+
+	return exists, nil
+}
+
+// NamespaceOwner returns the owner address of the namespace.
+// It returns ErrNamespaceNotFound if the namespace does not exist.
+func (db *DBClient) NamespaceOwner(ctx context.Context, ns string) ([]byte, error) {
+	var owner []byte
+	row := db.DB.QueryRowContext(ctx, "SELECT owner FROM namespaces WHERE name = $1", ns)
+	err := row.Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrNamespaceNotFound, ns)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query namespace owner: %v", err)
+	}
+
+	return owner, nil
+}
+
+// IsNamespaceOwner tells whether the address owns any namespace.
+func (db *DBClient) IsNamespaceOwner(ctx context.Context, owner []byte) (bool, error) {
+	var exists bool
+	row := db.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM namespaces WHERE owner = $1)", owner)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query namespace owner: %v", err)
+	}
+
+	return exists, nil
+}
+
+// NamespaceKeyRef returns the reference of the encryption key of the namespace,
+// or an empty string if the namespace does not encrypt its files.
+func (db *DBClient) NamespaceKeyRef(ctx context.Context, ns string) (string, error) {
+	var ref sql.NullString
+	row := db.DB.QueryRowContext(ctx, "SELECT encryption_key_ref FROM namespaces WHERE name = $1", ns)
+	if err := row.Scan(&ref); err != nil {
+		return "", fmt.Errorf("failed to query namespace key ref: %v", err)
+	}
+
+	return ref.String, nil
+}
+
+// SetNamespaceKeyRef sets the reference of the encryption key of the namespace.
+// An empty reference disables the encryption of the namespace.
+func (db *DBClient) SetNamespaceKeyRef(ctx context.Context, ns string, ref string) error {
+	keyRef := &sql.NullString{}
+	if ref != "" {
+		_ = keyRef.Scan(ref)
+	}
+
+	res, err := db.DB.ExecContext(ctx, "UPDATE namespaces SET encryption_key_ref = $1 WHERE name = $2", keyRef, ns)
+	if err != nil {
+		return fmt.Errorf("failed to set namespace key ref: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("namespace not found: %s", ns)
+	}
+
+	return nil
+}
+
+// JobExists returns true if a job was already created for the object generation.
+func (db *DBClient) JobExists(ctx context.Context, bucket string, fname string, generation int64) (bool, error) {
+	var exists bool
+	row := db.DB.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM jobs WHERE bucket = $1 AND object = $2 AND generation = $3)",
+		bucket, fname, generation,
+	)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query job: %v", err)
+	}
+
+	return exists, nil
+}
+
+// JobExistsByHash tells whether a job archived content with the hash, whatever its object.
+func (db *DBClient) JobExistsByHash(ctx context.Context, hash string) (bool, error) {
+	hashBytes, err := hex.DecodeString(strings.TrimPrefix(hash, "0x"))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode hash: %v", err)
+	}
+
+	var exists bool
+	row := db.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM jobs WHERE hash = $1)", hashBytes)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query job: %v", err)
+	}
+
+	return exists, nil
+}
+
+// FailedUpload returns the failed upload of the object, or nil if its last upload did not fail.
+func (db *DBClient) FailedUpload(ctx context.Context, bucket string, fname string) (*FailedUpload, error) {
+	var f FailedUpload
+	row := db.DB.QueryRowContext(ctx,
+		`SELECT bucket, object, stage, error, attempts, permanent, next_attempt_at
+		FROM failed_uploads WHERE bucket = $1 AND object = $2`,
+		bucket, fname,
+	)
+	err := row.Scan(&f.Bucket, &f.Object, &f.Stage, &f.Error, &f.Attempts, &f.Permanent, &f.NextAttemptAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed upload: %v", err)
+	}
+
+	return &f, nil
+}
+
+// RecordFailedUpload inserts or replaces the failed upload of an object.
+func (db *DBClient) RecordFailedUpload(ctx context.Context, f FailedUpload) error {
+	_, err := db.DB.ExecContext(ctx,
+		`UPSERT INTO failed_uploads (bucket, object, stage, error, attempts, permanent, next_attempt_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now())`,
+		f.Bucket, f.Object, f.Stage, f.Error, f.Attempts, f.Permanent, f.NextAttemptAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record failed upload: %v", err)
+	}
+
+	return nil
+}
+
+// ResolveFailedUpload removes the failed upload of an object, after it was uploaded.
+func (db *DBClient) ResolveFailedUpload(ctx context.Context, bucket string, fname string) error {
+	_, err := db.DB.ExecContext(ctx,
+		"DELETE FROM failed_uploads WHERE bucket = $1 AND object = $2",
+		bucket, fname,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resolve failed upload: %v", err)
+	}
+
+	return nil
+}
+
+// FailedUploadsDue returns the failed uploads that are not permanent and due for a retry.
+func (db *DBClient) FailedUploadsDue(ctx context.Context, now time.Time, limit int) ([]FailedUpload, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		`SELECT bucket, object, stage, error, attempts, permanent, next_attempt_at
+		FROM failed_uploads
+		WHERE NOT permanent AND next_attempt_at <= $1
+		ORDER BY next_attempt_at
+		LIMIT $2`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed uploads: %v", err)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Fatalf("error when closing crdb connection: %v", err)
+		}
+	}()
+
+	var result []FailedUpload
+	for rows.Next() {
+		var f FailedUpload
+		err := rows.Scan(&f.Bucket, &f.Object, &f.Stage, &f.Error, &f.Attempts, &f.Permanent, &f.NextAttemptAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+// ExpiredJobs returns the jobs with a cached object whose cache expired.
+func (db *DBClient) ExpiredJobs(ctx context.Context, now time.Time, limit int) ([]ExpiredJob, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		`SELECT id, bucket, cache_path, generation, expires_at
+		FROM jobs
+		WHERE cache_path IS NOT NULL AND expires_at <= $1
+		ORDER BY expires_at
+		LIMIT $2`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired jobs: %v", err)
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Fatalf("error when closing crdb connection: %v", err)
+		}
+	}()
+
+	var result []ExpiredJob
+	for rows.Next() {
+		var j ExpiredJob
+		var bucket sql.NullString
+		var generation sql.NullInt64
+		if err := rows.Scan(&j.ID, &bucket, &j.CachePath, &generation, &j.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		j.Bucket, j.Generation = bucket.String, generation.Int64
+		result = append(result, j)
+	}
+
+	return result, nil
+}
+
+// ClearCachePath removes the cache path of a job, after its cached object was deleted.
+func (db *DBClient) ClearCachePath(ctx context.Context, jobID int64) error {
+	_, err := db.DB.ExecContext(ctx, "UPDATE jobs SET cache_path = NULL WHERE id = $1", jobID)
+	if err != nil {
+		return fmt.Errorf("failed to clear cache path: %v", err)
 	}
 
 	return nil
 }
+
+// MarkSourceDeleted marks the jobs of an object generation as source deleted, and clears
+// their cache fields, the object is not in the bucket anymore. Pending aggregates of the
+// generation are removed. A zero generation matches every generation of the object.
+// It returns the number of jobs that were marked.
+func (db *DBClient) MarkSourceDeleted(
+	ctx context.Context,
+	bucket string,
+	fname string,
+	generation int64,
+) (int64, error) {
+	txopts := &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+
+	var marked int64
+	err := crdb.ExecuteTx(ctx, db.DB, txopts, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE jobs SET source_deleted_at = now(), cache_path = NULL, expires_at = NULL
+			WHERE bucket = $1 AND object = $2 AND ($3 = 0 OR generation = $3) AND source_deleted_at IS NULL`,
+			bucket, fname, generation,
+		)
+		if err != nil {
+			return errors.Wrap(err, "updating jobs")
+		}
+		if marked, err = res.RowsAffected(); err != nil {
+			return errors.Wrap(err, "reading affected jobs")
+		}
+
+		_, err = tx.Exec(
+			`DELETE FROM aggregate_pending
+			WHERE bucket = $1 AND object = $2 AND ($3 = 0 OR generation = $3)`,
+			bucket, fname, generation,
+		)
+		return errors.Wrap(err, "deleting pending aggregates")
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark source deleted: %v", err)
+	}
+
+	return marked, nil
+}
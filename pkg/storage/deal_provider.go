@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// DealProvider defines the interface for archiving files on Filecoin and tracking their deals.
+type DealProvider interface {
+	// Put uploads a file and returns its root CID.
+	Put(ctx context.Context, file fs.File) (cid.Cid, error)
+	// Status returns the status of the content with the given root CID, including its deals.
+	Status(ctx context.Context, c cid.Cid) (*ContentStatus, error)
+	// Deals returns the Filecoin deals of the content with the given root CID.
+	Deals(ctx context.Context, c cid.Cid) ([]Deal, error)
+}
+
+// DealStatus is the status of a Filecoin deal.
+type DealStatus int
+
+const (
+	// DealStatusQueued means the content is waiting to be included in a deal.
+	DealStatusQueued DealStatus = iota
+	// DealStatusPublished means the deal was published on chain but is not active yet.
+	DealStatusPublished
+	// DealStatusActive means the deal is active on chain.
+	DealStatusActive
+)
+
+func (s DealStatus) String() string {
+	switch s {
+	case DealStatusQueued:
+		return "Queued"
+	case DealStatusPublished:
+		return "Published"
+	case DealStatusActive:
+		return "Active"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParseDealStatus parses the name of a deal status.
+func ParseDealStatus(s string) (DealStatus, error) {
+	switch s {
+	case "Queued":
+		return DealStatusQueued, nil
+	case "Published":
+		return DealStatusPublished, nil
+	case "Active":
+		return DealStatusActive, nil
+	default:
+		return 0, fmt.Errorf("unknown deal status: %s", s)
+	}
+}
+
+// Deal represents a Filecoin deal that includes the content.
+type Deal struct {
+	DealID            uint64
+	StorageProvider   string
+	Status            DealStatus
+	PieceCid          cid.Cid
+	DataCid           cid.Cid
+	DataModelSelector string
+	Activation        time.Time
+	Expiration        time.Time // Expiration is the end of the deal, zero if the provider does not report it.
+	Created           time.Time
+	Updated           time.Time
+}
+
+// ContentStatus is the status of content stored with a deal provider.
+type ContentStatus struct {
+	Cid     cid.Cid
+	DagSize uint64
+	Created time.Time
+	Deals   []Deal
+}
+
+// The supported deal providers.
+const (
+	DealProviderW3S   = "w3s"
+	DealProviderHTTP  = "http"
+	DealProviderLocal = "local"
+)
+
+// DealProviderConfig defines the configuration for choosing and initializing a DealProvider.
+type DealProviderConfig struct {
+	// Provider is one of "w3s", "http" or "local". Defaults to "w3s".
+	Provider string
+
+	// W3SToken is the web3.storage API token.
+	W3SToken string
+
+	// HTTPEndpoint is the base URL of the service of the http provider.
+	HTTPEndpoint string
+	// HTTPToken is the bearer token for the service of the http provider.
+	HTTPToken string
+
+	// LocalDir is the directory where the local provider stores CAR files.
+	LocalDir string
+}
+
+// NewDealProvider creates the DealProvider selected by the config.
+func NewDealProvider(cfg DealProviderConfig) (DealProvider, error) {
+	switch cfg.Provider {
+	case "", DealProviderW3S:
+		return NewW3SProvider(cfg.W3SToken)
+	case DealProviderHTTP:
+		return NewHTTPProvider(cfg.HTTPEndpoint, cfg.HTTPToken)
+	case DealProviderLocal:
+		return NewLocalProvider(cfg.LocalDir)
+	default:
+		return nil, fmt.Errorf("unsupported deal provider: %s", cfg.Provider)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestW3SProvider returns a W3SProvider that uploads files to the /car endpoint served by
+// the mock client, which records them, and reads their status from the mock client.
+func newTestW3SProvider(t *testing.T, client *mockW3sClient) *W3SProvider {
+	srv := httptest.NewServer(client)
+	t.Cleanup(srv.Close)
+	return &W3SProvider{Client: client, Endpoint: srv.URL, Token: "token"}
+}
+
+func newMockFile(data []byte, name string) *IntermediateFile {
+	return NewIntermediateFile(&MockReadCloser{Reader: bytes.NewReader(data)}, name, int64(len(data)))
+}
+
+func TestNewDealProvider(t *testing.T) {
+	p, err := NewDealProvider(DealProviderConfig{W3SToken: "token"})
+	require.NoError(t, err)
+	assert.IsType(t, &W3SProvider{}, p)
+
+	p, err = NewDealProvider(DealProviderConfig{Provider: DealProviderHTTP, HTTPEndpoint: "http://localhost"})
+	require.NoError(t, err)
+	assert.IsType(t, &HTTPProvider{}, p)
+
+	p, err = NewDealProvider(DealProviderConfig{Provider: DealProviderLocal, LocalDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &LocalProvider{}, p)
+
+	_, err = NewDealProvider(DealProviderConfig{Provider: "estuary"})
+	assert.Error(t, err)
+}
+
+func TestLocalProvider(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewLocalProvider(t.TempDir())
+	require.NoError(t, err)
+
+	root, err := p.Put(ctx, newMockFile(mockData(), "hello.txt"))
+	require.NoError(t, err)
+
+	expected, err := writeCAR(ctx, newMockFile(mockData(), "hello.txt"), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, expected, root)
+
+	status, err := p.Status(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, root, status.Cid)
+	require.Equal(t, 1, len(status.Deals))
+	assert.Equal(t, DealStatusActive, status.Deals[0].Status)
+	assert.Equal(t, root, status.Deals[0].DataCid)
+
+	_, err = p.Status(ctx, getCIDFromBytes([]byte("unknown")))
+	assert.Error(t, err)
+}
+
+func TestHTTPProvider(t *testing.T) {
+	ctx := context.Background()
+	activation := time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	var stored []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/car", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/vnd.ipld.car", r.Header.Get("Content-Type"))
+		cr, err := car.NewCarReader(r.Body)
+		require.NoError(t, err)
+		stored = append(stored, cr.Header.Roots[0].String())
+		_, _ = fmt.Fprintf(w, `{"cid": "%s"}`, cr.Header.Roots[0])
+	})
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if len(stored) == 0 || r.URL.Path != "/status/"+stored[0] {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"cid": "%s", "dagSize": 42, "created": "2023-09-30T00:00:00Z", "deals": [
+			{"dealId": 7, "storageProvider": "f01234", "status": "Active", "dataCid": "%s",
+			 "activation": "2023-10-01T00:00:00Z", "expiration": "2025-03-24T00:00:00Z",
+			 "created": "2023-09-30T00:00:00Z", "updated": "2023-10-01T00:00:00Z"},
+			{"status": "Queued", "created": "2023-09-30T00:00:00Z", "updated": "2023-09-30T00:00:00Z"}
+		]}`, stored[0], stored[0])
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p, err := NewHTTPProvider(srv.URL+"/", "token")
+	require.NoError(t, err)
+
+	// unknown content has no deals, and no status
+	deals, err := p.Deals(ctx, getCIDFromBytes(mockData()))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(deals))
+	_, err = p.Status(ctx, getCIDFromBytes(mockData()))
+	assert.ErrorContains(t, err, "content not found")
+
+	root, err := p.Put(ctx, newMockFile(mockData(), "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{root.String()}, stored)
+
+	status, err := p.Status(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, root, status.Cid)
+	assert.Equal(t, uint64(42), status.DagSize)
+	assert.Equal(t, time.Date(2023, time.September, 30, 0, 0, 0, 0, time.UTC), status.Created)
+	require.Equal(t, 2, len(status.Deals))
+	assert.Equal(t, uint64(7), status.Deals[0].DealID)
+	assert.Equal(t, "f01234", status.Deals[0].StorageProvider)
+	assert.Equal(t, DealStatusActive, status.Deals[0].Status)
+	assert.Equal(t, root, status.Deals[0].DataCid)
+	assert.Equal(t, activation, status.Deals[0].Activation)
+	assert.Equal(t, time.Date(2025, time.March, 24, 0, 0, 0, 0, time.UTC), status.Deals[0].Expiration)
+	assert.Equal(t, DealStatusQueued, status.Deals[1].Status)
+	assert.True(t, status.Deals[1].Expiration.IsZero())
+	assert.Equal(t, cid.Undef, status.Deals[1].PieceCid)
+
+	deals, err = p.Deals(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, status.Deals, deals)
+}
+
+func TestW3SProvider(t *testing.T) {
+	ctx := context.Background()
+	var received int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// each part of the CAR has the root of the DAG in its header
+		br := bufio.NewReader(r.Body)
+		header, err := car.ReadHeader(br)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, _ := io.Copy(io.Discard, br)
+		atomic.AddInt64(&received, n)
+		_ = json.NewEncoder(w).Encode(map[string]string{"cid": header.Roots[0].String()})
+	}))
+	defer srv.Close()
+
+	p, err := NewW3SProvider("token")
+	require.NoError(t, err)
+	p.Endpoint = srv.URL
+
+	root, err := p.Put(ctx, newMockFile(mockData(), "hello.txt"))
+	require.NoError(t, err)
+	localCAR, err := buildCAR(ctx, newMockFile(mockData(), "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, localCAR.Root, root)
+
+	if testing.Short() {
+		return
+	}
+
+	// the DAG of a large file is not held in memory while it is uploaded, nor after,
+	// only a part of its CAR is
+	p.carSize = 1 << 20
+	size := int64(64 << 20)
+	for i := 0; i < 2; i++ {
+		growth := peakHeapGrowth(func() {
+			_, err := p.Put(ctx, randomFile("random.bin", size))
+			require.NoError(t, err)
+		})
+		assert.Less(t, growth, uint64(size/4))
+	}
+	assert.Greater(t, atomic.LoadInt64(&received), 2*size)
+}
+
+func TestW3SProviderMockCar(t *testing.T) {
+	ctx := context.Background()
+	client := &mockW3sClient{}
+	p := newTestW3SProvider(t, client)
+
+	// the parts of a CAR are recorded as a file once its DAG is complete
+	p.carSize = 1 << 20
+	data, err := io.ReadAll(randomFile("random.bin", 3<<20))
+	require.NoError(t, err)
+	root, err := p.Put(ctx, newMockFile(data, "random.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, getRootFromBytes(data, "random.bin"), root)
+	require.Len(t, client.Files, 1)
+	assert.Equal(t, "random.bin", client.Files[0].Name)
+	assert.Equal(t, data, client.Files[0].Data)
+
+	// without a token, files are not uploaded
+	p.Token = ""
+	_, err = p.Put(ctx, newMockFile(data, "random.bin"))
+	require.Error(t, err)
+	assert.Len(t, client.Files, 1)
+}
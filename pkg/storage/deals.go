@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+)
+
+// JobDeal is a Filecoin deal of a file of a job, as last reported by the deal provider.
+type JobDeal struct {
+	Deal
+	JobID int64
+	Pub   Pub
+	// PartCid is the CID of the file of the job the deal stores: the CID of the job, or of one of its shards.
+	PartCid   cid.Cid
+	FirstSeen time.Time // FirstSeen is when the deal was first reported by the deal provider.
+	LastSeen  time.Time // LastSeen is when the deal was last reported by the deal provider.
+}
+
+// UpsertDeals records the deals reported by the deal provider for a file of the jobs with the CID.
+// The file is the job itself, or one of its shards. Deals that were recorded already are updated,
+// deals that are not reported anymore are kept, the deals of a job make up its deal history.
+func (db *DBClient) UpsertDeals(ctx context.Context, jobCid []byte, partCid []byte, deals []Deal) error {
+	txopts := &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+		ReadOnly:  false,
+	}
+	err := crdb.ExecuteTx(ctx, db.DB, txopts, func(tx *sql.Tx) error {
+		for _, d := range deals {
+			// first_seen_at is left out, it keeps the value of the deals recorded already
+			_, err := tx.ExecContext(ctx,
+				`UPSERT INTO deals (
+					job_id, part_cid, deal_id, storage_provider, status, piece_cid, data_cid,
+					data_model_selector, activation, expiration, created, updated, last_seen_at
+				)
+				SELECT id, $2::BYTEA, $3::BIGINT, $4::TEXT, $5::TEXT, $6::BYTEA, $7::BYTEA, $8::TEXT,
+					$9::TIMESTAMP, $10::TIMESTAMP, $11::TIMESTAMP, $12::TIMESTAMP, now()
+				FROM jobs WHERE cid = $1`,
+				jobCid, partCid, int64(d.DealID), d.StorageProvider, d.Status.String(),
+				cidBytes(d.PieceCid), cidBytes(d.DataCid), d.DataModelSelector,
+				nullTime(d.Activation), nullTime(d.Expiration), nullTime(d.Created), nullTime(d.Updated))
+			if err != nil {
+				return errors.Wrap(err, "upserting deal")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upsert deals: %v", err)
+	}
+
+	return nil
+}
+
+// PubDeals returns the deals of the jobs of a pub, by job. It tells which storage
+// providers hold the data of the pub, and until when.
+func (db *DBClient) PubDeals(ctx context.Context, pub Pub) ([]JobDeal, error) {
+	rows, err := db.DB.QueryContext(ctx,
+		`SELECT deals.job_id, deals.part_cid, deals.deal_id, deals.storage_provider, deals.status,
+			deals.piece_cid, deals.data_cid, deals.data_model_selector, deals.activation, deals.expiration,
+			deals.created, deals.updated, deals.first_seen_at, deals.last_seen_at
+		FROM deals
+		JOIN jobs ON jobs.id = deals.job_id
+		JOIN namespaces ON namespaces.id = jobs.ns_id
+		WHERE namespaces.name = $1 AND jobs.relation = $2
+		ORDER BY deals.job_id, deals.part_cid, deals.first_seen_at, deals.storage_provider, deals.deal_id`,
+		pub.Namespace, pub.Relation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deals: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Fatalf("error when closing crdb connection: %v", err)
+		}
+	}()
+
+	var deals []JobDeal
+	for rows.Next() {
+		var d JobDeal
+		var partCid, pieceCid, dataCid []byte
+		var dealID int64
+		var status string
+		var selector sql.NullString
+		var activation, expiration, created, updated sql.NullTime
+		if err := rows.Scan(&d.JobID, &partCid, &dealID, &d.StorageProvider, &status,
+			&pieceCid, &dataCid, &selector, &activation, &expiration,
+			&created, &updated, &d.FirstSeen, &d.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan deal: %v", err)
+		}
+		if d.Status, err = ParseDealStatus(status); err != nil {
+			return nil, err
+		}
+		if d.PartCid, err = castCid(partCid); err != nil {
+			return nil, err
+		}
+		if d.PieceCid, err = castCid(pieceCid); err != nil {
+			return nil, err
+		}
+		if d.DataCid, err = castCid(dataCid); err != nil {
+			return nil, err
+		}
+		d.Pub = pub
+		d.DealID = uint64(dealID)
+		d.DataModelSelector = selector.String
+		d.Activation = activation.Time
+		d.Expiration = expiration.Time
+		d.Created = created.Time
+		d.Updated = updated.Time
+		deals = append(deals, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deals: %v", err)
+	}
+
+	return deals, nil
+}
+
+// nullTime returns a NULL time for the zero time.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// cidBytes returns the bytes of the CID, or nil if it is undefined.
+func cidBytes(c cid.Cid) []byte {
+	if !c.Defined() {
+		return nil
+	}
+	return c.Bytes()
+}
+
+// castCid reads a CID from its bytes, an empty value is an undefined CID.
+func castCid(b []byte) (cid.Cid, error) {
+	if len(b) == 0 {
+		return cid.Undef, nil
+	}
+	c, err := cid.Cast(b)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to cast cid: %v", err)
+	}
+	return c, nil
+}
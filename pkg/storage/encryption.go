@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encrypted files are made of a header followed by chunks sealed with AES-256-GCM.
+//
+// The header holds a magic string, the format version, the chunk size and a random salt.
+// The chunk key is derived from the namespace key and the salt with HKDF-SHA256, so every
+// file is encrypted with its own key. The nonce of a chunk is its index, followed by a flag
+// set on the last chunk only, so chunks cannot be reordered, dropped or truncated unnoticed.
+// Every chunk is authenticated along with the header.
+const (
+	encryptionMagic   = "BASINENC"
+	encryptionVersion = 1
+	encryptionSaltLen = 16
+
+	// encryptionChunkSize is the size of the plaintext sealed in each chunk.
+	encryptionChunkSize = 64 * 1024
+
+	encryptionHeaderLen = len(encryptionMagic) + 1 + 4 + encryptionSaltLen
+	encryptionKeyLen    = 32
+	encryptionInfo      = "basin-storage encryption v1"
+
+	// encryptedSuffix is appended to the name of encrypted files.
+	encryptedSuffix = ".enc"
+)
+
+// KeyProvider resolves the key references stored in the DB to encryption keys.
+// Only references are stored in the DB, never the keys.
+type KeyProvider interface {
+	Key(ctx context.Context, ref string) ([]byte, error)
+}
+
+// KeyRing is a KeyProvider that holds the keys in memory, by reference.
+type KeyRing map[string][]byte
+
+// ParseKeyRing parses a comma separated list of ref=hexkey pairs. Keys are 32 bytes long.
+// An empty string is an empty key ring.
+func ParseKeyRing(s string) (KeyRing, error) {
+	keys := KeyRing{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ref, value, ok := strings.Cut(pair, "=")
+		if !ok || ref == "" {
+			return nil, fmt.Errorf("invalid key ring entry, expected ref=hexkey")
+		}
+		key, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %s: %v", ref, err)
+		}
+		if len(key) != encryptionKeyLen {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", ref, encryptionKeyLen, len(key))
+		}
+		keys[ref] = key
+	}
+	return keys, nil
+}
+
+// Key returns the key of the reference.
+func (k KeyRing) Key(_ context.Context, ref string) ([]byte, error) {
+	key, ok := k[ref]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key: %s", ref)
+	}
+	return key, nil
+}
+
+// EncryptedSize returns the size of a file of the given plaintext size once encrypted.
+func EncryptedSize(size int64) int64 {
+	chunks := (size + encryptionChunkSize - 1) / encryptionChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(encryptionHeaderLen) + size + chunks*aes.BlockSize
+}
+
+// encryption is the key a namespace encrypts its files with.
+type encryption struct {
+	Ref string
+	Key []byte
+}
+
+// ref returns the key reference of the encryption, or an empty string without encryption.
+func (e *encryption) ref() string {
+	if e == nil {
+		return ""
+	}
+	return e.Ref
+}
+
+// name returns the name of the archived file.
+func (e *encryption) name(name string) string {
+	if e == nil {
+		return name
+	}
+	return name + encryptedSuffix
+}
+
+// newSalt returns a random salt, a new one must be used for every file.
+func newSalt() ([]byte, error) {
+	salt := make([]byte, encryptionSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return salt, nil
+}
+
+// newChunkCipher derives the chunk key of a file from the key and the salt.
+func newChunkCipher(key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeyLen {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptionKeyLen, len(key))
+	}
+	chunkKey := make([]byte, encryptionKeyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(encryptionInfo)), chunkKey); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(chunkKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(nonce []byte, index uint64, last bool) {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+}
+
+// chunkReader reads the input in chunks of size bytes, and tells whether a chunk is the last one.
+type chunkReader struct {
+	r    io.Reader
+	buf  []byte
+	next []byte // next is the byte read ahead of the current chunk, if any.
+	err  error
+}
+
+func (c *chunkReader) read(size int) ([]byte, bool, error) {
+	if c.err != nil {
+		return nil, false, c.err
+	}
+	buf := append(c.buf[:0], c.next...)
+	n, err := io.ReadFull(c.r, buf[len(buf):size])
+	buf = buf[:len(buf)+n]
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.err = io.EOF
+		return buf, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// read one byte ahead, to know if this chunk is the last one
+	c.next = c.next[:1]
+	n, err = io.ReadFull(c.r, c.next)
+	c.next = c.next[:n]
+	if err == io.EOF {
+		c.err = io.EOF
+		return buf, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, false, nil
+}
+
+func newChunkReader(r io.Reader, size int) *chunkReader {
+	return &chunkReader{r: r, buf: make([]byte, 0, size), next: make([]byte, 0, 1)}
+}
+
+// encryptReader encrypts the plaintext it reads from its source.
+type encryptReader struct {
+	aead   cipher.AEAD
+	header []byte
+	chunks *chunkReader
+	nonce  []byte
+	index  uint64
+	out    []byte
+	done   bool
+}
+
+// newEncryptReader returns a reader of the encryption of r with the key.
+// The same key, salt and plaintext always produce the same ciphertext.
+func newEncryptReader(r io.Reader, key []byte, salt []byte) (io.Reader, error) {
+	aead, err := newChunkCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, encryptionHeaderLen)
+	header = append(header, encryptionMagic...)
+	header = append(header, encryptionVersion)
+	header = binary.BigEndian.AppendUint32(header, encryptionChunkSize)
+	header = append(header, salt...)
+
+	return &encryptReader{
+		aead:   aead,
+		header: header,
+		chunks: newChunkReader(r, encryptionChunkSize),
+		nonce:  make([]byte, aead.NonceSize()),
+		out:    append([]byte{}, header...),
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		plaintext, last, err := e.chunks.read(encryptionChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		chunkNonce(e.nonce, e.index, last)
+		e.out = e.aead.Seal(e.out[:0], e.nonce, plaintext, e.header)
+		e.index++
+		e.done = last
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptReader decrypts the ciphertext it reads from its source.
+type decryptReader struct {
+	aead      cipher.AEAD
+	header    []byte
+	chunks    *chunkReader
+	chunkSize int
+	nonce     []byte
+	index     uint64
+	out       []byte
+	done      bool
+}
+
+// NewDecryptReader returns a reader of the plaintext of a file encrypted by the uploader.
+// The whole file is authenticated chunk by chunk, a chunk is only returned once it
+// has been authenticated, and a truncated or tampered file is an error.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, encryptionHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	if !bytes.Equal(header[:len(encryptionMagic)], []byte(encryptionMagic)) {
+		return nil, errors.New("not an encrypted file")
+	}
+	if version := header[len(encryptionMagic)]; version != encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version: %d", version)
+	}
+	chunkSize := binary.BigEndian.Uint32(header[len(encryptionMagic)+1:])
+	if chunkSize == 0 || chunkSize > 64*encryptionChunkSize {
+		return nil, fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+	salt := header[len(encryptionMagic)+5:]
+
+	aead, err := newChunkCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int(chunkSize) + aead.Overhead()
+	return &decryptReader{
+		aead:      aead,
+		header:    header,
+		chunks:    newChunkReader(r, size),
+		chunkSize: size,
+		nonce:     make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		ciphertext, last, err := d.chunks.read(d.chunkSize)
+		if err != nil {
+			return 0, err
+		}
+		chunkNonce(d.nonce, d.index, last)
+		d.out, err = d.aead.Open(d.out[:0], d.nonce, ciphertext, d.header)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt chunk %d: %v", d.index, err)
+		}
+		d.index++
+		d.done = last
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// Decrypt writes the plaintext of a file encrypted by the uploader to w.
+// Owners can use it to read back their archives with the key of their namespace.
+func Decrypt(w io.Writer, r io.Reader, key []byte) error {
+	reader, err := NewDecryptReader(r, key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return err
+	}
+	return nil
+}
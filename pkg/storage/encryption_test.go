@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tablelandnetwork/basin-storage/mocks"
+)
+
+func testEncryptionKey() []byte {
+	return bytes.Repeat([]byte{0x42}, encryptionKeyLen)
+}
+
+func encrypt(t *testing.T, plaintext, key, salt []byte) []byte {
+	reader, err := newEncryptReader(bytes.NewReader(plaintext), key, salt)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return ciphertext
+}
+
+func TestEncryption(t *testing.T) {
+	key := testEncryptionKey()
+	salt, err := newSalt()
+	require.NoError(t, err)
+
+	for _, size := range []int{
+		0, 1, encryptionChunkSize - 1, encryptionChunkSize, encryptionChunkSize + 1, 3*encryptionChunkSize + 5,
+	} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext := encrypt(t, plaintext, key, salt)
+		assert.Equal(t, EncryptedSize(int64(size)), int64(len(ciphertext)), "size %d", size)
+		assert.Equal(t, ciphertext, encrypt(t, plaintext, key, salt), "encryption is deterministic for a salt")
+
+		var decrypted bytes.Buffer
+		require.NoError(t, Decrypt(&decrypted, bytes.NewReader(ciphertext), key), "size %d", size)
+		assert.Equal(t, plaintext, decrypted.Bytes(), "size %d", size)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := testEncryptionKey()
+	salt, err := newSalt()
+	require.NoError(t, err)
+	plaintext := bytes.Repeat([]byte("hello world"), encryptionChunkSize/4)
+	ciphertext := encrypt(t, plaintext, key, salt)
+	chunk := encryptionChunkSize + 16
+
+	header, body := ciphertext[:encryptionHeaderLen], ciphertext[encryptionHeaderLen:]
+	flipped := bytes.Clone(ciphertext)
+	flipped[100] ^= 1
+	differentSalt := bytes.Clone(ciphertext)
+	differentSalt[encryptionHeaderLen-1] ^= 1
+	reordered := append(bytes.Clone(header), body[chunk:2*chunk]...)
+	reordered = append(reordered, body[chunk:]...)
+
+	tests := map[string][]byte{
+		"flipped":         flipped,
+		"truncated":       ciphertext[:len(ciphertext)-1],
+		"dropped chunk":   ciphertext[:encryptionHeaderLen+chunk],
+		"appended":        append(append([]byte{}, ciphertext...), 0),
+		"header only":     ciphertext[:encryptionHeaderLen],
+		"different salt":  differentSalt,
+		"not encrypted":   plaintext,
+		"short header":    ciphertext[:4],
+		"reordered chunk": reordered,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, Decrypt(io.Discard, bytes.NewReader(data), key))
+		})
+	}
+
+	wrongKey := bytes.Repeat([]byte{0x43}, encryptionKeyLen)
+	assert.Error(t, Decrypt(io.Discard, bytes.NewReader(ciphertext), wrongKey))
+}
+
+func TestParseKeyRing(t *testing.T) {
+	keys, err := ParseKeyRing("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	hexKey := "4242424242424242424242424242424242424242424242424242424242424242"
+	keys, err = ParseKeyRing("ns1=" + hexKey + ", ns2=0x" + hexKey)
+	require.NoError(t, err)
+	key, err := keys.Key(context.Background(), "ns2")
+	require.NoError(t, err)
+	assert.Equal(t, testEncryptionKey(), key)
+	_, err = keys.Key(context.Background(), "ns3")
+	assert.Error(t, err)
+
+	for _, s := range []string{"ns1", "=" + hexKey, "ns1=xyz", "ns1=abcd"} {
+		_, err := ParseKeyRing(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestUploaderEncrypted(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	require.NoError(t, db.SetNamespaceKeyRef(ctx, "foo.bar.baz", "foo-key"))
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+		Keys:          KeyRing{"foo-key": testEncryptionKey()},
+	}
+
+	require.NoError(t, uploader.Upload(ctx))
+	mockStore.AssertExpectations(t)
+
+	// only the ciphertext is sent to the deal client
+	files := uploader.DealClient.(*W3SProvider).Client.(*mockW3sClient).Files
+	require.Equal(t, 1, len(files))
+	assert.Equal(t, fname+".enc", files[0].Name)
+	assert.Equal(t, EncryptedSize(int64(len(mockParquet()))), files[0].Size)
+	assert.NotContains(t, string(files[0].Data), "PAR1")
+
+	var decrypted bytes.Buffer
+	require.NoError(t, Decrypt(&decrypted, bytes.NewReader(files[0].Data), testEncryptionKey()))
+	assert.Equal(t, mockParquet(), decrypted.Bytes())
+
+	// the job references the key, the hash is still the hash of the plaintext
+	created := createdJobs(db)
+	require.Equal(t, 1, len(created))
+	assert.Equal(t, "foo-key", created[0].KeyRef)
+	assert.Equal(t, hash, created[0].Hash)
+}
+
+func TestUploaderEncryptedMissingKey(t *testing.T) {
+	ctx := context.Background()
+	db := newTestMemDB(t, "foo.bar.baz", "other")
+	require.NoError(t, db.SetNamespaceKeyRef(ctx, "foo.bar.baz", "foo-key"))
+
+	uploader := FileUploader{DBClient: db}
+	_, err := uploader.namespaceEncryption(ctx, "foo.bar.baz/relname/export.parquet")
+	assert.ErrorContains(t, err, "no encryption keys are configured")
+
+	uploader.Keys = KeyRing{}
+	_, err = uploader.namespaceEncryption(ctx, "foo.bar.baz/relname/export.parquet")
+	assert.ErrorContains(t, err, "unknown encryption key: foo-key")
+
+	enc, err := uploader.namespaceEncryption(ctx, "other/relname/export.parquet")
+	require.NoError(t, err)
+	assert.Nil(t, enc)
+}
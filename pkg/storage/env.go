@@ -0,0 +1,66 @@
+package storage
+
+import "os"
+
+// Prefixes of the environment variables of the functions. A process that serves several
+// functions, like the development server, sets the variables of each function with its prefix.
+const (
+	UploaderEnvPrefix      = "UPLOADER_"
+	StatusCheckerEnvPrefix = "STATUS_CHECKER_"
+	EvictorEnvPrefix       = "EVICTOR_"
+)
+
+// EnvWithPrefix returns a function that reads the environment variable with the prefix,
+// or the variable without the prefix when it is not set.
+func EnvWithPrefix(prefix string) func(string) string {
+	return func(key string) string {
+		if value, ok := os.LookupEnv(prefix + key); ok {
+			return value
+		}
+		return os.Getenv(key)
+	}
+}
+
+// UploaderConfigFromEnv reads the uploader config from environment variables.
+func UploaderConfigFromEnv() *UploaderConfig {
+	getenv := EnvWithPrefix(UploaderEnvPrefix)
+	return &UploaderConfig{
+		ObjectStoreConfig:  ObjectStoreConfigFromEnv(getenv),
+		DealProviderConfig: DealProviderConfigFromEnv(getenv),
+		CrdbConn:           getenv("CRDB_CONN_STRING"),
+		HashAlgorithm:      getenv("HASH_ALGORITHM"),
+		SignatureMode:      getenv("SIGNATURE_MODE"),
+		ShardSize:          getenv("SHARD_SIZE"),
+		MaxAttempts:        getenv("MAX_UPLOAD_ATTEMPTS"),
+		RetryBackoff:       getenv("RETRY_BACKOFF"),
+		EncryptionKeys:     getenv("ENCRYPTION_KEYS"),
+		AggregateSize:      getenv("AGGREGATE_SIZE"),
+		AggregateTarget:    getenv("AGGREGATE_TARGET"),
+		AggregateWindow:    getenv("AGGREGATE_WINDOW"),
+		AutoProvision:      getenv("AUTO_PROVISION") == "true",
+	}
+}
+
+// DealProviderConfigFromEnv reads the deal provider config with getenv.
+func DealProviderConfigFromEnv(getenv func(string) string) DealProviderConfig {
+	return DealProviderConfig{
+		Provider:     getenv("DEAL_PROVIDER"),
+		W3SToken:     getenv("WEB3STORAGE_TOKEN"),
+		HTTPEndpoint: getenv("DEAL_HTTP_ENDPOINT"),
+		HTTPToken:    getenv("DEAL_HTTP_TOKEN"),
+		LocalDir:     getenv("LOCAL_DEAL_DIR"),
+	}
+}
+
+// ObjectStoreConfigFromEnv reads the object store config with getenv.
+func ObjectStoreConfigFromEnv(getenv func(string) string) ObjectStoreConfig {
+	return ObjectStoreConfig{
+		Store:         getenv("OBJECT_STORE"),
+		S3Endpoint:    getenv("S3_ENDPOINT"),
+		S3AccessKey:   getenv("S3_ACCESS_KEY"),
+		S3SecretKey:   getenv("S3_SECRET_KEY"),
+		S3Region:      getenv("S3_REGION"),
+		S3Insecure:    getenv("S3_INSECURE") == "true",
+		LocalStoreDir: getenv("LOCAL_STORE_DIR"),
+	}
+}
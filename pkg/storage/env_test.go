@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvWithPrefix(t *testing.T) {
+	t.Setenv("CRDB_CONN_STRING", "shared")
+	t.Setenv("DEAL_PROVIDER", "w3s")
+	t.Setenv(UploaderEnvPrefix+"DEAL_PROVIDER", "local")
+
+	getenv := EnvWithPrefix(UploaderEnvPrefix)
+	assert.Equal(t, "local", getenv("DEAL_PROVIDER"))
+	assert.Equal(t, "shared", getenv("CRDB_CONN_STRING"))
+
+	// the status checker has no prefixed variable, it reads the shared one
+	assert.Equal(t, "w3s", EnvWithPrefix(StatusCheckerEnvPrefix)("DEAL_PROVIDER"))
+
+	t.Setenv(EvictorEnvPrefix+"CRDB_CONN_STRING", "memory://dev")
+	assert.Equal(t, "memory://dev", EnvWithPrefix(EvictorEnvPrefix)("CRDB_CONN_STRING"))
+
+	cfg := UploaderConfigFromEnv()
+	assert.Equal(t, "local", cfg.DealProviderConfig.Provider)
+	assert.Equal(t, "shared", cfg.CrdbConn)
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// The CloudEvent types emitted by Cloud Storage for objects.
+const (
+	EventTypeFinalized       = "google.cloud.storage.object.v1.finalized"
+	EventTypeMetadataUpdated = "google.cloud.storage.object.v1.metadataUpdated"
+	EventTypeDeleted         = "google.cloud.storage.object.v1.deleted"
+	EventTypeArchived        = "google.cloud.storage.object.v1.archived"
+)
+
+// EventAction is what the uploader does with the object of an event.
+type EventAction int
+
+const (
+	// EventIgnore acknowledges the event without doing anything.
+	EventIgnore EventAction = iota
+	// EventUpload uploads the object.
+	EventUpload
+	// EventRemove records that the object was removed from the bucket.
+	EventRemove
+)
+
+// ParseEventAction returns the action for an event type. S3 event names,
+// e.g. s3:ObjectCreated:Put, are accepted as well as the Cloud Storage types.
+func ParseEventAction(eventType string) EventAction {
+	switch {
+	case eventType == EventTypeFinalized, eventType == EventTypeMetadataUpdated:
+		return EventUpload
+	case eventType == EventTypeDeleted, eventType == EventTypeArchived:
+		return EventRemove
+	case strings.HasPrefix(eventType, "s3:ObjectCreated:"):
+		return EventUpload
+	case strings.HasPrefix(eventType, "s3:ObjectRemoved:"):
+		return EventRemove
+	default:
+		return EventIgnore
+	}
+}
+
+// HandleEvent dispatches the event that triggered the uploader on its type.
+// Events of unknown types are logged and acknowledged, so they are not redelivered.
+func (u *FileUploader) HandleEvent(ctx context.Context, eventType string) error {
+	switch ParseEventAction(eventType) {
+	case EventUpload:
+		return u.Upload(ctx)
+	case EventRemove:
+		bucket, fname, err := u.StorageClient.ParseEvent()
+		if err != nil {
+			return fmt.Errorf("failed to parse event: %v", err)
+		}
+		generation, err := u.StorageClient.ParseEventGeneration()
+		if err != nil {
+			return fmt.Errorf("failed to parse event generation: %v", err)
+		}
+		return u.RemoveObject(ctx, bucket, fname, generation)
+	default:
+		fmt.Println("Ignoring event of unknown type", eventType)
+		return nil
+	}
+}
+
+// RemoveObject records that an object generation was deleted or archived in the bucket.
+// Its jobs are marked as source deleted and are no longer cached, and the generation
+// is not aggregated anymore. A zero generation matches every generation of the object.
+func (u *FileUploader) RemoveObject(ctx context.Context, bucket, fname string, generation int64) error {
+	n, err := u.DBClient.MarkSourceDeleted(ctx, bucket, fname, generation)
+	if err != nil {
+		return fmt.Errorf("failed to mark source deleted: %v", err)
+	}
+	fmt.Println("Source deleted", bucket, fname, generation, n)
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tablelandnetwork/basin-storage/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventAction(t *testing.T) {
+	assert.Equal(t, EventUpload, ParseEventAction(EventTypeFinalized))
+	assert.Equal(t, EventUpload, ParseEventAction(EventTypeMetadataUpdated))
+	assert.Equal(t, EventRemove, ParseEventAction(EventTypeDeleted))
+	assert.Equal(t, EventRemove, ParseEventAction(EventTypeArchived))
+	assert.Equal(t, EventUpload, ParseEventAction("s3:ObjectCreated:Put"))
+	assert.Equal(t, EventRemove, ParseEventAction("s3:ObjectRemoved:Delete"))
+	assert.Equal(t, EventIgnore, ParseEventAction("google.cloud.storage.object.v1.unknown"))
+	assert.Equal(t, EventIgnore, ParseEventAction(""))
+}
+
+func TestUploaderHandleEvent(t *testing.T) {
+	ctx := context.Background()
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore := new(mocks.ObjectStore)
+	w3sClient := &mockW3sClient{}
+
+	job := func(generation int64) JobInfo {
+		return JobInfo{
+			Cid:        getCIDFromBytes(mockData()).String(),
+			Bucket:     "mybucket",
+			FileName:   fname,
+			Generation: generation,
+		}
+	}
+	// the objects of the namespace are cached
+	db := newTestMemDB(t, "foo.bar.baz")
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{
+		Namespace: "foo.bar.baz",
+		Relation:  NamespaceDefault,
+		Duration:  60,
+	}))
+	require.NoError(t, db.CreateJob(ctx, job(1)))
+	require.NoError(t, db.CreateJob(ctx, job(2)))
+	require.NoError(t, db.AddPendingAggregate(ctx, job(1), 1))
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, w3sClient),
+		DBClient:      db,
+	}
+
+	// unknown events are acknowledged, the event is not even parsed
+	require.NoError(t, uploader.HandleEvent(ctx, "google.cloud.storage.object.v1.unknown"))
+	mockStore.AssertExpectations(t)
+	assert.Empty(t, deletedJobs(db))
+
+	// only the jobs of the archived generation are marked
+	mockStore.EXPECT().ParseEvent().Return("mybucket", fname, nil)
+	mockStore.EXPECT().ParseEventGeneration().Return(int64(1), nil)
+	require.NoError(t, uploader.HandleEvent(ctx, EventTypeArchived))
+	mockStore.AssertExpectations(t)
+
+	assert.Equal(t, []JobInfo{job(1)}, deletedJobs(db))
+	jobs := testJobs(db)
+	assert.Empty(t, jobs[0].CachePath)
+	assert.Equal(t, fname, jobs[1].CachePath)
+	pending, err := db.PendingAggregates(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// nothing is uploaded
+	assert.Empty(t, w3sClient.Files)
+	assert.Nil(t, testFailedUpload(t, db, fname))
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// evictBatchSize is the number of expired jobs evicted in a single run.
+const evictBatchSize = 100
+
+// ExpiredJob is a job whose cached object has outlived its cache duration.
+type ExpiredJob struct {
+	ID         int64
+	Bucket     string // Bucket is empty for jobs created before the bucket was recorded.
+	CachePath  string
+	Generation int64 // Generation is zero for jobs created before the generation was recorded.
+	ExpiresAt  time.Time
+}
+
+// CacheEvictor deletes the cached objects of expired jobs from the object store.
+type CacheEvictor struct {
+	StorageClient ObjectStore // StorageClient is the ObjectStore the cached objects are deleted from.
+	DBClient      Crdb        // DBClient is a Crdb instance used to interact with CockroachDB.
+
+	// DefaultBucket is the bucket of jobs that do not have one.
+	DefaultBucket string
+	// DryRun only logs the objects that would be deleted, nothing is deleted or updated.
+	DryRun bool
+}
+
+// EvictorConfig defines the configuration for a CacheEvictor.
+type EvictorConfig struct {
+	ObjectStoreConfig
+	CrdbConn      string
+	DefaultBucket string
+	DryRun        bool
+}
+
+// NewCacheEvictor creates a new CacheEvictor.
+func NewCacheEvictor(ctx context.Context, cfg *EvictorConfig) (*CacheEvictor, error) {
+	// There is no event, the objects are read from the expired jobs.
+	storageClient, err := NewObjectStore(ctx, cfg.ObjectStoreConfig, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store: %v", err)
+	}
+
+	dbClient, err := NewCrdb(cfg.CrdbConn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create db client: %v", err)
+	}
+
+	return &CacheEvictor{
+		StorageClient: storageClient,
+		DBClient:      dbClient,
+		DefaultBucket: cfg.DefaultBucket,
+		DryRun:        cfg.DryRun,
+	}, nil
+}
+
+// EvictExpired deletes the cached objects of expired jobs and clears their cache path.
+// An object that is already gone, or that was replaced by a newer generation, is not deleted,
+// but the cache path of the job is cleared all the same.
+func (e *CacheEvictor) EvictExpired(ctx context.Context) error {
+	jobs, err := e.DBClient.ExpiredJobs(ctx, time.Now().UTC(), evictBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get expired jobs: %v", err)
+	}
+
+	var evicted, failed int
+	for _, job := range jobs {
+		if err := e.evict(ctx, job); err != nil {
+			log.Printf("ERROR: failed to evict job %d: %v, file: %s", job.ID, err, job.CachePath)
+			failed++
+			continue
+		}
+		evicted++
+	}
+	fmt.Printf("evicted %d expired jobs, %d failed\n", evicted, failed)
+
+	return nil
+}
+
+func (e *CacheEvictor) evict(ctx context.Context, job ExpiredJob) error {
+	bucket := job.Bucket
+	if bucket == "" {
+		bucket = e.DefaultBucket
+	}
+	if bucket == "" {
+		return fmt.Errorf("job has no bucket")
+	}
+
+	if e.DryRun {
+		fmt.Printf("dry run: would delete %s/%s, expired at %s\n", bucket, job.CachePath, job.ExpiresAt)
+		return nil
+	}
+
+	err := e.StorageClient.DeleteObject(ctx, bucket, job.CachePath, job.Generation)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		fmt.Println("Cached object already deleted", bucket, job.CachePath)
+	case errors.Is(err, ErrGenerationMismatch):
+		fmt.Println("Cached object was replaced, not deleting", bucket, job.CachePath)
+	case err != nil:
+		return fmt.Errorf("failed to delete object: %v", err)
+	}
+
+	if err := e.DBClient.ClearCachePath(ctx, job.ID); err != nil {
+		return err
+	}
+
+	return nil
+}
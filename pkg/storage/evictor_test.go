@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEvictor(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, nil)
+	require.NoError(t, err)
+
+	writeObject := func(name string) int64 {
+		path := filepath.Join(dir, "mybucket", filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, mockData(), 0o600))
+		require.NoError(t, os.WriteFile(path+".metadata.json", []byte(`{}`), 0o600))
+		generation, err := store.GetObjectGeneration(ctx, "mybucket", name)
+		require.NoError(t, err)
+		return generation
+	}
+
+	expired := "foo.bar.baz/relname/expired.parquet"
+	replaced := "foo.bar.baz/relname/replaced.parquet"
+	cached := "foo.bar.baz/relname/cached.parquet"
+	expiredGen := writeObject(expired)
+	writeObject(replaced)
+	cachedGen := writeObject(cached)
+
+	past := time.Now().Add(-time.Minute)
+	db := newTestMemDB(t, "foo.bar.baz")
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{
+		Namespace: "foo.bar.baz",
+		Relation:  NamespaceDefault,
+		Duration:  60,
+	}))
+	cache := func(bucket, name string, generation int64, expiresAt time.Time) {
+		require.NoError(t, db.CreateJob(ctx, JobInfo{
+			Cid:        getCIDFromBytes([]byte(name)).String(),
+			Bucket:     bucket,
+			FileName:   name,
+			Generation: generation,
+		}))
+		db.mu.Lock()
+		db.jobs[len(db.jobs)-1].expiresAt = expiresAt
+		db.mu.Unlock()
+	}
+	cache("mybucket", expired, expiredGen, past)
+	// the object was replaced by a newer export, that must stay in the cache
+	cache("mybucket", replaced, 1, past)
+	// the object was already deleted
+	cache("", "foo.bar.baz/relname/deleted.parquet", 0, past)
+	cache("mybucket", cached, cachedGen, time.Now().Add(time.Hour))
+
+	evictor := CacheEvictor{
+		StorageClient: store,
+		DBClient:      db,
+		DefaultBucket: "mybucket",
+	}
+
+	// a dry run does not delete or update anything
+	evictor.DryRun = true
+	require.NoError(t, evictor.EvictExpired(ctx))
+	jobs, err := db.ExpiredJobs(ctx, time.Now(), evictBatchSize)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 3)
+	_, err = store.GetObjectSize(ctx, "mybucket", expired)
+	require.NoError(t, err)
+
+	evictor.DryRun = false
+	require.NoError(t, evictor.EvictExpired(ctx))
+	jobs, err = db.ExpiredJobs(ctx, time.Now(), evictBatchSize)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	_, err = os.Stat(filepath.Join(dir, "mybucket", expired))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "mybucket", expired+".metadata.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	for _, name := range []string{replaced, cached} {
+		_, err = store.GetObjectSize(ctx, "mybucket", name)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, cached, testJobs(db)[3].CachePath)
+}
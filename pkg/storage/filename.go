@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exports are named by the changefeed that writes them to the bucket:
+//
+//	<ns>/<rel>/<date>/<timestamp>-<session>-<node>-<sink>-<file>-<topic>-<schema>.parquet
+//
+// The date is the UTC date of the timestamp, as YYYY-MM-DD. The timestamp is the HLC timestamp
+// of the export, as YYYYMMDDHHMMSS followed by 9 digits of nanoseconds and 10 digits of logical
+// clock. The session is a 16 digit hex id of the changefeed session, the node and sink are
+// decimal ids, the file is an 8 digit hex sequence number of the sink, and the schema is
+// the hex schema version of the topic. The topic may itself contain dashes.
+const (
+	exportDateLayout = "2006-01-02"
+	exportTimeLayout = "20060102150405"
+	exportExtension  = ".parquet"
+)
+
+var exportNameRegexp = regexp.MustCompile(
+	`^(\d{14})(\d{9})(\d{10})-([0-9a-f]{16})-(\d+)-(\d+)-([0-9a-f]{8})-(.+)-([0-9a-f]+)$`,
+)
+
+// ExportName holds the components of the name of an exported object.
+type ExportName struct {
+	Pub
+	// Timestamp is the wall time of the export, with nanoseconds.
+	Timestamp time.Time
+	// Logical is the logical clock of the export timestamp, it orders exports with the same wall time.
+	Logical int64
+	// SessionID is the hex id of the changefeed session that wrote the export.
+	SessionID string
+	NodeID    int64
+	SinkID    int64
+	// FileID is the sequence number of the export within its sink.
+	FileID   int64
+	Topic    string
+	SchemaID int64
+}
+
+// InvalidNameError is returned when an object name does not follow the export naming convention.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid export name %s: %s", e.Name, e.Reason)
+}
+
+// ParseExportName parses and validates the name of an exported object.
+func ParseExportName(name string) (*ExportName, error) {
+	invalid := func(format string, a ...interface{}) error {
+		return &InvalidNameError{Name: name, Reason: fmt.Sprintf(format, a...)}
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 {
+		return nil, invalid("expected ns/rel/date/file, got %d parts", len(parts))
+	}
+	for i, part := range parts[:2] {
+		if part == "" {
+			return nil, invalid("empty %s", []string{"namespace", "relation"}[i])
+		}
+	}
+
+	date, err := time.Parse(exportDateLayout, parts[2])
+	if err != nil {
+		return nil, invalid("failed to parse date %s", parts[2])
+	}
+
+	base, ok := strings.CutSuffix(parts[3], exportExtension)
+	if !ok {
+		return nil, invalid("expected %s extension", exportExtension)
+	}
+	m := exportNameRegexp.FindStringSubmatch(base)
+	if m == nil {
+		return nil, invalid("expected <timestamp>-<session>-<node>-<sink>-<file>-<topic>-<schema>")
+	}
+
+	wall, err := time.Parse(exportTimeLayout, m[1])
+	if err != nil {
+		return nil, invalid("failed to parse timestamp %s", m[1])
+	}
+	nanos, _ := strconv.ParseInt(m[2], 10, 64)
+	wall = wall.Add(time.Duration(nanos))
+	if !wall.Truncate(24 * time.Hour).Equal(date) {
+		return nil, invalid("timestamp %s is not on %s", m[1], parts[2])
+	}
+
+	n := &ExportName{
+		Pub: Pub{
+			Namespace: parts[0],
+			Relation:  parts[1],
+		},
+		Timestamp: wall,
+		SessionID: m[4],
+		Topic:     m[8],
+	}
+	// the digits are matched by the regexp, only overflows are left to check
+	for _, f := range []struct {
+		field *int64
+		value string
+		base  int
+	}{
+		{&n.Logical, m[3], 10},
+		{&n.NodeID, m[5], 10},
+		{&n.SinkID, m[6], 10},
+		{&n.FileID, m[7], 16},
+		{&n.SchemaID, m[9], 16},
+	} {
+		if *f.field, err = strconv.ParseInt(f.value, f.base, 64); err != nil {
+			return nil, invalid("failed to parse %s", f.value)
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExportName(t *testing.T) {
+	n, err := ParseExportName(
+		"feeds/employees/2023-08-29/202308291525552525242120000000007-3ab461ed932d5f1c-1-2-0000001a-my-employees-2f.parquet")
+	require.NoError(t, err)
+
+	assert.Equal(t, Pub{Namespace: "feeds", Relation: "employees"}, n.Pub)
+	assert.Equal(t, time.Date(2023, time.August, 29, 15, 25, 55, 252524212, time.UTC), n.Timestamp)
+	assert.Equal(t, int64(7), n.Logical)
+	assert.Equal(t, "3ab461ed932d5f1c", n.SessionID)
+	assert.Equal(t, int64(1), n.NodeID)
+	assert.Equal(t, int64(2), n.SinkID)
+	assert.Equal(t, int64(26), n.FileID)
+	assert.Equal(t, "my-employees", n.Topic)
+	assert.Equal(t, int64(47), n.SchemaID)
+}
+
+func TestParseExportNameInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{
+			name:   "feeds/employees/export.parquet",
+			reason: "expected ns/rel/date/file, got 3 parts",
+		},
+		{
+			name:   "/employees/2023-08-29/202308291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-employees-2.parquet",
+			reason: "empty namespace",
+		},
+		{
+			name:   "feeds/employees/20230829/202308291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-employees-2.parquet", // nolint:lll
+			reason: "failed to parse date 20230829",
+		},
+		{
+			name:   "feeds/employees/2023-08-29/202308291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-employees-2.csv",
+			reason: "expected .parquet extension",
+		},
+		{
+			// the session id is too short
+			name:   "feeds/employees/2023-08-29/202308291525552525242120000000000-3ab461ed-1-2-00000000-employees-2.parquet",
+			reason: "expected <timestamp>-<session>-<node>-<sink>-<file>-<topic>-<schema>",
+		},
+		{
+			name:   "feeds/employees/2023-08-29/202313291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-employees-2.parquet", // nolint:lll
+			reason: "failed to parse timestamp 20231329152555",
+		},
+		{
+			name:   "feeds/employees/2023-08-30/202308291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-employees-2.parquet", // nolint:lll
+			reason: "timestamp 20230829152555 is not on 2023-08-30",
+		},
+		{
+			name:   "feeds/employees/2023-08-29/202308291525552525242120000000000-3ab461ed932d5f1c-99999999999999999999-2-00000000-employees-2.parquet", // nolint:lll
+			reason: "failed to parse 99999999999999999999",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.reason, func(t *testing.T) {
+			_, err := ParseExportName(tc.name)
+			var invalid *InvalidNameError
+			require.True(t, errors.As(err, &invalid))
+			assert.Equal(t, tc.name, invalid.Name)
+			assert.Equal(t, tc.reason, invalid.Reason)
+		})
+	}
+}
+
+func TestUploaderExportName(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, nil)
+	require.NoError(t, err)
+
+	hash := mockParquetHash()
+	writeObject := func(name string) {
+		path := filepath.Join(dir, "mybucket", filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, mockParquet(), 0o600))
+		// the metadata has no timestamp
+		metadata, err := json.Marshal(map[string]string{
+			"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+			"hash":      hash,
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path+".metadata.json", metadata, 0o600))
+	}
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	uploader := FileUploader{
+		StorageClient: store,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+	}
+
+	// the job timestamp is taken from the name
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	writeObject(fname)
+	require.NoError(t, uploader.UploadObject(ctx, "mybucket", fname))
+	require.Len(t, createdJobs(db), 1)
+	assert.Equal(t, int64(1700248832), *createdJobs(db)[0].Timestamp)
+
+	// names that do not follow the naming convention are rejected
+	invalid := "foo.bar.baz/relname/export.parquet"
+	writeObject(invalid)
+	err = uploader.UploadObject(ctx, "mybucket", invalid)
+	var nameErr *InvalidNameError
+	require.True(t, errors.As(err, &nameErr))
+	assert.Equal(t, []string{invalid}, rejectedPaths(db))
+	assert.Equal(t, StageMetadata, testFailedUpload(t, db, invalid).Stage)
+	assert.True(t, testFailedUpload(t, db, invalid).Permanent)
+	assert.Len(t, createdJobs(db), 1)
+}
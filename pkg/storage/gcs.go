@@ -2,22 +2,20 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
 
 	"cloud.google.com/go/storage"
 	"github.com/googleapis/google-cloudevents-go/cloud/storagedata"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
-// GCS defines the interface for interacting with Google Cloud Storage (GCS).
-type GCS interface {
-	GetObjectReader(ctx context.Context, bName, oName string) (io.ReadCloser, error)
-	GetObjectMetadata(ctx context.Context, bName, oName string) (map[string]string, error)
-	ParseEvent() (string, string, error)
-}
-
-// GCSClient implements the GCSOps interface.
+// GCSClient implements the ObjectStore interface for Google Cloud Storage (GCS).
 type GCSClient struct {
 	Client    *storage.Client
 	EventData []byte
@@ -41,6 +39,16 @@ func (r *GCSClient) GetObjectReader(ctx context.Context, bucketName, objectName
 	return r.Client.Bucket(bucketName).Object(objectName).NewReader(ctx)
 }
 
+// GetObjectRangeReader returns a reader for length bytes of the specified object,
+// starting at offset.
+func (r *GCSClient) GetObjectRangeReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	return r.Client.Bucket(bucketName).Object(objectName).NewRangeReader(ctx, offset, length)
+}
+
 // GetObjectMetadata returns the metadata for the specified object in the specified bucket.
 func (r *GCSClient) GetObjectMetadata(ctx context.Context, bucketName, objectName string) (map[string]string, error) {
 	attrs, err := r.Client.Bucket(bucketName).Object(objectName).Attrs(ctx)
@@ -51,6 +59,82 @@ func (r *GCSClient) GetObjectMetadata(ctx context.Context, bucketName, objectNam
 	return attrs.Metadata, nil
 }
 
+// GetObjectSize returns the size in bytes of the specified object in the specified bucket.
+func (r *GCSClient) GetObjectSize(ctx context.Context, bucketName, objectName string) (int64, error) {
+	attrs, err := r.Client.Bucket(bucketName).Object(objectName).Attrs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("attrs: %s", err)
+	}
+
+	return attrs.Size, nil
+}
+
+// GetObjectGeneration returns the generation of the specified object in the specified bucket.
+// The generation changes every time the content of the object is replaced.
+func (r *GCSClient) GetObjectGeneration(ctx context.Context, bucketName, objectName string) (int64, error) {
+	attrs, err := r.Client.Bucket(bucketName).Object(objectName).Attrs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("attrs: %s", err)
+	}
+
+	return attrs.Generation, nil
+}
+
+// ListObjects lists the objects of the bucket with the prefix, after startAfter.
+func (r *GCSClient) ListObjects(
+	ctx context.Context,
+	bucketName, prefix, startAfter string,
+	limit int,
+	fn func(name string, generation int64) error,
+) error {
+	query := &storage.Query{Prefix: prefix, StartOffset: startAfter}
+	if err := query.SetAttrSelection([]string{"Name", "Generation"}); err != nil {
+		return fmt.Errorf("set attr selection: %s", err)
+	}
+
+	it := r.Client.Bucket(bucketName).Objects(ctx, query)
+	for listed := 0; listed < limit; {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("list: %s", err)
+		}
+		// the start offset is inclusive, and folder placeholders are not objects
+		if attrs.Name == startAfter || strings.HasSuffix(attrs.Name, "/") {
+			continue
+		}
+		if err := fn(attrs.Name, attrs.Generation); err != nil {
+			return err
+		}
+		listed++
+	}
+
+	return nil
+}
+
+// DeleteObject deletes the specified object in the specified bucket, if its generation still matches.
+func (r *GCSClient) DeleteObject(ctx context.Context, bucketName, objectName string, generation int64) error {
+	object := r.Client.Bucket(bucketName).Object(objectName)
+	if generation != 0 {
+		object = object.If(storage.Conditions{GenerationMatch: generation})
+	}
+
+	err := object.Delete(ctx)
+	var apiErr *googleapi.Error
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return ErrObjectNotFound
+	case errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed:
+		return ErrGenerationMismatch
+	case err != nil:
+		return fmt.Errorf("delete: %s", err)
+	}
+
+	return nil
+}
+
 // ParseEvent parses the CloudEvent data to get the bucket name and object path.
 func (r *GCSClient) ParseEvent() (string, string, error) {
 	var data storagedata.StorageObjectData
@@ -60,3 +144,13 @@ func (r *GCSClient) ParseEvent() (string, string, error) {
 
 	return data.GetBucket(), data.GetName(), nil
 }
+
+// ParseEventGeneration parses the CloudEvent data to get the generation of the object.
+func (r *GCSClient) ParseEventGeneration() (int64, error) {
+	var data storagedata.StorageObjectData
+	if err := protojson.Unmarshal(r.EventData, &data); err != nil {
+		return 0, fmt.Errorf("protojson.Unmarshal: %w", err)
+	}
+
+	return data.GetGeneration(), nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgorithm is the digest algorithm used to verify the content of an uploaded object
+// against its `hash` metadata.
+type HashAlgorithm string
+
+const (
+	// HashKeccak256 is the legacy Keccak-256 digest, as used by basin-cli. It is the default.
+	HashKeccak256 HashAlgorithm = "keccak256"
+	// HashSHA256 is the SHA2-256 digest.
+	HashSHA256 HashAlgorithm = "sha256"
+)
+
+// ParseHashAlgorithm parses the name of a digest algorithm.
+// An empty name selects the default algorithm.
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	switch alg := HashAlgorithm(strings.ToLower(name)); alg {
+	case "":
+		return HashKeccak256, nil
+	case HashKeccak256, HashSHA256:
+		return alg, nil
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm: %s", name)
+	}
+}
+
+func (a HashAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case "", HashKeccak256:
+		return sha3.NewLegacyKeccak256(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", a)
+	}
+}
+
+// Digest reads r until EOF and returns its digest.
+func (a HashAlgorithm) Digest(r io.Reader) ([]byte, error) {
+	h, err := a.newHash()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to hash content: %v", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// HashMismatchError is returned when the content of an object does not match
+// the hash that was supplied in its metadata.
+type HashMismatchError struct {
+	Algorithm HashAlgorithm
+	Expected  string
+	Actual    string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf(
+		"%s hash mismatch: metadata has %s, content has %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// verifyHash compares the hex encoded expected hash with the digest.
+func verifyHash(alg HashAlgorithm, expected string, digest []byte) error {
+	expected = strings.ToLower(strings.TrimPrefix(expected, "0x"))
+	if actual := hex.EncodeToString(digest); expected != actual {
+		if alg == "" {
+			alg = HashKeccak256
+		}
+		return &HashMismatchError{
+			Algorithm: alg,
+			Expected:  expected,
+			Actual:    actual,
+		}
+	}
+	return nil
+}
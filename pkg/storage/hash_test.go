@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAlgorithm(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected HashAlgorithm
+		digest   string
+	}{
+		{
+			name:     "",
+			expected: HashKeccak256,
+			digest:   "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad",
+		},
+		{
+			name:     "Keccak256",
+			expected: HashKeccak256,
+			digest:   "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad",
+		},
+		{
+			name:     "sha256",
+			expected: HashSHA256,
+			digest:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		},
+	}
+
+	for _, tt := range tests {
+		alg, err := ParseHashAlgorithm(tt.name)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, alg)
+
+		digest, err := alg.Digest(bytes.NewReader(mockData()))
+		require.NoError(t, err)
+		assert.Equal(t, tt.digest, hex.EncodeToString(digest))
+
+		assert.NoError(t, verifyHash(alg, tt.digest, digest))
+		assert.NoError(t, verifyHash(alg, "0x"+tt.digest, digest))
+	}
+
+	_, err := ParseHashAlgorithm("md5")
+	assert.Error(t, err)
+}
+
+func TestVerifyHashMismatch(t *testing.T) {
+	digest, err := HashSHA256.Digest(bytes.NewReader(mockData()))
+	require.NoError(t, err)
+
+	err = verifyHash(HashSHA256, "f00a989b4f86fd3bd6d347b03c59bba377bcaac57f3b43addfad9da1bca51938", digest)
+	var mismatch *HashMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, HashSHA256, mismatch.Algorithm)
+	assert.Equal(t, "f00a989b4f86fd3bd6d347b03c59bba377bcaac57f3b43addfad9da1bca51938", mismatch.Expected)
+	assert.Equal(t, hex.EncodeToString(digest), mismatch.Actual)
+}
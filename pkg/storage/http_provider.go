@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// HTTPProvider is a DealProvider backed by an HTTP service that stores CAR files and makes
+// Filecoin deals for them. It is not an IPFS Pinning Service API client: that API pins content
+// that is already on IPFS and has no deals. The service implements the subset of the legacy
+// web3.storage API that the uploader and the checker use:
+//
+//   - `POST /car` stores the CAR of the request body and responds with `{"cid": "<root>"}`.
+//   - `GET /status/<root>` responds with `{"cid": "<root>", "dagSize": <bytes>, "created": <time>,
+//     "deals": [...]}`, with the deals in the web3.storage format, or with 404 for unknown content.
+//
+// Requests carry the token as a bearer token.
+type HTTPProvider struct {
+	Endpoint   string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewHTTPProvider creates a new HTTPProvider.
+func NewHTTPProvider(endpoint string, token string) (*HTTPProvider, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("missing deal service endpoint")
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid deal service endpoint: %v", err)
+	}
+
+	return &HTTPProvider{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Token:    token,
+		HTTPClient: &http.Client{
+			Timeout: 0, // no timeout
+		},
+	}, nil
+}
+
+// Put encodes the file as a CAR and streams it to the service.
+func (p *HTTPProvider) Put(ctx context.Context, file fs.File) (cid.Cid, error) {
+	carReader, carWriter := io.Pipe()
+	go func() {
+		_, err := writeCAR(ctx, file, carWriter)
+		_ = carWriter.CloseWithError(err)
+	}()
+
+	var uploaded struct {
+		Cid string `json:"cid"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/car", "application/vnd.ipld.car", carReader, &uploaded); err != nil {
+		_ = carReader.CloseWithError(err)
+		return cid.Undef, fmt.Errorf("failed to upload car: %v", err)
+	}
+
+	root, err := cid.Parse(uploaded.Cid)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to parse uploaded cid: %v", err)
+	}
+
+	return root, nil
+}
+
+// contentStatusJSON is the status of content as encoded by web3.storage compatible APIs.
+type contentStatusJSON struct {
+	Cid     string     `json:"cid"`
+	DagSize uint64     `json:"dagSize"`
+	Created time.Time  `json:"created"`
+	Deals   []dealJSON `json:"deals"`
+}
+
+// Status returns the status and the deals of the content.
+func (p *HTTPProvider) Status(ctx context.Context, c cid.Cid) (*ContentStatus, error) {
+	var raw contentStatusJSON
+	if err := p.do(ctx, http.MethodGet, "/status/"+c.String(), "", nil, &raw); err != nil {
+		if err == errNotFound {
+			return nil, fmt.Errorf("content not found: %s", c)
+		}
+		return nil, fmt.Errorf("failed to get status: %v", err)
+	}
+
+	deals, err := decodeDeals(raw.Deals)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContentStatus{
+		Cid:     c,
+		DagSize: raw.DagSize,
+		Created: raw.Created,
+		Deals:   deals,
+	}, nil
+}
+
+// Deals returns the Filecoin deals of the content, none for unknown content.
+func (p *HTTPProvider) Deals(ctx context.Context, c cid.Cid) ([]Deal, error) {
+	var raw contentStatusJSON
+	if err := p.do(ctx, http.MethodGet, "/status/"+c.String(), "", nil, &raw); err != nil {
+		if err == errNotFound {
+			return []Deal{}, nil
+		}
+		return nil, fmt.Errorf("failed to get deals: %v", err)
+	}
+
+	return decodeDeals(raw.Deals)
+}
+
+func decodeDeals(raw []dealJSON) ([]Deal, error) {
+	deals := make([]Deal, len(raw))
+	for i, d := range raw {
+		deal, err := d.toDeal()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode deal: %v", err)
+		}
+		deals[i] = deal
+	}
+
+	return deals, nil
+}
+
+var errNotFound = errors.New("not found")
+
+func (p *HTTPProvider) do(
+	ctx context.Context,
+	method string,
+	path string,
+	contentType string,
+	body io.Reader,
+	out interface{},
+) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.Endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
+	}
+
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %d", res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// dealJSON is a deal as encoded by web3.storage compatible APIs.
+type dealJSON struct {
+	DealID            uint64    `json:"dealId,omitempty"`
+	StorageProvider   string    `json:"storageProvider,omitempty"`
+	Status            string    `json:"status"`
+	PieceCid          string    `json:"pieceCid,omitempty"`
+	DataCid           string    `json:"dataCid,omitempty"`
+	DataModelSelector string    `json:"dataModelSelector,omitempty"`
+	Activation        time.Time `json:"activation,omitempty"`
+	Expiration        time.Time `json:"expiration,omitempty"`
+	Created           time.Time `json:"created"`
+	Updated           time.Time `json:"updated"`
+}
+
+func (d dealJSON) toDeal() (Deal, error) {
+	status, err := ParseDealStatus(d.Status)
+	if err != nil {
+		return Deal{}, err
+	}
+
+	deal := Deal{
+		DealID:            d.DealID,
+		StorageProvider:   d.StorageProvider,
+		Status:            status,
+		PieceCid:          cid.Undef,
+		DataCid:           cid.Undef,
+		DataModelSelector: d.DataModelSelector,
+		Activation:        d.Activation,
+		Expiration:        d.Expiration,
+		Created:           d.Created,
+		Updated:           d.Updated,
+	}
+	if d.PieceCid != "" {
+		if deal.PieceCid, err = cid.Parse(d.PieceCid); err != nil {
+			return Deal{}, err
+		}
+	}
+	if d.DataCid != "" {
+		if deal.DataCid, err = cid.Parse(d.DataCid); err != nil {
+			return Deal{}, err
+		}
+	}
+
+	return deal, nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// JobStatus is the step of its lifecycle a job is at.
+type JobStatus string
+
+const (
+	// JobUploaded is the status of a new job, its files were sent to the deal provider.
+	JobUploaded JobStatus = "uploaded"
+	// JobDealsPending is the status of a job with deals that are not active yet.
+	JobDealsPending JobStatus = "deals_pending"
+	// JobDealsActive is the status of a job whose files all have an active deal.
+	JobDealsActive JobStatus = "deals_active"
+	// JobTxSubmitted is the status of a job whose CID is being added to the contract.
+	JobTxSubmitted JobStatus = "tx_submitted"
+	// JobIndexed is the final status of a job whose CID was added to the contract.
+	JobIndexed JobStatus = "indexed"
+	// JobFailed is the status of a job whose CID could not be added to the contract.
+	// The checker tries again to index failed jobs.
+	JobFailed JobStatus = "failed"
+)
+
+// ErrInvalidJobTransition is returned when a job is moved to a status it cannot reach from its current status.
+var ErrInvalidJobTransition = errors.New("invalid job transition")
+
+// jobTransitions are the statuses each status can move to.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobUploaded:     {JobDealsPending, JobDealsActive, JobFailed},
+	JobDealsPending: {JobDealsActive, JobFailed},
+	JobDealsActive:  {JobTxSubmitted, JobFailed},
+	JobTxSubmitted:  {JobIndexed, JobFailed},
+	JobFailed:       {JobDealsPending, JobDealsActive},
+	JobIndexed:      {},
+}
+
+// unfinishedStatuses are the statuses of the jobs the checker has to process.
+var unfinishedStatuses = []JobStatus{JobUploaded, JobDealsPending, JobDealsActive, JobTxSubmitted, JobFailed}
+
+// unfinishedStatusNames returns the unfinished statuses, as stored in the DB.
+func unfinishedStatusNames() []string {
+	names := make([]string, len(unfinishedStatuses))
+	for i, status := range unfinishedStatuses {
+		names[i] = string(status)
+	}
+	return names
+}
+
+// CanTransition tells whether a job can move from the status to the other status.
+func (s JobStatus) CanTransition(to JobStatus) bool {
+	for _, next := range jobTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// JobTransition moves a job to a new status.
+type JobTransition struct {
+	Status JobStatus
+	// Activation is the activation of the deals of the job, set when it moves to JobDealsActive.
+	Activation time.Time
+	// Error is why the job failed, set when it moves to JobFailed.
+	Error string
+}
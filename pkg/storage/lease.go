@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// defaultLeaseDuration is how long the jobs claimed by a checker are leased to it. It must
+	// be longer than the processing of a job, which waits for the receipt of its tx.
+	defaultLeaseDuration = 10 * time.Minute
+	// defaultClaimBatchSize is the number of jobs claimed by a single run of a checker.
+	defaultClaimBatchSize = 100
+)
+
+// ErrLeaseLost is returned when renewing the lease of jobs that are not leased to the worker anymore.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// newWorkerID returns a unique ID for a checker, made of its host name and a random suffix.
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "checker"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// ClaimJobs leases up to limit unfinished jobs to the worker for the duration. Jobs leased
+// to other workers are skipped until their lease expires, so that several checkers can run
+// at once. The jobs that were checked the longest ago are claimed first. The jobs of
+// an aggregate share its CID, they are claimed together.
+func (db *DBClient) ClaimJobs(
+	ctx context.Context,
+	worker string,
+	limit int,
+	duration time.Duration,
+) ([]UnfinishedJob, error) {
+	_, err := db.DB.ExecContext(ctx,
+		`UPDATE jobs SET lease_owner = $1, leased_until = now() + $2 * INTERVAL '1 millisecond'
+		WHERE status = ANY($3)
+		AND (leased_until IS NULL OR leased_until < now())
+		AND cid IN (
+			SELECT cid FROM jobs
+			WHERE status = ANY($3)
+			AND (leased_until IS NULL OR leased_until < now())
+			ORDER BY leased_until NULLS FIRST, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)`,
+		worker, duration.Milliseconds(), pq.Array(unfinishedStatusNames()), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %v", err)
+	}
+
+	return db.queryJobs(ctx,
+		"jobs.lease_owner = $1 AND jobs.leased_until >= now() AND jobs.status = ANY($2)",
+		worker, pq.Array(unfinishedStatusNames()))
+}
+
+// RenewJobLease extends the lease of the jobs with the CID by the duration. It returns
+// ErrLeaseLost if they are not leased to the worker anymore, e.g. because their lease
+// expired and another worker claimed them.
+func (db *DBClient) RenewJobLease(ctx context.Context, worker string, cid []byte, duration time.Duration) error {
+	res, err := db.DB.ExecContext(ctx,
+		`UPDATE jobs SET leased_until = now() + $1 * INTERVAL '1 millisecond'
+		WHERE cid = $2 AND lease_owner = $3 AND leased_until >= now()`,
+		duration.Milliseconds(), cid, worker)
+	if err != nil {
+		return fmt.Errorf("failed to renew job lease: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseJobLease releases the jobs with the CID that are leased to the worker. Their lease ends
+// now, its end then tells when the jobs were last checked.
+func (db *DBClient) ReleaseJobLease(ctx context.Context, worker string, cid []byte) error {
+	_, err := db.DB.ExecContext(ctx,
+		`UPDATE jobs SET lease_owner = NULL, leased_until = now()
+		WHERE cid = $1 AND lease_owner = $2`,
+		cid, worker)
+	if err != nil {
+		return fmt.Errorf("failed to release job lease: %v", err)
+	}
+
+	return nil
+}
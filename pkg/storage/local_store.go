@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// metadataSuffix is appended to the name of an object to name its metadata file.
+const metadataSuffix = ".metadata.json"
+
+// LocalStore is an ObjectStore that reads objects from a local directory, for offline development.
+// Each bucket is a subdirectory, and the metadata of an object is stored
+// as a JSON object in a sidecar file named <object>.metadata.json.
+type LocalStore struct {
+	Dir       string
+	EventData []byte
+}
+
+// localEvent is the payload of a local store event. It uses the same field names as
+// the GCS object data, so the same events can be sent to both stores.
+type localEvent struct {
+	Bucket     string `json:"bucket"`
+	Name       string `json:"name"`
+	Generation int64  `json:"generation,string,omitempty"`
+}
+
+// NewLocalStore creates a new LocalStore.
+func NewLocalStore(dir string, eventData []byte) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("missing local store directory")
+	}
+
+	return &LocalStore{
+		Dir:       dir,
+		EventData: eventData,
+	}, nil
+}
+
+// objectPath returns the path of the object, refusing names that escape the store directory.
+func (s *LocalStore) objectPath(bucketName, objectName string) (string, error) {
+	name := filepath.Join(bucketName, filepath.FromSlash(objectName))
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid object path: %s/%s", bucketName, objectName)
+	}
+	return filepath.Join(s.Dir, name), nil
+}
+
+// GetObjectReader returns a reader for the specified object in the specified bucket.
+func (s *LocalStore) GetObjectReader(_ context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// GetObjectRangeReader returns a reader for length bytes of the specified object,
+// starting at offset.
+func (s *LocalStore) GetObjectRangeReader(
+	_ context.Context,
+	bucketName, objectName string,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// GetObjectMetadata returns the metadata for the specified object in the specified bucket.
+// An object without a metadata file has no metadata.
+func (s *LocalStore) GetObjectMetadata(_ context.Context, bucketName, objectName string) (map[string]string, error) {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("stat: %s", err)
+	}
+
+	data, err := os.ReadFile(path + metadataSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %v", err)
+	}
+
+	metadata := map[string]string{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %v", err)
+	}
+
+	return metadata, nil
+}
+
+// GetObjectSize returns the size in bytes of the specified object in the specified bucket.
+func (s *LocalStore) GetObjectSize(_ context.Context, bucketName, objectName string) (int64, error) {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("stat: %s", err)
+	}
+
+	return info.Size(), nil
+}
+
+// GetObjectGeneration returns the generation of the specified object in the specified bucket.
+// The modification time of the file in microseconds is used as generation.
+func (s *LocalStore) GetObjectGeneration(_ context.Context, bucketName, objectName string) (int64, error) {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("stat: %s", err)
+	}
+
+	return info.ModTime().UnixMicro(), nil
+}
+
+// ListObjects lists the objects of the bucket with the prefix, after startAfter.
+// The metadata sidecar files are not listed.
+func (s *LocalStore) ListObjects(
+	_ context.Context,
+	bucketName, prefix, startAfter string,
+	limit int,
+	fn func(name string, generation int64) error,
+) error {
+	root, err := s.objectPath(bucketName, "")
+	if err != nil {
+		return err
+	}
+
+	type object struct {
+		name       string
+		generation int64
+	}
+	var objects []object
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, metadataSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) || name <= startAfter {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object{name: name, generation: info.ModTime().UnixMicro()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("list: %s", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].name < objects[j].name
+	})
+	if len(objects) > limit {
+		objects = objects[:limit]
+	}
+	for _, o := range objects {
+		if err := fn(o.name, o.generation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteObject deletes the specified object in the specified bucket, and its metadata file,
+// if its generation still matches.
+func (s *LocalStore) DeleteObject(_ context.Context, bucketName, objectName string, generation int64) error {
+	path, err := s.objectPath(bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("stat: %s", err)
+	}
+	if generation != 0 && info.ModTime().UnixMicro() != generation {
+		return ErrGenerationMismatch
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove object: %v", err)
+	}
+	if err := os.Remove(path + metadataSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove metadata: %v", err)
+	}
+
+	return nil
+}
+
+// ParseEvent parses the event data to get the bucket name and object path.
+func (s *LocalStore) ParseEvent() (string, string, error) {
+	var event localEvent
+	if err := json.Unmarshal(s.EventData, &event); err != nil {
+		return "", "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	return event.Bucket, event.Name, nil
+}
+
+// ParseEventGeneration parses the event data to get the generation of the object, if any.
+func (s *LocalStore) ParseEventGeneration() (int64, error) {
+	var event localEvent
+	if err := json.Unmarshal(s.EventData, &event); err != nil {
+		return 0, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	return event.Generation, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	path := filepath.Join(dir, "mybucket", filepath.FromSlash(fname))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, mockData(), 0o600))
+	require.NoError(t, os.WriteFile(path+".metadata.json", []byte(`{"hash": "abcd", "timestamp": "1"}`), 0o600))
+
+	event := []byte(`{"bucket": "mybucket", "name": "` + fname + `"}`)
+	store, err := NewObjectStore(ctx, ObjectStoreConfig{Store: ObjectStoreLocal, LocalStoreDir: dir}, event)
+	require.NoError(t, err)
+
+	bucket, name, err := store.ParseEvent()
+	require.NoError(t, err)
+	assert.Equal(t, "mybucket", bucket)
+	assert.Equal(t, fname, name)
+
+	// events without a generation match every generation
+	generation, err := store.ParseEventGeneration()
+	require.NoError(t, err)
+	assert.Zero(t, generation)
+	store.(*LocalStore).EventData = []byte(`{"bucket": "mybucket", "name": "` + fname + `", "generation": "42"}`)
+	generation, err = store.ParseEventGeneration()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), generation)
+
+	reader, err := store.GetObjectReader(ctx, bucket, name)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, mockData(), data)
+
+	reader, err = store.GetObjectRangeReader(ctx, bucket, name, 6, 5)
+	require.NoError(t, err)
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, []byte("world"), data)
+
+	metadata, err := store.GetObjectMetadata(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"hash": "abcd", "timestamp": "1"}, metadata)
+
+	size, err := store.GetObjectSize(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(mockData())), size)
+
+	// the generation changes when the content is replaced
+	generation, err = store.GetObjectGeneration(ctx, bucket, name)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	later := info.ModTime().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+	newGeneration, err := store.GetObjectGeneration(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Greater(t, newGeneration, generation)
+
+	// objects outside of the store are refused
+	_, err = store.GetObjectReader(ctx, bucket, "../../etc/passwd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,1089 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ipfs/go-cid"
+)
+
+// memoryScheme is the scheme of the connection strings of in-memory databases.
+const memoryScheme = "memory"
+
+// maxNamespaceLength is the length of the name column of the namespaces table.
+const maxNamespaceLength = 32
+
+var (
+	memDBsMu sync.Mutex
+	memDBs   = map[string]*MemDB{}
+)
+
+// NewCrdb creates the Crdb selected by the connection string. A "memory://<name>" connection
+// string selects the MemDB of that name, shared by every client of the process that uses it.
+// Its "namespace" query parameters, e.g. "memory://dev?namespace=myns:0x<owner>", create the
+// namespaces the MemDB starts with. Any other connection string is for CockroachDB.
+func NewCrdb(conn string) (Crdb, error) {
+	if !strings.HasPrefix(conn, memoryScheme+"://") {
+		return NewDB(conn)
+	}
+
+	u, err := url.Parse(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse memory connection string: %v", err)
+	}
+
+	memDBsMu.Lock()
+	defer memDBsMu.Unlock()
+	db, ok := memDBs[u.Host]
+	if !ok {
+		db = NewMemDB()
+		memDBs[u.Host] = db
+	}
+
+	for _, ns := range u.Query()["namespace"] {
+		name, owner, found := strings.Cut(ns, ":")
+		if !found || !common.IsHexAddress(owner) {
+			return nil, fmt.Errorf("invalid namespace, expected <name>:<owner address>: %s", ns)
+		}
+		if _, err := db.NamespaceOwner(context.Background(), name); err == nil {
+			continue
+		}
+		if err := db.CreateNamespace(context.Background(), name, common.HexToAddress(owner).Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// MemDB is a Crdb implementation that keeps its tables in memory. It is meant for development
+// and tests, it enforces the uniqueness constraints, foreign keys and job status transitions
+// of the CockroachDB schema, but nothing outlives the process.
+type MemDB struct {
+	mu sync.Mutex
+	// lastID is the last ID given to a row of any table.
+	lastID int64
+
+	namespaces   []*memNamespace
+	jobs         []*memJob
+	transitions  []memTransition
+	cacheConfigs map[memRelationKey]int64
+	failures     map[memObjectKey]FailedUpload
+	pending      map[memGenerationKey]PendingAggregate
+	rejections   []memRejection
+	deals        map[memDealKey]*JobDeal
+	txs          []*memTx
+	pubs         map[memRelationKey]*ProvisionedPub
+}
+
+type memNamespace struct {
+	id            int64
+	name          string
+	owner         []byte
+	keyRef        string
+	provisionedAt time.Time
+}
+
+type memJob struct {
+	id         int64
+	nsID       int64
+	pub        Pub
+	cid        []byte
+	shards     [][]byte
+	timestamp  *int64
+	cachePath  string // cachePath is empty when the job has no cached object.
+	expiresAt  time.Time
+	hash       []byte
+	bucket     string
+	object     string
+	generation int64
+	activated  time.Time
+
+	// info is the job as it was created, it holds the columns that are never updated.
+	info JobInfo
+
+	sourceDeletedAt time.Time
+	status          JobStatus
+	statusUpdatedAt time.Time
+	leaseOwner      string
+	leasedUntil     time.Time
+}
+
+type memTransition struct {
+	jobID     int64
+	from, to  JobStatus
+	err       string
+	createdAt time.Time
+}
+
+type memRelationKey struct {
+	nsID     int64
+	relation string
+}
+
+type memObjectKey struct {
+	bucket, object string
+}
+
+type memGenerationKey struct {
+	bucket, object string
+	generation     int64
+}
+
+type memRejection struct {
+	bucket, path string
+	generation   int64
+	hash, reason string
+	createdAt    time.Time
+}
+
+type memDealKey struct {
+	jobID           int64
+	partCid         string
+	storageProvider string
+	dealID          uint64
+}
+
+type memTx struct {
+	OnchainTx
+	jobID int64
+}
+
+// NewMemDB creates a new empty MemDB. It has no namespace, they are created with CreateNamespace.
+func NewMemDB() *MemDB {
+	return &MemDB{
+		cacheConfigs: map[memRelationKey]int64{},
+		failures:     map[memObjectKey]FailedUpload{},
+		pending:      map[memGenerationKey]PendingAggregate{},
+		deals:        map[memDealKey]*JobDeal{},
+		pubs:         map[memRelationKey]*ProvisionedPub{},
+	}
+}
+
+func (m *MemDB) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+func (m *MemDB) namespace(name string) *memNamespace {
+	for _, ns := range m.namespaces {
+		if ns.name == name {
+			return ns
+		}
+	}
+	return nil
+}
+
+// jobsByCid returns the jobs with the CID. The jobs of an aggregate share its CID.
+func (m *MemDB) jobsByCid(c []byte) []*memJob {
+	var jobs []*memJob
+	for _, job := range m.jobs {
+		if bytes.Equal(job.cid, c) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// CreateNamespace creates a namespace with its owner address. Namespace names are unique.
+func (m *MemDB) CreateNamespace(_ context.Context, name string, owner []byte) error {
+	if name == "" || len(name) > maxNamespaceLength {
+		return fmt.Errorf("invalid namespace name: %q", name)
+	}
+	if len(owner) == 0 {
+		return fmt.Errorf("missing namespace owner: %s", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.namespace(name) != nil {
+		return fmt.Errorf("namespace already exists: %s", name)
+	}
+	m.namespaces = append(m.namespaces, &memNamespace{
+		id:    m.nextID(),
+		name:  name,
+		owner: append([]byte(nil), owner...),
+	})
+
+	return nil
+}
+
+// newJob builds the row of a new job, it is not inserted. The namespace of the job must exist.
+func (m *MemDB) newJob(job JobInfo, rootCid []byte, now time.Time) (*memJob, error) {
+	pub, err := extractPub(job.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract table name: %v", err)
+	}
+	ns := m.namespace(pub.Namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("error while querying namespace: namespace not found: %s", pub.Namespace)
+	}
+
+	if _, err := hex.DecodeString(strings.TrimPrefix(job.Signature, "0x")); err != nil {
+		return nil, fmt.Errorf("decoding sign: %v", err)
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(job.Hash, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("decoding hash: %v", err)
+	}
+	if job.SubCid != "" {
+		if _, err := cid.Decode(job.SubCid); err != nil {
+			return nil, fmt.Errorf("decoding sub cid: %v", err)
+		}
+	}
+
+	var shards [][]byte
+	for _, shard := range job.Shards {
+		shardCid, err := cid.Decode(shard.Cid)
+		if err != nil {
+			return nil, fmt.Errorf("decoding shard cid: %v", err)
+		}
+		if shard.PieceCid != "" {
+			if _, err := cid.Decode(shard.PieceCid); err != nil {
+				return nil, fmt.Errorf("decoding shard piece cid: %v", err)
+			}
+		}
+		shards = append(shards, shardCid.Bytes())
+	}
+
+	cacheDuration := resolveCacheDuration(job.CacheDuration, m.cacheDuration(ns.id, pub.Relation),
+		m.cacheDuration(ns.id, NamespaceDefault))
+	var cachePath string
+	var expiresAt time.Time
+	if cacheDuration > 0 {
+		cachePath = job.FileName
+		expiresAt = now.Add(time.Minute * time.Duration(cacheDuration))
+	}
+
+	return &memJob{
+		nsID:            ns.id,
+		pub:             pub,
+		cid:             rootCid,
+		shards:          shards,
+		timestamp:       job.Timestamp,
+		cachePath:       cachePath,
+		expiresAt:       expiresAt,
+		hash:            hash,
+		bucket:          job.Bucket,
+		object:          job.FileName,
+		generation:      job.Generation,
+		info:            job,
+		status:          JobUploaded,
+		statusUpdatedAt: now,
+	}, nil
+}
+
+// cacheDuration returns the cache duration of the relation, or nil if it has no cache config.
+func (m *MemDB) cacheDuration(nsID int64, relation string) *int64 {
+	duration, ok := m.cacheConfigs[memRelationKey{nsID: nsID, relation: relation}]
+	if !ok {
+		return nil
+	}
+	return &duration
+}
+
+// insertJobs inserts new jobs, or none of them if one of them is for an object generation
+// that has a job already.
+func (m *MemDB) insertJobs(jobs []*memJob) error {
+	for i, job := range jobs {
+		for _, other := range append(m.jobs, jobs[:i]...) {
+			if other.bucket == job.bucket && other.object == job.object && other.generation == job.generation {
+				return ErrJobExists
+			}
+		}
+	}
+	for _, job := range jobs {
+		job.id = m.nextID()
+		m.jobs = append(m.jobs, job)
+	}
+	return nil
+}
+
+// CreateJob creates a new job.
+func (m *MemDB) CreateJob(_ context.Context, job JobInfo) error {
+	if job.PieceCid != "" {
+		if _, err := cid.Decode(job.PieceCid); err != nil {
+			return fmt.Errorf("failed to decode piece cid: %v", err)
+		}
+	}
+	rootCid, err := cid.Decode(job.Cid)
+	if err != nil {
+		return fmt.Errorf("failed to decode cid: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row, err := m.newJob(job, rootCid.Bytes(), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create new job: %v", err)
+	}
+
+	return m.insertJobs([]*memJob{row})
+}
+
+// UnfinishedJobs returns all the jobs that are not indexed yet, whether they are leased or not.
+func (m *MemDB) UnfinishedJobs(_ context.Context) ([]UnfinishedJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queryJobs(func(job *memJob) bool {
+		return job.status != JobIndexed
+	}), nil
+}
+
+// queryJobs returns the jobs that match the condition, with their shards.
+func (m *MemDB) queryJobs(match func(*memJob) bool) []UnfinishedJob {
+	var result []UnfinishedJob
+	for _, job := range m.jobs {
+		if !match(job) {
+			continue
+		}
+		var shards [][]byte
+		for _, shard := range job.shards {
+			shards = append(shards, append([]byte(nil), shard...))
+		}
+		result = append(result, UnfinishedJob{
+			Pub:       job.pub,
+			Cid:       append([]byte(nil), job.cid...),
+			Shards:    shards,
+			Status:    job.status,
+			Timestamp: job.timestamp,
+		})
+	}
+	return result
+}
+
+// UpdateJobStatus moves the jobs with the CID to the status of the transition, and records
+// the transition. It returns ErrInvalidJobTransition if a job cannot move to the status.
+func (m *MemDB) UpdateJobStatus(_ context.Context, c []byte, t JobTransition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := m.jobsByCid(c)
+	if len(jobs) == 0 {
+		return fmt.Errorf("failed to update job status: job not found: %x", c)
+	}
+	for _, job := range jobs {
+		if !job.status.CanTransition(t.Status) {
+			return fmt.Errorf("%w: from %s to %s", ErrInvalidJobTransition, job.status, t.Status)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, job := range jobs {
+		m.transitions = append(m.transitions, memTransition{
+			jobID:     job.id,
+			from:      job.status,
+			to:        t.Status,
+			err:       t.Error,
+			createdAt: now,
+		})
+		job.status, job.statusUpdatedAt = t.Status, now
+		if t.Status == JobDealsActive {
+			job.activated = t.Activation
+		}
+	}
+
+	return nil
+}
+
+// ClaimJobs leases up to limit unfinished jobs to the worker for the duration. Jobs leased
+// to other workers are skipped until their lease expires. The jobs that were checked the
+// longest ago are claimed first, the jobs of an aggregate are claimed together.
+func (m *MemDB) ClaimJobs(
+	_ context.Context,
+	worker string,
+	limit int,
+	duration time.Duration,
+) ([]UnfinishedJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	claimable := func(job *memJob) bool {
+		return job.status != JobIndexed && (job.leasedUntil.IsZero() || job.leasedUntil.Before(now))
+	}
+	var candidates []*memJob
+	for _, job := range m.jobs {
+		if claimable(job) {
+			candidates = append(candidates, job)
+		}
+	}
+	// never leased jobs first, then by end of their last lease, then by ID
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].leasedUntil, candidates[j].leasedUntil
+		if a.IsZero() != b.IsZero() {
+			return a.IsZero()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return candidates[i].id < candidates[j].id
+	})
+	if limit < len(candidates) {
+		candidates = candidates[:limit]
+	}
+
+	for _, candidate := range candidates {
+		for _, job := range m.jobsByCid(candidate.cid) {
+			if claimable(job) {
+				job.leaseOwner, job.leasedUntil = worker, now.Add(duration)
+			}
+		}
+	}
+
+	return m.queryJobs(func(job *memJob) bool {
+		return job.leaseOwner == worker && !job.leasedUntil.Before(now) && job.status != JobIndexed
+	}), nil
+}
+
+// RenewJobLease extends the lease of the jobs with the CID by the duration. It returns
+// ErrLeaseLost if they are not leased to the worker anymore.
+func (m *MemDB) RenewJobLease(_ context.Context, worker string, c []byte, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	renewed := false
+	for _, job := range m.jobsByCid(c) {
+		if job.leaseOwner == worker && !job.leasedUntil.Before(now) {
+			job.leasedUntil = now.Add(duration)
+			renewed = true
+		}
+	}
+	if !renewed {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseJobLease releases the jobs with the CID that are leased to the worker.
+func (m *MemDB) ReleaseJobLease(_ context.Context, worker string, c []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, job := range m.jobsByCid(c) {
+		if job.leaseOwner == worker {
+			job.leaseOwner, job.leasedUntil = "", now
+		}
+	}
+
+	return nil
+}
+
+// UpsertDeals records the deals reported by the deal provider for a file of the jobs with the CID.
+func (m *MemDB) UpsertDeals(_ context.Context, jobCid []byte, partCid []byte, deals []Deal) error {
+	pc, err := castCid(partCid)
+	if err != nil {
+		return fmt.Errorf("failed to upsert deals: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, job := range m.jobsByCid(jobCid) {
+		for _, d := range deals {
+			key := memDealKey{jobID: job.id, partCid: string(partCid), storageProvider: d.StorageProvider, dealID: d.DealID}
+			firstSeen := now
+			if existing, ok := m.deals[key]; ok {
+				firstSeen = existing.FirstSeen
+			}
+			m.deals[key] = &JobDeal{
+				Deal:      d,
+				JobID:     job.id,
+				Pub:       job.pub,
+				PartCid:   pc,
+				FirstSeen: firstSeen,
+				LastSeen:  now,
+			}
+		}
+	}
+
+	return nil
+}
+
+// PubDeals returns the deals of the jobs of a pub, by job.
+func (m *MemDB) PubDeals(_ context.Context, pub Pub) ([]JobDeal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deals []JobDeal
+	for _, d := range m.deals {
+		if d.Pub == pub {
+			deals = append(deals, *d)
+		}
+	}
+	sort.Slice(deals, func(i, j int) bool {
+		a, b := deals[i], deals[j]
+		if a.JobID != b.JobID {
+			return a.JobID < b.JobID
+		}
+		if c := bytes.Compare(a.PartCid.Bytes(), b.PartCid.Bytes()); c != 0 {
+			return c < 0
+		}
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		if a.StorageProvider != b.StorageProvider {
+			return a.StorageProvider < b.StorageProvider
+		}
+		return a.DealID < b.DealID
+	})
+
+	return deals, nil
+}
+
+// RecordTx records a tx that adds the CID of the jobs with the CID, before it is sent.
+func (m *MemDB) RecordTx(_ context.Context, jobCid []byte, tx OnchainTx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := m.jobsByCid(jobCid)
+	if len(jobs) == 0 {
+		return fmt.Errorf("job not found: %x", jobCid)
+	}
+	for _, job := range jobs {
+		for _, recorded := range m.txs {
+			if recorded.jobID == job.id && recorded.Hash == tx.Hash {
+				return fmt.Errorf("failed to record tx: tx already recorded: %s", tx.Hash)
+			}
+		}
+	}
+
+	tx.SubmittedAt = time.Now().UTC()
+	tx.Raw = append([]byte(nil), tx.Raw...)
+	for _, job := range jobs {
+		m.txs = append(m.txs, &memTx{OnchainTx: tx, jobID: job.id})
+	}
+
+	return nil
+}
+
+// UpdateTx updates the status and the receipt of a recorded tx.
+func (m *MemDB) UpdateTx(_ context.Context, tx OnchainTx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, recorded := range m.txs {
+		if recorded.Hash == tx.Hash {
+			recorded.Status, recorded.Error = tx.Status, tx.Error
+			recorded.BlockNumber, recorded.GasUsed, recorded.ReceiptAt = tx.BlockNumber, tx.GasUsed, tx.ReceiptAt
+		}
+	}
+
+	return nil
+}
+
+// LatestTx returns the last tx submitted for the jobs with the CID, or nil if none was submitted.
+func (m *MemDB) LatestTx(_ context.Context, jobCid []byte) (*OnchainTx, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest *memTx
+	for _, job := range m.jobsByCid(jobCid) {
+		for _, recorded := range m.txs {
+			if recorded.jobID == job.id && (latest == nil || !recorded.SubmittedAt.Before(latest.SubmittedAt)) {
+				latest = recorded
+			}
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	tx := latest.OnchainTx
+	tx.Raw = append([]byte(nil), tx.Raw...)
+
+	return &tx, nil
+}
+
+// ProvisionNamespace creates the namespace with the owner, unless it exists already.
+// The namespace is recorded as provisioned.
+func (m *MemDB) ProvisionNamespace(_ context.Context, name string, owner []byte) error {
+	if name == "" || len(name) > maxNamespaceLength {
+		return fmt.Errorf("failed to provision namespace: invalid namespace name: %q", name)
+	}
+	if len(owner) == 0 {
+		return fmt.Errorf("failed to provision namespace: missing namespace owner: %s", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.namespace(name) != nil {
+		return nil
+	}
+	m.namespaces = append(m.namespaces, &memNamespace{
+		id:            m.nextID(),
+		name:          name,
+		owner:         append([]byte(nil), owner...),
+		provisionedAt: time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// ProvisionPub records the pub as provisioned for the owner of its namespace, unless it is already.
+func (m *MemDB) ProvisionPub(_ context.Context, pub Pub) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(pub.Namespace)
+	if ns == nil {
+		return nil
+	}
+	key := memRelationKey{nsID: ns.id, relation: pub.Relation}
+	if _, ok := m.pubs[key]; ok {
+		return nil
+	}
+	m.pubs[key] = &ProvisionedPub{
+		Pub:           pub,
+		Owner:         append([]byte(nil), ns.owner...),
+		ProvisionedAt: time.Now().UTC(),
+	}
+
+	return nil
+}
+
+// ProvisionedPub returns the provisioning of the pub, or nil if the pub was not provisioned.
+func (m *MemDB) ProvisionedPub(_ context.Context, pub Pub) (*ProvisionedPub, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(pub.Namespace)
+	if ns == nil {
+		return nil, nil
+	}
+	provisioned, ok := m.pubs[memRelationKey{nsID: ns.id, relation: pub.Relation}]
+	if !ok {
+		return nil, nil
+	}
+	p := *provisioned
+	p.Owner = append([]byte(nil), p.Owner...)
+	p.Raw = append([]byte(nil), p.Raw...)
+
+	return &p, nil
+}
+
+// UpdateProvisionedPub updates the createPub tx of a provisioned pub, and when it was created.
+func (m *MemDB) UpdateProvisionedPub(_ context.Context, p ProvisionedPub) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(p.Pub.Namespace)
+	if ns == nil {
+		return nil
+	}
+	provisioned, ok := m.pubs[memRelationKey{nsID: ns.id, relation: p.Pub.Relation}]
+	if !ok {
+		return nil
+	}
+	provisioned.TxHash, provisioned.Raw = common.Hash{}, nil
+	if len(p.Raw) > 0 {
+		provisioned.TxHash, provisioned.Raw = p.TxHash, append([]byte(nil), p.Raw...)
+	}
+	provisioned.CreatedAt = p.CreatedAt
+
+	return nil
+}
+
+// RejectUpload records an object generation that was refused by the uploader.
+func (m *MemDB) RejectUpload(
+	_ context.Context,
+	bucket string,
+	fname string,
+	generation int64,
+	hash string,
+	reason string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rejections = append(m.rejections, memRejection{
+		bucket:     bucket,
+		path:       fname,
+		generation: generation,
+		hash:       hash,
+		reason:     reason,
+		createdAt:  time.Now().UTC(),
+	})
+
+	return nil
+}
+
+// RejectionExists tells whether the object generation was already refused by the uploader.
+func (m *MemDB) RejectionExists(_ context.Context, bucket string, fname string, generation int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.rejections {
+		if r.bucket == bucket && r.path == fname && r.generation == generation {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// NamespaceOwner returns the owner address of the namespace.
+func (m *MemDB) NamespaceOwner(_ context.Context, name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(name)
+	if ns == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNamespaceNotFound, name)
+	}
+
+	return append([]byte(nil), ns.owner...), nil
+}
+
+// IsNamespaceOwner tells whether the address owns any namespace.
+func (m *MemDB) IsNamespaceOwner(_ context.Context, owner []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ns := range m.namespaces {
+		if bytes.Equal(ns.owner, owner) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// NamespaceKeyRef returns the reference of the encryption key of the namespace,
+// or an empty string if the namespace does not encrypt its files.
+func (m *MemDB) NamespaceKeyRef(_ context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(name)
+	if ns == nil {
+		return "", fmt.Errorf("failed to query namespace key ref: namespace not found: %s", name)
+	}
+
+	return ns.keyRef, nil
+}
+
+// SetNamespaceKeyRef sets the reference of the encryption key of the namespace.
+func (m *MemDB) SetNamespaceKeyRef(_ context.Context, name string, ref string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(name)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", name)
+	}
+	ns.keyRef = ref
+
+	return nil
+}
+
+// JobExists returns true if a job was already created for the object generation.
+func (m *MemDB) JobExists(_ context.Context, bucket string, fname string, generation int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.bucket == bucket && job.object == fname && job.generation == generation {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// JobExistsByHash tells whether a job archived content with the hash, whatever its object.
+func (m *MemDB) JobExistsByHash(_ context.Context, hash string) (bool, error) {
+	hashBytes, err := hex.DecodeString(strings.TrimPrefix(hash, "0x"))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode hash: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if bytes.Equal(job.hash, hashBytes) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// FailedUpload returns the failed upload of the object, or nil if its last upload did not fail.
+func (m *MemDB) FailedUpload(_ context.Context, bucket string, fname string) (*FailedUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.failures[memObjectKey{bucket: bucket, object: fname}]
+	if !ok {
+		return nil, nil
+	}
+
+	return &f, nil
+}
+
+// RecordFailedUpload inserts or replaces the failed upload of an object.
+func (m *MemDB) RecordFailedUpload(_ context.Context, f FailedUpload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[memObjectKey{bucket: f.Bucket, object: f.Object}] = f
+
+	return nil
+}
+
+// ResolveFailedUpload removes the failed upload of an object, after it was uploaded.
+func (m *MemDB) ResolveFailedUpload(_ context.Context, bucket string, fname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.failures, memObjectKey{bucket: bucket, object: fname})
+
+	return nil
+}
+
+// FailedUploadsDue returns the failed uploads that are not permanent and due for a retry.
+func (m *MemDB) FailedUploadsDue(_ context.Context, now time.Time, limit int) ([]FailedUpload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []FailedUpload
+	for _, f := range m.failures {
+		if !f.Permanent && !f.NextAttemptAt.After(now) {
+			result = append(result, f)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].NextAttemptAt.Before(result[j].NextAttemptAt)
+	})
+	if limit < len(result) {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// CacheConfigs returns the cache configs of a namespace, including its default.
+func (m *MemDB) CacheConfigs(_ context.Context, name string) ([]CacheConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(name)
+	if ns == nil {
+		return nil, nil
+	}
+	var result []CacheConfig
+	for key, duration := range m.cacheConfigs {
+		if key.nsID == ns.id {
+			result = append(result, CacheConfig{Namespace: ns.name, Relation: key.relation, Duration: duration})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Relation < result[j].Relation
+	})
+
+	return result, nil
+}
+
+// SetCacheConfig inserts or replaces the cache config of a relation, or of a namespace
+// when the relation is NamespaceDefault.
+func (m *MemDB) SetCacheConfig(_ context.Context, c CacheConfig) error {
+	if c.Duration < 0 {
+		return fmt.Errorf("cache duration must not be negative: %d", c.Duration)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns := m.namespace(c.Namespace)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", c.Namespace)
+	}
+	m.cacheConfigs[memRelationKey{nsID: ns.id, relation: c.Relation}] = c.Duration
+
+	return nil
+}
+
+// DeleteCacheConfig removes the cache config of a relation, or of a namespace
+// when the relation is NamespaceDefault.
+func (m *MemDB) DeleteCacheConfig(_ context.Context, name string, relation string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ns := m.namespace(name); ns != nil {
+		delete(m.cacheConfigs, memRelationKey{nsID: ns.id, relation: relation})
+	}
+
+	return nil
+}
+
+// ExpiredJobs returns the jobs with a cached object whose cache expired.
+func (m *MemDB) ExpiredJobs(_ context.Context, now time.Time, limit int) ([]ExpiredJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []ExpiredJob
+	for _, job := range m.jobs {
+		if job.cachePath != "" && !job.expiresAt.After(now) {
+			result = append(result, ExpiredJob{
+				ID:         job.id,
+				Bucket:     job.bucket,
+				CachePath:  job.cachePath,
+				Generation: job.generation,
+				ExpiresAt:  job.expiresAt,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+	})
+	if limit < len(result) {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// ClearCachePath removes the cache path of a job, after its cached object was deleted.
+func (m *MemDB) ClearCachePath(_ context.Context, jobID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.id == jobID {
+			job.cachePath = ""
+		}
+	}
+
+	return nil
+}
+
+// MarkSourceDeleted marks the jobs of an object generation as source deleted, and clears
+// their cache fields. Pending aggregates of the generation are removed. A zero generation
+// matches every generation of the object. It returns the number of jobs that were marked.
+func (m *MemDB) MarkSourceDeleted(_ context.Context, bucket string, fname string, generation int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	var marked int64
+	for _, job := range m.jobs {
+		if job.bucket != bucket || job.object != fname || !job.sourceDeletedAt.IsZero() {
+			continue
+		}
+		if generation != 0 && job.generation != generation {
+			continue
+		}
+		job.sourceDeletedAt, job.cachePath, job.expiresAt = now, "", time.Time{}
+		marked++
+	}
+	for key := range m.pending {
+		if key.bucket == bucket && key.object == fname && (generation == 0 || key.generation == generation) {
+			delete(m.pending, key)
+		}
+	}
+
+	return marked, nil
+}
+
+// AddPendingAggregate queues a verified small object for aggregation.
+func (m *MemDB) AddPendingAggregate(_ context.Context, job JobInfo, size int64) error {
+	if _, err := extractPub(job.FileName); err != nil {
+		return fmt.Errorf("failed to extract pub: %v", err)
+	}
+	// the job is stored encoded, as in the JSONB column of the table
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %v", err)
+	}
+	var stored JobInfo
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to decode job: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memGenerationKey{bucket: job.Bucket, object: job.FileName, generation: job.Generation}
+	createdAt := time.Now().UTC()
+	if existing, ok := m.pending[key]; ok {
+		createdAt = existing.CreatedAt
+	}
+	m.pending[key] = PendingAggregate{Job: stored, Size: size, CreatedAt: createdAt}
+
+	return nil
+}
+
+// PendingAggregates returns the objects waiting for aggregation, the oldest first.
+func (m *MemDB) PendingAggregates(_ context.Context, limit int) ([]PendingAggregate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []PendingAggregate
+	for _, p := range m.pending {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	if limit < len(result) {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// DeletePendingAggregate removes an object from the objects waiting for aggregation.
+func (m *MemDB) DeletePendingAggregate(_ context.Context, bucket string, fname string, generation int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pending, memGenerationKey{bucket: bucket, object: fname, generation: generation})
+
+	return nil
+}
+
+// CreateAggregate creates the jobs of the objects of an aggregate, and removes the objects
+// from the objects waiting for aggregation. Either all the jobs are created, or none.
+func (m *MemDB) CreateAggregate(_ context.Context, jobs []JobInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	rows := make([]*memJob, 0, len(jobs))
+	for _, job := range jobs {
+		rootCid, err := cid.Decode(job.Cid)
+		if err != nil {
+			return fmt.Errorf("failed to create aggregate jobs: failed to decode cid: %v", err)
+		}
+		if _, err := cid.Decode(job.PieceCid); err != nil {
+			return fmt.Errorf("failed to create aggregate jobs: failed to decode piece cid: %v", err)
+		}
+		row, err := m.newJob(job, rootCid.Bytes(), now)
+		if err != nil {
+			return fmt.Errorf("failed to create aggregate jobs: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := m.insertJobs(rows); err != nil {
+		return fmt.Errorf("failed to create aggregate jobs: %v", err)
+	}
+	for _, job := range jobs {
+		delete(m.pending, memGenerationKey{bucket: job.Bucket, object: job.FileName, generation: job.Generation})
+	}
+
+	return nil
+}
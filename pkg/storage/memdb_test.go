@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemDBJobs(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemDB()
+
+	job := JobInfo{
+		Cid:        getCIDFromBytes([]byte("data for myfile")).String(),
+		Bucket:     "mybucket",
+		FileName:   "testns/testrel/export.parquet",
+		Generation: 1,
+		Hash:       "0xabcd",
+	}
+
+	// a job needs its namespace
+	assert.Error(t, db.CreateJob(ctx, job))
+	require.NoError(t, db.CreateNamespace(ctx, "testns", testOwner()))
+	assert.Error(t, db.CreateNamespace(ctx, "testns", testOwner()))
+	owner, err := db.NamespaceOwner(ctx, "testns")
+	require.NoError(t, err)
+	assert.Equal(t, testOwner(), owner)
+
+	// the cache duration of a new job comes from the cache config of its relation
+	require.NoError(t, db.SetCacheConfig(ctx, CacheConfig{Namespace: "testns", Relation: "testrel", Duration: 10}))
+	assert.Error(t, db.SetCacheConfig(ctx, CacheConfig{Namespace: "otherns", Relation: "testrel", Duration: 10}))
+	require.NoError(t, db.CreateJob(ctx, job))
+	expired, err := db.ExpiredJobs(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, job.FileName, expired[0].CachePath)
+
+	// an object generation has a single job
+	assert.ErrorIs(t, db.CreateJob(ctx, job), ErrJobExists)
+	exists, err := db.JobExists(ctx, "mybucket", job.FileName, 1)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = db.JobExistsByHash(ctx, "abcd")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// the jobs of an aggregate are all created, or none of them
+	aggregated := []JobInfo{job, job}
+	for i := range aggregated {
+		aggregated[i].Generation = 2
+		aggregated[i].PieceCid = job.Cid
+	}
+	assert.Error(t, db.CreateAggregate(ctx, aggregated))
+	exists, err = db.JobExists(ctx, "mybucket", job.FileName, 2)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// the deleted objects lose their cache
+	marked, err := db.MarkSourceDeleted(ctx, "mybucket", job.FileName, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), marked)
+	expired, err = db.ExpiredJobs(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func TestMemDBJobStatus(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemDB()
+	require.NoError(t, db.CreateNamespace(ctx, "testns", testOwner()))
+	jobCid := getCIDFromBytes([]byte("data for myfile"))
+	require.NoError(t, db.CreateJob(ctx, JobInfo{
+		Cid:        jobCid.String(),
+		Bucket:     "mybucket",
+		FileName:   "testns/testrel/export.parquet",
+		Generation: 1,
+	}))
+
+	// the transitions are enforced
+	assert.ErrorIs(t, db.UpdateJobStatus(ctx, jobCid.Bytes(), JobTransition{Status: JobIndexed}), ErrInvalidJobTransition)
+	require.NoError(t, db.UpdateJobStatus(ctx, jobCid.Bytes(), JobTransition{Status: JobDealsActive}))
+
+	// a claimed job is leased to the checker until it is released
+	claimed, err := db.ClaimJobs(ctx, "checker", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, JobDealsActive, claimed[0].Status)
+	claimed, err = db.ClaimJobs(ctx, "other", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	assert.ErrorIs(t, db.RenewJobLease(ctx, "other", jobCid.Bytes(), time.Minute), ErrLeaseLost)
+	require.NoError(t, db.RenewJobLease(ctx, "checker", jobCid.Bytes(), time.Minute))
+	require.NoError(t, db.ReleaseJobLease(ctx, "checker", jobCid.Bytes()))
+	claimed, err = db.ClaimJobs(ctx, "other", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	// txs are recorded for existing jobs only
+	tx := OnchainTx{Hash: common.HexToHash("0x01"), Raw: []byte{1}, Status: TxPending}
+	assert.Error(t, db.RecordTx(ctx, getCIDFromBytes([]byte("data for myfile2")).Bytes(), tx))
+	require.NoError(t, db.RecordTx(ctx, jobCid.Bytes(), tx))
+	assert.Error(t, db.RecordTx(ctx, jobCid.Bytes(), tx))
+	tx.Status, tx.BlockNumber = TxSuccess, 10
+	require.NoError(t, db.UpdateTx(ctx, tx))
+	latest, err := db.LatestTx(ctx, jobCid.Bytes())
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, TxSuccess, latest.Status)
+	assert.Equal(t, uint64(10), latest.BlockNumber)
+
+	// indexed jobs are finished
+	require.NoError(t, db.UpdateJobStatus(ctx, jobCid.Bytes(), JobTransition{Status: JobTxSubmitted}))
+	require.NoError(t, db.UpdateJobStatus(ctx, jobCid.Bytes(), JobTransition{Status: JobIndexed}))
+	jobs, err := db.UnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestMemDBEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	path := filepath.Join(dir, "store", "mybucket", filepath.FromSlash(fname))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, mockParquet(), 0o600))
+	metadata := `{"timestamp": "1700248832", "hash": "` + mockParquetHash() + `", "signature": "` +
+		signHash(testOwnerKey(), mockParquetHash(), SignatureRaw) + `"}`
+	require.NoError(t, os.WriteFile(path+".metadata.json", []byte(metadata), 0o600))
+
+	// the uploader and the checker share the in-memory database of the same name
+	conn := "memory://" + t.Name() + "?namespace=foo.bar.baz:" + common.BytesToAddress(testOwner()).Hex()
+	event := []byte(`{"bucket": "mybucket", "name": "` + fname + `"}`)
+	uploader, err := NewFileUploader(ctx, event, &UploaderConfig{
+		ObjectStoreConfig:  ObjectStoreConfig{Store: ObjectStoreLocal, LocalStoreDir: filepath.Join(dir, "store")},
+		DealProviderConfig: DealProviderConfig{Provider: DealProviderLocal, LocalDir: filepath.Join(dir, "deals")},
+		CrdbConn:           conn,
+	})
+	require.NoError(t, err)
+	require.NoError(t, uploader.HandleEvent(ctx, EventTypeFinalized))
+
+	db, err := NewCrdb(conn)
+	require.NoError(t, err)
+	assert.Same(t, uploader.DBClient, db)
+
+	bsc := &MockBasinStorage{
+		cids: []string{},
+	}
+	sc := StatusChecker{
+		StatusClient:   uploader.DealClient,
+		DBClient:       db,
+		contractClient: bsc,
+	}
+	require.NoError(t, sc.ProcessJobs(ctx))
+
+	// the local provider reports an active deal, the job is indexed
+	require.Len(t, bsc.cids, 1)
+	jobs, err := db.UnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	deals, err := db.PubDeals(ctx, Pub{Namespace: "foo.bar.baz", Relation: "relname"})
+	require.NoError(t, err)
+	assert.Len(t, deals, 1)
+}
+
+// addTestJobs creates the jobs in the MemDB, in namespaces owned by testOwner that are created when
+// missing, and moves each job to its status and activation without the checks of UpdateJobStatus.
+func addTestJobs(t *testing.T, db *MemDB, jobs ...UnfinishedJob) {
+	ctx := context.Background()
+	for _, job := range jobs {
+		if _, err := db.NamespaceOwner(ctx, job.Pub.Namespace); errors.Is(err, ErrNamespaceNotFound) {
+			require.NoError(t, db.CreateNamespace(ctx, job.Pub.Namespace, testOwner()))
+		}
+
+		db.mu.Lock()
+		generation := int64(len(db.jobs) + 1)
+		db.mu.Unlock()
+		info := JobInfo{
+			Cid:        cid.MustParse(job.Cid).String(),
+			Bucket:     "mybucket",
+			FileName:   fmt.Sprintf("%s/%s/%d.parquet", job.Pub.Namespace, job.Pub.Relation, generation),
+			Generation: generation,
+			Timestamp:  job.Timestamp,
+		}
+		for i, shard := range job.Shards {
+			info.Shards = append(info.Shards, ShardInfo{ShardRef: ShardRef{Index: i, Cid: cid.MustParse(shard).String()}})
+		}
+		require.NoError(t, db.CreateJob(ctx, info))
+
+		if job.Status != "" {
+			setTestJobStatus(db, job.Cid, job.Status)
+		}
+		db.mu.Lock()
+		db.jobs[len(db.jobs)-1].activated = job.Activated
+		db.mu.Unlock()
+	}
+}
+
+// setTestJobStatus moves the jobs with the CID to the status, without the checks of UpdateJobStatus.
+func setTestJobStatus(db *MemDB, c []byte, status JobStatus) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, job := range db.jobsByCid(c) {
+		job.status = status
+	}
+}
+
+// testJobs returns the jobs of the MemDB in the order they were created,
+// with their status, activation and cached object.
+func testJobs(db *MemDB) []UnfinishedJob {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	jobs := make([]UnfinishedJob, len(db.jobs))
+	for i, job := range db.jobs {
+		jobs[i] = UnfinishedJob{
+			Pub:       job.pub,
+			Cid:       job.cid,
+			Shards:    job.shards,
+			Status:    job.status,
+			Activated: job.activated,
+			Timestamp: job.timestamp,
+			CachePath: job.cachePath,
+			ExpiresAt: job.expiresAt,
+		}
+	}
+	return jobs
+}
+
+// createdJobs returns the jobs of the MemDB as they were created, in order.
+func createdJobs(db *MemDB) []JobInfo {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var jobs []JobInfo
+	for _, job := range db.jobs {
+		jobs = append(jobs, job.info)
+	}
+	return jobs
+}
+
+// testTxs returns the txs submitted for the jobs with the CID, in order.
+func testTxs(db *MemDB, c []byte) []OnchainTx {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var txs []OnchainTx
+	for _, tx := range db.txs {
+		for _, job := range db.jobsByCid(c) {
+			if tx.jobID == job.id {
+				txs = append(txs, tx.OnchainTx)
+				break
+			}
+		}
+	}
+	return txs
+}
+
+// rejectedPaths returns the paths of the rejected objects, in order.
+func rejectedPaths(db *MemDB) []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var paths []string
+	for _, r := range db.rejections {
+		paths = append(paths, r.path)
+	}
+	return paths
+}
+
+// newTestMemDB creates a MemDB with the namespaces, owned by testOwner.
+func newTestMemDB(t *testing.T, namespaces ...string) *MemDB {
+	db := NewMemDB()
+	for _, ns := range namespaces {
+		require.NoError(t, db.CreateNamespace(context.Background(), ns, testOwner()))
+	}
+	return db
+}
+
+// testFailedUpload returns the failed upload of the object of mybucket, or nil when it has none.
+func testFailedUpload(t *testing.T, db *MemDB, fname string) *FailedUpload {
+	f, err := db.FailedUpload(context.Background(), "mybucket", fname)
+	require.NoError(t, err)
+	return f
+}
+
+// deletedJobs returns the jobs of the MemDB whose source was deleted, as they were created, in order.
+func deletedJobs(db *MemDB) []JobInfo {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var jobs []JobInfo
+	for _, job := range db.jobs {
+		if !job.sourceDeletedAt.IsZero() {
+			jobs = append(jobs, job.info)
+		}
+	}
+	return jobs
+}
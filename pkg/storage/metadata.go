@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Metadata keys set by the exporter on every uploaded object.
+const (
+	MetadataHash          = "hash"
+	MetadataSignature     = "signature"
+	MetadataTimestamp     = "timestamp"
+	MetadataCacheDuration = "cache_duration"
+)
+
+// hashLength is the length in bytes of the digest in the `hash` metadata.
+// Both supported hash algorithms produce 32 bytes digests.
+const hashLength = 32
+
+// maxTimestamp is the last second of the year 9999. Larger timestamps are not in seconds.
+const maxTimestamp = 253402300799
+
+// UploadMetadata is the validated metadata of an uploaded object.
+type UploadMetadata struct {
+	// Hash is the hex encoded digest of the object content.
+	Hash string
+	// Signature is the hex encoded signature over the hash, made by the namespace owner.
+	Signature string
+	// Timestamp is the Unix time in seconds of the export, nil when it is missing.
+	Timestamp *int64
+	// CacheDuration is the number of minutes the object stays in cache, zero disables caching.
+	// It is nil when it is missing, and the cache config of the relation applies.
+	CacheDuration *int64
+}
+
+// MetadataError is returned when the metadata of an object is invalid.
+// It lists every problem found, not only the first one.
+type MetadataError struct {
+	Problems []string
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("invalid metadata: %s", strings.Join(e.Problems, "; "))
+}
+
+// ParseUploadMetadata parses and validates the metadata of an uploaded object.
+// The hash and the signature are required, the timestamp and the cache duration are optional.
+func ParseUploadMetadata(metadata map[string]string) (*UploadMetadata, error) {
+	var m UploadMetadata
+	var problems []string
+
+	m.Hash = metadata[MetadataHash]
+	if err := checkHex(m.Hash, hashLength); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", MetadataHash, err))
+	}
+
+	m.Signature = metadata[MetadataSignature]
+	if err := checkHex(m.Signature, crypto.SignatureLength); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", MetadataSignature, err))
+	}
+
+	if value, ok := metadata[MetadataTimestamp]; ok {
+		timestamp, err := parseTimestamp(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", MetadataTimestamp, err))
+		} else {
+			m.Timestamp = &timestamp
+		}
+	}
+
+	if value, ok := metadata[MetadataCacheDuration]; ok {
+		duration, err := strconv.ParseInt(value, 10, 64)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: failed to parse duration: %v", MetadataCacheDuration, err))
+		case duration < 0:
+			problems = append(problems, fmt.Sprintf("%s: must not be negative, got %d", MetadataCacheDuration, duration))
+		default:
+			m.CacheDuration = &duration
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &MetadataError{Problems: problems}
+	}
+
+	return &m, nil
+}
+
+// checkHex checks that s is the hex encoding of size bytes, with an optional 0x prefix.
+func checkHex(s string, size int) error {
+	if s == "" {
+		return fmt.Errorf("is missing")
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return fmt.Errorf("failed to decode hex: %v", err)
+	}
+	if len(b) != size {
+		return fmt.Errorf("expected %d bytes, got %d", size, len(b))
+	}
+	return nil
+}
+
+// parseTimestamp parses a Unix time in seconds.
+// Timestamps in milliseconds, microseconds or nanoseconds are refused with a hint of their unit.
+func parseTimestamp(value string) (int64, error) {
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse timestamp: %v", err)
+	}
+	if timestamp < 0 {
+		return 0, fmt.Errorf("must not be negative, got %d", timestamp)
+	}
+	if timestamp > maxTimestamp {
+		unit := "nanoseconds"
+		switch {
+		case timestamp/1e3 <= maxTimestamp:
+			unit = "milliseconds"
+		case timestamp/1e6 <= maxTimestamp:
+			unit = "microseconds"
+		}
+		return 0, fmt.Errorf("must be in seconds, %d looks like %s", timestamp, unit)
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	hash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	sign := signHash(testOwnerKey(), hash, SignatureRaw)
+
+	m, err := ParseUploadMetadata(map[string]string{
+		"hash":           "0x" + hash,
+		"signature":      sign,
+		"timestamp":      "1700248832",
+		"cache_duration": "100",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0x"+hash, m.Hash)
+	assert.Equal(t, sign, m.Signature)
+	assert.Equal(t, int64(1700248832), *m.Timestamp)
+	assert.Equal(t, int64(100), *m.CacheDuration)
+
+	// timestamp and cache duration are optional
+	m, err = ParseUploadMetadata(map[string]string{"hash": hash, "signature": sign})
+	require.NoError(t, err)
+	assert.Nil(t, m.Timestamp)
+	assert.Nil(t, m.CacheDuration)
+}
+
+func TestParseUploadMetadataProblems(t *testing.T) {
+	hash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	sign := signHash(testOwnerKey(), hash, SignatureRaw)
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		problems []string
+	}{
+		{
+			name:     "missing",
+			metadata: map[string]string{},
+			problems: []string{"hash: is missing", "signature: is missing"},
+		},
+		{
+			name:     "hex",
+			metadata: map[string]string{"hash": "xyz", "signature": sign[:20]},
+			problems: []string{"hash: failed to decode hex", "signature: expected 65 bytes, got 10"},
+		},
+		{
+			name:     "milliseconds",
+			metadata: map[string]string{"hash": hash, "signature": sign, "timestamp": "1700248832000"},
+			problems: []string{"timestamp: must be in seconds, 1700248832000 looks like milliseconds"},
+		},
+		{
+			name:     "microseconds",
+			metadata: map[string]string{"hash": hash, "signature": sign, "timestamp": "1700248832000000"},
+			problems: []string{"timestamp: must be in seconds, 1700248832000000 looks like microseconds"},
+		},
+		{
+			name:     "nanoseconds",
+			metadata: map[string]string{"hash": hash, "signature": sign, "timestamp": "1700248832000000000"},
+			problems: []string{"timestamp: must be in seconds, 1700248832000000000 looks like nanoseconds"},
+		},
+		{
+			name: "all",
+			metadata: map[string]string{
+				"hash":           hash[:62],
+				"signature":      sign,
+				"timestamp":      "-1",
+				"cache_duration": "1h",
+			},
+			problems: []string{
+				"hash: expected 32 bytes, got 31",
+				"timestamp: must not be negative, got -1",
+				"cache_duration: failed to parse duration",
+			},
+		},
+		{
+			name:     "negative duration",
+			metadata: map[string]string{"hash": hash, "signature": sign, "cache_duration": "-5"},
+			problems: []string{"cache_duration: must not be negative, got -5"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseUploadMetadata(tc.metadata)
+			var metadataErr *MetadataError
+			require.True(t, errors.As(err, &metadataErr))
+			require.Len(t, metadataErr.Problems, len(tc.problems))
+			for i, problem := range tc.problems {
+				assert.True(t, strings.HasPrefix(metadataErr.Problems[i], problem), metadataErr.Problems[i])
+			}
+		})
+	}
+}
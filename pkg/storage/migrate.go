@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// migrationsFS holds the versioned migrations of the schema, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// undefinedTable is the SQLSTATE of a query on a table that does not exist.
+const undefinedTable = "42P01"
+
+// Migration is a versioned change of the schema, and the change that reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Reversible tells whether the migration can be reverted. An irreversible migration
+// has a down file without statements, e.g. only a comment telling why.
+func (m Migration) Reversible() bool {
+	for _, line := range strings.Split(m.Down, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrationStatus tells whether a migration was applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrations returns the migrations embedded in the module, by version.
+func Migrations() ([]Migration, error) {
+	return parseMigrations(migrationsFS, "migrations")
+}
+
+// SchemaVersion returns the version of the schema the code expects, the version of the last migration.
+func SchemaVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// parseMigrations reads the migrations of the directory. Versions must start
+// at 1 and follow each other, and each migration must have an up and a down file.
+func parseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		fname := entry.Name()
+		base, direction, ok := cutSQLDirection(fname)
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", fname)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid migration file name: %s", fname)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", fname)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, fname))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration: %v", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// cutSQLDirection splits a migration file name into its base and its direction.
+func cutSQLDirection(fname string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		if base, ok := strings.CutSuffix(fname, "."+direction+".sql"); ok {
+			return base, direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Migrator applies and reverts the migrations of the schema.
+// The applied versions are recorded in the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// NewMigrator creates a Migrator of the embedded migrations.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		DB:         db,
+		Migrations: migrations,
+	}, nil
+}
+
+// Version returns the version of the database schema, 0 if no migration was applied.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	return schemaVersion(ctx, m.DB)
+}
+
+// Status returns every migration, and whether it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		statuses[i] = MigrationStatus{
+			Migration: migration,
+			Applied:   migration.Version <= version,
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies the migrations that were not applied yet, and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.Migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := m.apply(ctx, migration.Up,
+			"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+			migration.Version, migration.Name); err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d: %v", migration.Version, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down reverts up to steps of the applied migrations, latest first, and returns them.
+// It stops at the first irreversible migration, which is never reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := m.Migrations[i]
+		if migration.Version > version {
+			continue
+		}
+		if !migration.Reversible() {
+			return reverted, fmt.Errorf("migration %d is irreversible", migration.Version)
+		}
+		if err := m.apply(ctx, migration.Down,
+			"DELETE FROM schema_migrations WHERE version = $1",
+			migration.Version); err != nil {
+			return reverted, fmt.Errorf("failed to revert migration %d: %v", migration.Version, err)
+		}
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// apply runs the statements of a migration, and records it, in a single transaction.
+func (m *Migrator) apply(ctx context.Context, statements string, record string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning tx")
+	}
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "executing migration")
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "recording migration")
+	}
+	return errors.Wrap(tx.Commit(), "committing tx")
+}
+
+func (m *Migrator) createVersionTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	return nil
+}
+
+// schemaVersion returns the version of the database schema, 0 if no migration was applied.
+func schemaVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	var version int64
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == undefinedTable {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query schema version: %v", err)
+	}
+	return version, nil
+}
+
+// checkSchemaVersion returns an error if the version of the database schema
+// is not the version the code expects.
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	expected, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version != expected {
+		return fmt.Errorf("schema version is %d, expected %d, run the migrations", version, expected)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	// the embedded migrations are valid
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	version, err := SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].Version, version)
+
+	fsys := fstest.MapFS{
+		"m/0002_add_deals.up.sql":   {Data: []byte("CREATE TABLE deals ()")},
+		"m/0002_add_deals.down.sql": {Data: []byte("DROP TABLE deals")},
+		"m/0001_initial.up.sql":     {Data: []byte("CREATE TABLE jobs ()")},
+		"m/0001_initial.down.sql":   {Data: []byte("DROP TABLE jobs")},
+	}
+	migrations, err = parseMigrations(fsys, "m")
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "initial", Up: "CREATE TABLE jobs ()", Down: "DROP TABLE jobs"},
+		{Version: 2, Name: "add_deals", Up: "CREATE TABLE deals ()", Down: "DROP TABLE deals"},
+	}, migrations)
+
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_initial.up.sql": {Data: []byte("CREATE TABLE jobs ()")},
+		},
+		"missing version": {
+			"m/0002_add_deals.up.sql":   {Data: []byte("CREATE TABLE deals ()")},
+			"m/0002_add_deals.down.sql": {Data: []byte("DROP TABLE deals")},
+		},
+		"two names": {
+			"m/0001_initial.up.sql": {Data: []byte("CREATE TABLE jobs ()")},
+			"m/0001_init.down.sql":  {Data: []byte("DROP TABLE jobs")},
+		},
+		"invalid name": {
+			"m/initial.up.sql": {Data: []byte("CREATE TABLE jobs ()")},
+		},
+		"not sql": {
+			"m/0001_initial.up.txt": {Data: []byte("CREATE TABLE jobs ()")},
+		},
+	}
+	for name, fsys := range tests {
+		_, err := parseMigrations(fsys, "m")
+		assert.Error(t, err, name)
+	}
+
+	// the initial migration creates the tables of databases that predate the migrations, it is never reverted
+	assert.False(t, Migration{Down: "-- irreversible\n\n"}.Reversible())
+	assert.True(t, Migration{Down: "-- reverts\nDROP TABLE jobs"}.Reversible())
+	migrations, err = Migrations()
+	require.NoError(t, err)
+	assert.False(t, migrations[0].Reversible())
+	for _, m := range migrations[1:] {
+		assert.True(t, m.Reversible(), m.Name)
+	}
+}
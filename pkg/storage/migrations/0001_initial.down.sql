@@ -0,0 +1,2 @@
+-- Irreversible: the tables of the initial schema may predate the migrations and hold
+-- their data, they are never dropped.
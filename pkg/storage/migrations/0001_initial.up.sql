@@ -0,0 +1,37 @@
+-- The schema of the databases created before the migrations. The tables are created
+-- only if they do not exist, so that those databases are brought under the migrations,
+-- every later change of the schema is made by the following migrations.
+CREATE TABLE IF NOT EXISTS namespaces
+(
+	id     BIGSERIAL   PRIMARY KEY,
+	name   VARCHAR(32) UNIQUE NOT NULL,
+	owner  BYTEA NOT NULL,
+	last_export TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS jobs
+(
+	id BIGSERIAL PRIMARY KEY,
+	ns_id BIGINT,
+	cid BYTEA NOT NULL,
+	relation TEXT NOT NULL,
+	activated TIMESTAMP,
+	timestamp BIGINT,
+	cache_path TEXT,
+	expires_at TIMESTAMP,
+	signature bytea,
+	hash bytea,
+	CONSTRAINT fk_namespace
+	FOREIGN KEY(ns_id)
+	REFERENCES namespaces(id)
+);
+
+CREATE TABLE IF NOT EXISTS cache_config
+(
+	ns_id BIGINT NOT NULL,
+	relation TEXT NOT NULL,
+	duration BIGINT,
+	CONSTRAINT fk_namespace
+	FOREIGN KEY(ns_id)
+	REFERENCES namespaces(id)
+);
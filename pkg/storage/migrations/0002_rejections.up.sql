@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS rejections
+(
+	id BIGSERIAL PRIMARY KEY,
+	path TEXT NOT NULL,
+	hash TEXT,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now()
+);
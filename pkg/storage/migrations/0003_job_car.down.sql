@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS piece_cid;
+ALTER TABLE jobs DROP COLUMN IF EXISTS car_size;
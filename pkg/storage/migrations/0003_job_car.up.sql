@@ -0,0 +1,2 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS car_size BIGINT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS piece_cid BYTEA;
@@ -0,0 +1,3 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS generation;
+ALTER TABLE jobs DROP COLUMN IF EXISTS object;
+ALTER TABLE jobs DROP COLUMN IF EXISTS bucket;
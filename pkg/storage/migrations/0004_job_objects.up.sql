@@ -0,0 +1,3 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS bucket TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS object TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS generation BIGINT;
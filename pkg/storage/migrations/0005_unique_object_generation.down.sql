@@ -0,0 +1 @@
+DROP INDEX IF EXISTS jobs@unique_object_generation CASCADE;
@@ -0,0 +1,3 @@
+-- The columns are added by the previous migration, they can only be used once
+-- that migration is committed. Jobs created before it have no object, they never conflict.
+ALTER TABLE jobs ADD CONSTRAINT unique_object_generation UNIQUE (bucket, object, generation);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_shards
+(
+	job_id BIGINT NOT NULL,
+	idx INT NOT NULL,
+	cid BYTEA NOT NULL,
+	byte_offset BIGINT NOT NULL,
+	size BIGINT NOT NULL,
+	car_size BIGINT,
+	piece_cid BYTEA,
+	PRIMARY KEY (job_id, idx),
+	CONSTRAINT fk_job
+	FOREIGN KEY(job_id)
+	REFERENCES jobs(id)
+);
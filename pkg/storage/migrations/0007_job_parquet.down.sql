@@ -0,0 +1,3 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS num_row_groups;
+ALTER TABLE jobs DROP COLUMN IF EXISTS num_rows;
+ALTER TABLE jobs DROP COLUMN IF EXISTS schema;
@@ -0,0 +1,3 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS schema TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS num_rows BIGINT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS num_row_groups INT;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS failed_uploads
+(
+	bucket TEXT NOT NULL,
+	object TEXT NOT NULL,
+	stage TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INT NOT NULL,
+	permanent BOOL NOT NULL DEFAULT false,
+	next_attempt_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY (bucket, object)
+);
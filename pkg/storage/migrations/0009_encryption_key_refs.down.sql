@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS key_ref;
+ALTER TABLE namespaces DROP COLUMN IF EXISTS encryption_key_ref;
@@ -0,0 +1,2 @@
+ALTER TABLE namespaces ADD COLUMN IF NOT EXISTS encryption_key_ref TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS key_ref TEXT;
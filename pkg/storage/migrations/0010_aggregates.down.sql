@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS aggregate_pending;
+ALTER TABLE jobs DROP COLUMN IF EXISTS sub_cid;
+ALTER TABLE jobs DROP COLUMN IF EXISTS path;
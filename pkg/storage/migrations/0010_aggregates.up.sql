@@ -0,0 +1,15 @@
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS path TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS sub_cid BYTEA;
+
+CREATE TABLE IF NOT EXISTS aggregate_pending
+(
+	bucket TEXT NOT NULL,
+	object TEXT NOT NULL,
+	generation BIGINT NOT NULL,
+	namespace TEXT NOT NULL,
+	relation TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	job JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY (bucket, object, generation)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_transitions;
+ALTER TABLE jobs DROP COLUMN IF EXISTS status_updated_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS status;
@@ -0,0 +1,16 @@
+ALTER TABLE jobs ADD COLUMN status TEXT NOT NULL DEFAULT 'uploaded'
+	CHECK (status IN ('uploaded', 'deals_pending', 'deals_active', 'tx_submitted', 'indexed', 'failed'));
+ALTER TABLE jobs ADD COLUMN status_updated_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS job_transitions
+(
+	id BIGSERIAL PRIMARY KEY,
+	job_id BIGINT NOT NULL,
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	error TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT now(),
+	CONSTRAINT fk_job
+	FOREIGN KEY(job_id)
+	REFERENCES jobs(id)
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS jobs_status_idx;
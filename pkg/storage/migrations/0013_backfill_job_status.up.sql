@@ -0,0 +1,5 @@
+-- The status column is added by the previous migration, it can only be used once
+-- that migration is committed. Jobs activated before it were indexed.
+UPDATE jobs SET status = 'indexed' WHERE activated IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs (status);
@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS leased_until;
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_owner;
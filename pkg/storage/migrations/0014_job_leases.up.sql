@@ -0,0 +1,2 @@
+ALTER TABLE jobs ADD COLUMN lease_owner TEXT;
+ALTER TABLE jobs ADD COLUMN leased_until TIMESTAMP;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS deals
+(
+	job_id BIGINT NOT NULL,
+	part_cid BYTEA NOT NULL,
+	deal_id BIGINT NOT NULL,
+	storage_provider TEXT NOT NULL,
+	status TEXT NOT NULL,
+	piece_cid BYTEA,
+	data_cid BYTEA,
+	data_model_selector TEXT,
+	activation TIMESTAMP,
+	expiration TIMESTAMP,
+	created TIMESTAMP,
+	updated TIMESTAMP,
+	first_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+	last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+	PRIMARY KEY (job_id, part_cid, storage_provider, deal_id),
+	CONSTRAINT fk_job
+	FOREIGN KEY(job_id)
+	REFERENCES jobs(id)
+);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS onchain_txs
+(
+	hash BYTEA NOT NULL,
+	job_id BIGINT NOT NULL,
+	nonce BIGINT NOT NULL,
+	gas_limit BIGINT NOT NULL,
+	gas_tip_cap NUMERIC,
+	gas_fee_cap NUMERIC,
+	raw_tx BYTEA NOT NULL,
+	submitted_at TIMESTAMP NOT NULL DEFAULT now(),
+	status TEXT NOT NULL DEFAULT 'pending'
+	CHECK (status IN ('pending', 'success', 'reverted', 'dropped')),
+	error TEXT,
+	block_number BIGINT,
+	gas_used BIGINT,
+	receipt_at TIMESTAMP,
+	PRIMARY KEY (hash, job_id),
+	CONSTRAINT fk_job
+	FOREIGN KEY(job_id)
+	REFERENCES jobs(id)
+);
+
+CREATE INDEX IF NOT EXISTS onchain_txs_job_idx ON onchain_txs (job_id, submitted_at);
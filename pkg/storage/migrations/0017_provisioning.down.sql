@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS provisioned_pubs;
+ALTER TABLE namespaces DROP COLUMN IF EXISTS provisioned_at;
@@ -0,0 +1,16 @@
+ALTER TABLE namespaces ADD COLUMN provisioned_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS provisioned_pubs
+(
+	ns_id BIGINT NOT NULL,
+	relation TEXT NOT NULL,
+	owner BYTEA NOT NULL,
+	provisioned_at TIMESTAMP NOT NULL DEFAULT now(),
+	tx_hash BYTEA,
+	raw_tx BYTEA,
+	created_at TIMESTAMP,
+	PRIMARY KEY (ns_id, relation),
+	CONSTRAINT fk_namespace
+	FOREIGN KEY(ns_id)
+	REFERENCES namespaces(id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE cache_config_rowid
+(
+	ns_id BIGINT NOT NULL,
+	relation TEXT NOT NULL,
+	duration BIGINT,
+	CONSTRAINT fk_namespace
+	FOREIGN KEY(ns_id)
+	REFERENCES namespaces(id)
+);
+
+INSERT INTO cache_config_rowid (ns_id, relation, duration)
+SELECT ns_id, relation, duration FROM cache_config;
+
+DROP TABLE cache_config;
+ALTER TABLE cache_config_rowid RENAME TO cache_config;
@@ -0,0 +1,21 @@
+-- The cache_config table of the initial schema has no primary key, so it may hold
+-- several rows of a relation. It is rebuilt with the primary key UPSERT relies on,
+-- keeping the last row inserted for each relation.
+CREATE TABLE cache_config_pk
+(
+	ns_id BIGINT NOT NULL,
+	relation TEXT NOT NULL,
+	duration BIGINT,
+	PRIMARY KEY (ns_id, relation),
+	CONSTRAINT fk_namespace
+	FOREIGN KEY(ns_id)
+	REFERENCES namespaces(id)
+);
+
+INSERT INTO cache_config_pk (ns_id, relation, duration)
+SELECT DISTINCT ON (ns_id, relation) ns_id, relation, duration
+FROM cache_config
+ORDER BY ns_id, relation, rowid DESC;
+
+DROP TABLE cache_config;
+ALTER TABLE cache_config_pk RENAME TO cache_config;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS rejections@rejections_object_idx;
+ALTER TABLE rejections DROP COLUMN IF EXISTS generation;
+ALTER TABLE rejections DROP COLUMN IF EXISTS bucket;
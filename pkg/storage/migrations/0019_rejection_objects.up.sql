@@ -0,0 +1,4 @@
+ALTER TABLE rejections ADD COLUMN IF NOT EXISTS bucket TEXT;
+ALTER TABLE rejections ADD COLUMN IF NOT EXISTS generation BIGINT;
+
+CREATE INDEX IF NOT EXISTS rejections_object_idx ON rejections (bucket, path, generation);
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ObjectStore defines the interface for reading exported objects from a storage backend,
+// and for parsing the events the backend emits when objects are written.
+type ObjectStore interface {
+	// GetObjectReader returns a reader for the whole object.
+	GetObjectReader(ctx context.Context, bName, oName string) (io.ReadCloser, error)
+	// GetObjectRangeReader returns a reader for length bytes of the object, starting at offset.
+	GetObjectRangeReader(ctx context.Context, bName, oName string, offset, length int64) (io.ReadCloser, error)
+	// GetObjectMetadata returns the custom metadata of the object.
+	GetObjectMetadata(ctx context.Context, bName, oName string) (map[string]string, error)
+	// GetObjectSize returns the size of the object in bytes.
+	GetObjectSize(ctx context.Context, bName, oName string) (int64, error)
+	// GetObjectGeneration returns a number that changes every time the content of the object is replaced.
+	GetObjectGeneration(ctx context.Context, bName, oName string) (int64, error)
+	// ListObjects calls fn with the name and generation of up to limit objects whose names
+	// start with prefix, in lexicographic order of their names, starting after the startAfter name.
+	ListObjects(
+		ctx context.Context,
+		bName, prefix, startAfter string,
+		limit int,
+		fn func(name string, generation int64) error,
+	) error
+	// DeleteObject deletes the object if its generation still matches. A zero generation
+	// deletes the object whatever its generation.
+	DeleteObject(ctx context.Context, bName, oName string, generation int64) error
+	// ParseEvent returns the bucket and object names of the event that triggered the upload.
+	ParseEvent() (string, string, error)
+	// ParseEventGeneration returns the generation of the object of the event,
+	// or zero if the event does not carry it.
+	ParseEventGeneration() (int64, error)
+}
+
+// ErrObjectNotFound is returned by DeleteObject when the object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrGenerationMismatch is returned by DeleteObject when the object was replaced
+// by another generation.
+var ErrGenerationMismatch = errors.New("object generation mismatch")
+
+// The supported object stores.
+const (
+	ObjectStoreGCS   = "gcs"
+	ObjectStoreS3    = "s3"
+	ObjectStoreLocal = "local"
+)
+
+// ObjectStoreConfig defines the configuration for choosing and initializing an ObjectStore.
+type ObjectStoreConfig struct {
+	// Store is one of "gcs", "s3" or "local". Defaults to "gcs".
+	Store string
+
+	// S3Endpoint is the host of the S3 compatible API, e.g. localhost:9000 for MinIO.
+	S3Endpoint string
+	// S3AccessKey and S3SecretKey are the static credentials of the S3 compatible API.
+	S3AccessKey string
+	S3SecretKey string
+	// S3Region is the region of the buckets, it can be left empty for MinIO.
+	S3Region string
+	// S3Insecure disables TLS when connecting to the S3 endpoint.
+	S3Insecure bool
+
+	// LocalStoreDir is the directory of the local store, each bucket is a subdirectory.
+	LocalStoreDir string
+}
+
+// NewObjectStore creates the ObjectStore selected by the config.
+// The event data is the payload of the event that triggered the upload.
+func NewObjectStore(ctx context.Context, cfg ObjectStoreConfig, eventData []byte) (ObjectStore, error) {
+	switch cfg.Store {
+	case "", ObjectStoreGCS:
+		return NewGCSClient(ctx, eventData)
+	case ObjectStoreS3:
+		return NewS3Client(cfg, eventData)
+	case ObjectStoreLocal:
+		return NewLocalStore(cfg.LocalStoreDir, eventData)
+	default:
+		return nil, fmt.Errorf("unsupported object store: %s", cfg.Store)
+	}
+}
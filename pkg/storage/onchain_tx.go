@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	eth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// defaultReceiptTimeout is how long the checker waits for the receipt of a tx.
+	defaultReceiptTimeout = 150 * time.Second
+	// defaultReceiptPollInterval is the delay between two requests of the receipt of a tx.
+	defaultReceiptPollInterval = 5 * time.Second
+)
+
+// TxStatus is the status of a tx that adds the CID of a job to the contract.
+type TxStatus string
+
+const (
+	// TxPending is the status of a tx that was submitted, and is not mined yet.
+	TxPending TxStatus = "pending"
+	// TxSuccess is the status of a mined tx that added the CID.
+	TxSuccess TxStatus = "success"
+	// TxReverted is the status of a mined tx that reverted.
+	TxReverted TxStatus = "reverted"
+	// TxDropped is the status of a tx that will never be mined, its nonce was used by another tx.
+	TxDropped TxStatus = "dropped"
+)
+
+// OnchainTx is a tx that adds the CID of a job to the contract.
+type OnchainTx struct {
+	Hash      common.Hash
+	Nonce     uint64
+	GasLimit  uint64
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+	// Raw is the signed tx. It is sent again while the tx is pending, with the same hash.
+	Raw         []byte
+	SubmittedAt time.Time
+	Status      TxStatus
+	Error       string
+	BlockNumber uint64    // BlockNumber is the block the tx was mined in, 0 while it is pending.
+	GasUsed     uint64    // GasUsed is the gas used by the mined tx.
+	ReceiptAt   time.Time // ReceiptAt is when the receipt of the tx was received.
+}
+
+// RecordTx records a tx that adds the CID of the jobs with the CID, before it is sent.
+func (db *DBClient) RecordTx(ctx context.Context, jobCid []byte, tx OnchainTx) error {
+	res, err := db.DB.ExecContext(ctx,
+		`INSERT INTO onchain_txs (hash, job_id, nonce, gas_limit, gas_tip_cap, gas_fee_cap, raw_tx, status)
+		SELECT $2::BYTEA, id, $3::BIGINT, $4::BIGINT, $5::NUMERIC, $6::NUMERIC, $7::BYTEA, $8::TEXT
+		FROM jobs WHERE cid = $1`,
+		jobCid, tx.Hash.Bytes(), int64(tx.Nonce), int64(tx.GasLimit),
+		bigString(tx.GasTipCap), bigString(tx.GasFeeCap), tx.Raw, tx.Status)
+	if err != nil {
+		return fmt.Errorf("failed to record tx: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("job not found: %x", jobCid)
+	}
+
+	return nil
+}
+
+// UpdateTx updates the status and the receipt of a recorded tx.
+func (db *DBClient) UpdateTx(ctx context.Context, tx OnchainTx) error {
+	reason, blockNumber, gasUsed := &sql.NullString{}, &sql.NullInt64{}, &sql.NullInt64{}
+	if tx.Error != "" {
+		_ = reason.Scan(tx.Error)
+	}
+	if tx.BlockNumber > 0 {
+		_ = blockNumber.Scan(int64(tx.BlockNumber))
+		_ = gasUsed.Scan(int64(tx.GasUsed))
+	}
+
+	_, err := db.DB.ExecContext(ctx,
+		`UPDATE onchain_txs SET status = $1, error = $2, block_number = $3, gas_used = $4, receipt_at = $5
+		WHERE hash = $6`,
+		tx.Status, reason, blockNumber, gasUsed, nullTime(tx.ReceiptAt), tx.Hash.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to update tx: %v", err)
+	}
+
+	return nil
+}
+
+// LatestTx returns the last tx submitted for the jobs with the CID, or nil if none was submitted.
+func (db *DBClient) LatestTx(ctx context.Context, jobCid []byte) (*OnchainTx, error) {
+	var tx OnchainTx
+	var hash []byte
+	var nonce, gasLimit int64
+	var gasTipCap, gasFeeCap, reason sql.NullString
+	var blockNumber, gasUsed sql.NullInt64
+	var receiptAt sql.NullTime
+	var status string
+	err := db.DB.QueryRowContext(ctx,
+		`SELECT onchain_txs.hash, onchain_txs.nonce, onchain_txs.gas_limit, onchain_txs.gas_tip_cap,
+			onchain_txs.gas_fee_cap, onchain_txs.raw_tx, onchain_txs.submitted_at, onchain_txs.status,
+			onchain_txs.error, onchain_txs.block_number, onchain_txs.gas_used, onchain_txs.receipt_at
+		FROM onchain_txs
+		JOIN jobs ON jobs.id = onchain_txs.job_id
+		WHERE jobs.cid = $1
+		ORDER BY onchain_txs.submitted_at DESC
+		LIMIT 1`,
+		jobCid,
+	).Scan(&hash, &nonce, &gasLimit, &gasTipCap, &gasFeeCap, &tx.Raw, &tx.SubmittedAt, &status,
+		&reason, &blockNumber, &gasUsed, &receiptAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tx: %v", err)
+	}
+
+	tx.Hash = common.BytesToHash(hash)
+	tx.Nonce = uint64(nonce)
+	tx.GasLimit = uint64(gasLimit)
+	tx.GasTipCap, _ = new(big.Int).SetString(gasTipCap.String, 10)
+	tx.GasFeeCap, _ = new(big.Int).SetString(gasFeeCap.String, 10)
+	tx.Status = TxStatus(status)
+	tx.Error = reason.String
+	tx.BlockNumber = uint64(blockNumber.Int64)
+	tx.GasUsed = uint64(gasUsed.Int64)
+	tx.ReceiptAt = receiptAt.Time
+
+	return &tx, nil
+}
+
+// bigString returns the decimal representation of n, or NULL if n is nil.
+func bigString(n *big.Int) sql.NullString {
+	if n == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: n.String(), Valid: true}
+}
+
+// indexJob adds the CID of the job to the contract. Every tx is recorded before it is sent,
+// and the recorded txs are consulted first: a job whose last tx succeeded is indexed, and a job
+// whose last tx is pending waits for it, so that the CID of a job is never added twice.
+func (sc *StatusChecker) indexJob(ctx context.Context, job *UnfinishedJob, pub string, cid string, ts int64) error {
+	latest, err := sc.DBClient.LatestTx(ctx, job.Cid)
+	if err != nil {
+		return fmt.Errorf("failed to get latest tx: %v", err)
+	}
+	if latest != nil && latest.Status == TxSuccess {
+		return sc.updateJobStatus(ctx, job, JobTransition{Status: JobIndexed})
+	}
+	if latest != nil && latest.Status == TxPending {
+		fmt.Printf("waiting for pending tx: %s, job: %s, %x\n", latest.Hash, job.Pub, job.Cid)
+		return sc.awaitTx(ctx, job, latest)
+	}
+
+	// A provisioned pub is created on the contract before its first CID is added.
+	created, err := sc.provisionPub(ctx, job, pub)
+	if err != nil {
+		return sc.failJob(ctx, job, fmt.Errorf("failed to provision pub: %v", err))
+	}
+	if !created {
+		return nil
+	}
+
+	signed, err := sc.signAddCID(ctx, pub, cid, ts)
+	if err != nil {
+		return sc.failJob(ctx, job, fmt.Errorf("failed to add cid: %v", err))
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode tx: %v", err)
+	}
+	tx := &OnchainTx{
+		Hash:      signed.Hash(),
+		Nonce:     signed.Nonce(),
+		GasLimit:  signed.Gas(),
+		GasTipCap: signed.GasTipCap(),
+		GasFeeCap: signed.GasFeeCap(),
+		Raw:       raw,
+		Status:    TxPending,
+	}
+	if err := sc.DBClient.RecordTx(ctx, job.Cid, *tx); err != nil {
+		return err
+	}
+
+	return sc.awaitTx(ctx, job, tx)
+}
+
+// awaitTx sends the pending tx, again if it was sent already, and waits for its receipt.
+// A job whose tx is not mined in time stays submitted, its tx is awaited by the next run.
+func (sc *StatusChecker) awaitTx(ctx context.Context, job *UnfinishedJob, tx *OnchainTx) error {
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(tx.Raw); err != nil {
+		return fmt.Errorf("failed to decode tx: %v", err)
+	}
+
+	receipt, err := sc.txReceipt(ctx, tx.Hash)
+	if err != nil {
+		return err
+	}
+	if receipt == nil {
+		if err := sc.contractClient.SendTx(ctx, signed); err != nil && !strings.Contains(err.Error(), "already known") {
+			if !strings.Contains(err.Error(), "nonce too low") {
+				// the tx may have been sent, it stays pending and is sent again by the next run
+				return err
+			}
+			// the nonce was used by another tx, this one is never mined unless it was already
+			if receipt, err = sc.txReceipt(ctx, tx.Hash); err != nil {
+				return err
+			}
+			if receipt == nil {
+				tx.Status, tx.Error = TxDropped, "nonce used by another tx"
+				if err := sc.DBClient.UpdateTx(ctx, *tx); err != nil {
+					return err
+				}
+				return sc.failJob(ctx, job, fmt.Errorf("tx %s dropped", tx.Hash))
+			}
+		}
+	}
+
+	if receipt == nil {
+		if receipt, err = sc.pollReceipt(ctx, tx.Hash); err != nil {
+			return err
+		}
+		if receipt == nil {
+			fmt.Printf("tx not mined yet: %s, job: %s, %x\n", tx.Hash, job.Pub, job.Cid)
+			return nil
+		}
+	}
+	fmt.Printf("got tx receipt: %s, status: %d, block: %v\n", tx.Hash, receipt.Status, receipt.BlockNumber)
+
+	tx.Status = TxSuccess
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		tx.Status, tx.Error = TxReverted, "tx reverted"
+	}
+	if receipt.BlockNumber != nil {
+		tx.BlockNumber = receipt.BlockNumber.Uint64()
+	}
+	tx.GasUsed = receipt.GasUsed
+	tx.ReceiptAt = time.Now().UTC()
+	if err := sc.DBClient.UpdateTx(ctx, *tx); err != nil {
+		return err
+	}
+	if tx.Status == TxReverted {
+		return sc.failJob(ctx, job, fmt.Errorf("tx %s reverted", tx.Hash))
+	}
+
+	return sc.updateJobStatus(ctx, job, JobTransition{Status: JobIndexed})
+}
+
+// txReceipt returns the receipt of the tx, or nil if it is not mined yet.
+func (sc *StatusChecker) txReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	receipt, err := sc.contractClient.TxReceipt(ctx, hash)
+	if err == eth.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tx receipt: %v", err)
+	}
+	return receipt, nil
+}
+
+// pollReceipt polls for the receipt of the tx until it is mined, or returns nil once the receipt timeout passed.
+func (sc *StatusChecker) pollReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	deadline := time.Now().Add(sc.receiptTimeout())
+	for {
+		receipt, err := sc.txReceipt(ctx, hash)
+		if receipt != nil || err != nil {
+			return receipt, err
+		}
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sc.receiptPollInterval()):
+		}
+	}
+}
+
+func (sc *StatusChecker) receiptTimeout() time.Duration {
+	if sc.ReceiptTimeout <= 0 {
+		return defaultReceiptTimeout
+	}
+	return sc.ReceiptTimeout
+}
+
+func (sc *StatusChecker) receiptPollInterval() time.Duration {
+	if sc.ReceiptPollInterval <= 0 {
+		return defaultReceiptPollInterval
+	}
+	return sc.ReceiptPollInterval
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parquetMagic opens and closes every Parquet file.
+const parquetMagic = "PAR1"
+
+// parquetMinSize is the size of the smallest possible Parquet file:
+// the header magic, the footer length and the footer magic.
+const parquetMinSize = 12
+
+// parquetMaxFooterSize bounds the footer that is read in memory, like other Parquet readers do,
+// so that a corrupt footer length cannot allocate gigabytes.
+const parquetMaxFooterSize = 16 << 20
+
+// parquetMaxSchemaElements bounds the decoded schema, every element of a footer list
+// takes a byte in the footer but much more in memory.
+const parquetMaxSchemaElements = 1 << 16
+
+// ParquetInfo describes the content of a Parquet file, as read from its footer.
+type ParquetInfo struct {
+	Schema       string // Schema is the Parquet schema of the file in message format.
+	NumRows      int64  // NumRows is the total number of rows in the file.
+	NumRowGroups int    // NumRowGroups is the number of row groups in the file.
+}
+
+// InvalidParquetError is returned when an object is not a valid Parquet file.
+type InvalidParquetError struct {
+	Err error
+}
+
+func (e *InvalidParquetError) Error() string {
+	return fmt.Sprintf("invalid parquet file: %v", e.Err)
+}
+
+func (e *InvalidParquetError) Unwrap() error {
+	return e.Err
+}
+
+// readParquetInfo checks the magic bytes of a Parquet file and reads its footer.
+// Only the header and the footer are read, not the row groups.
+func readParquetInfo(r io.ReaderAt, size int64) (*ParquetInfo, error) {
+	if size < parquetMinSize {
+		return nil, &InvalidParquetError{Err: fmt.Errorf("file is too small: %d bytes", size)}
+	}
+
+	header := make([]byte, 4)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	if string(header) != parquetMagic {
+		return nil, &InvalidParquetError{Err: fmt.Errorf("invalid header magic: %q", header)}
+	}
+
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, fmt.Errorf("failed to read footer length: %v", err)
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, &InvalidParquetError{Err: fmt.Errorf("invalid footer magic: %q", tail[4:])}
+	}
+
+	footerSize := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if footerSize > size-parquetMinSize {
+		return nil, &InvalidParquetError{Err: fmt.Errorf("footer length %d exceeds file size", footerSize)}
+	}
+	if footerSize > parquetMaxFooterSize {
+		return nil, &InvalidParquetError{
+			Err: fmt.Errorf("footer length %d exceeds the maximum of %d", footerSize, parquetMaxFooterSize),
+		}
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-8-footerSize); err != nil {
+		return nil, fmt.Errorf("failed to read footer: %v", err)
+	}
+
+	info, err := decodeFileMetadata(footer)
+	if err != nil {
+		return nil, &InvalidParquetError{Err: err}
+	}
+
+	return info, nil
+}
+
+// schemaElement is a node of the flattened Parquet schema tree.
+type schemaElement struct {
+	Type          *int32
+	TypeLength    int32
+	Repetition    *int32
+	Name          string
+	NumChildren   int32
+	ConvertedType *int32
+	LogicalType   string
+}
+
+// decodeFileMetadata decodes the Thrift encoded FileMetaData of a Parquet footer.
+func decodeFileMetadata(footer []byte) (*ParquetInfo, error) {
+	t := newThriftReader(footer)
+
+	var info ParquetInfo
+	var elements []schemaElement
+	var hasSchema, hasRows, hasRowGroups bool
+	err := t.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 2 && typ == thriftList:
+			elemType, size, err := t.readList()
+			if err != nil {
+				return err
+			}
+			if elemType != thriftStruct {
+				return fmt.Errorf("unexpected schema element type: %d", elemType)
+			}
+			if len(elements)+size > parquetMaxSchemaElements {
+				return fmt.Errorf("schema has too many elements: %d", len(elements)+size)
+			}
+			for i := 0; i < size; i++ {
+				el, err := decodeSchemaElement(t)
+				if err != nil {
+					return fmt.Errorf("failed to decode schema: %v", err)
+				}
+				elements = append(elements, el)
+			}
+			hasSchema = true
+			return nil
+		case id == 3 && typ == thriftI64:
+			rows, err := t.readInt()
+			if err != nil {
+				return err
+			}
+			info.NumRows, hasRows = rows, true
+			return nil
+		case id == 4 && typ == thriftList:
+			elemType, size, err := t.readList()
+			if err != nil {
+				return err
+			}
+			for i := 0; i < size; i++ {
+				if err := t.skipElem(elemType, 0); err != nil {
+					return fmt.Errorf("failed to decode row groups: %v", err)
+				}
+			}
+			info.NumRowGroups, hasRowGroups = size, true
+			return nil
+		default:
+			return t.skip(typ)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file metadata: %v", err)
+	}
+	if !hasSchema || !hasRows || !hasRowGroups {
+		return nil, fmt.Errorf("file metadata is missing required fields")
+	}
+
+	info.Schema, err = formatSchema(elements)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func decodeSchemaElement(t *thriftReader) (schemaElement, error) {
+	var el schemaElement
+	err := t.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI32:
+			var v int32
+			v, err = t.readI32()
+			el.Type = &v
+		case id == 2 && typ == thriftI32:
+			el.TypeLength, err = t.readI32()
+		case id == 3 && typ == thriftI32:
+			var v int32
+			v, err = t.readI32()
+			el.Repetition = &v
+		case id == 4 && typ == thriftBinary:
+			var name []byte
+			name, err = t.readBinary()
+			el.Name = string(name)
+		case id == 5 && typ == thriftI32:
+			el.NumChildren, err = t.readI32()
+		case id == 6 && typ == thriftI32:
+			var v int32
+			v, err = t.readI32()
+			el.ConvertedType = &v
+		case id == 10 && typ == thriftStruct:
+			el.LogicalType, err = decodeLogicalType(t)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return el, err
+}
+
+// decodeLogicalType decodes the LogicalType union into its annotation in the message format.
+func decodeLogicalType(t *thriftReader) (string, error) {
+	var logical string
+	err := t.readStruct(func(id int16, typ byte) error {
+		if typ != thriftStruct {
+			return t.skip(typ)
+		}
+		switch id {
+		case 5:
+			var scale, precision int32
+			err := t.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch {
+				case id == 1 && typ == thriftI32:
+					scale, err = t.readI32()
+				case id == 2 && typ == thriftI32:
+					precision, err = t.readI32()
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+			logical = fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+			return err
+		case 7, 8:
+			var utc bool
+			var unit string
+			err := t.readStruct(func(id int16, typ byte) error {
+				switch {
+				case id == 1 && (typ == thriftTrue || typ == thriftFalse):
+					utc = t.readBool(typ)
+					return nil
+				case id == 2 && typ == thriftStruct:
+					return t.readStruct(func(id int16, typ byte) error {
+						unit = map[int16]string{1: "MILLIS", 2: "MICROS", 3: "NANOS"}[id]
+						return t.skip(typ)
+					})
+				default:
+					return t.skip(typ)
+				}
+			})
+			logical = fmt.Sprintf("%s(%s,%t)", map[int16]string{7: "TIME", 8: "TIMESTAMP"}[id], unit, utc)
+			return err
+		case 10:
+			var bitWidth byte
+			var signed bool
+			err := t.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch {
+				case id == 1 && typ == thriftByte:
+					bitWidth, err = t.readByte()
+				case id == 2 && (typ == thriftTrue || typ == thriftFalse):
+					signed = t.readBool(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+			logical = fmt.Sprintf("INT(%d,%t)", bitWidth, signed)
+			return err
+		default:
+			logical = logicalTypeNames[id]
+			return t.skip(typ)
+		}
+	})
+	return logical, err
+}
+
+var logicalTypeNames = map[int16]string{
+	1:  "STRING",
+	2:  "MAP",
+	3:  "LIST",
+	4:  "ENUM",
+	6:  "DATE",
+	11: "UNKNOWN",
+	12: "JSON",
+	13: "BSON",
+	14: "UUID",
+	15: "FLOAT16",
+}
+
+var physicalTypeNames = []string{
+	"boolean", "int32", "int64", "int96", "float", "double", "binary", "fixed_len_byte_array",
+}
+
+var repetitionNames = []string{"required", "optional", "repeated"}
+
+var convertedTypeNames = []string{
+	"UTF8", "MAP", "MAP_KEY_VALUE", "LIST", "ENUM", "DECIMAL", "DATE", "TIME_MILLIS", "TIME_MICROS",
+	"TIMESTAMP_MILLIS", "TIMESTAMP_MICROS", "UINT_8", "UINT_16", "UINT_32", "UINT_64",
+	"INT_8", "INT_16", "INT_32", "INT_64", "JSON", "BSON", "INTERVAL",
+}
+
+// formatSchema renders the flattened schema tree in the Parquet message format.
+func formatSchema(elements []schemaElement) (string, error) {
+	if len(elements) == 0 {
+		return "", fmt.Errorf("schema has no root element")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "message %s {\n", elements[0].Name)
+	next, err := formatChildren(&b, elements, 1, int(elements[0].NumChildren), 1)
+	if err != nil {
+		return "", err
+	}
+	if next != len(elements) {
+		return "", fmt.Errorf("schema has %d elements outside of the root", len(elements)-next)
+	}
+	b.WriteString("}")
+
+	return b.String(), nil
+}
+
+// formatChildren renders n elements starting at i, and returns the index after the last one.
+func formatChildren(b *strings.Builder, elements []schemaElement, i, n, depth int) (int, error) {
+	if depth > thriftMaxDepth {
+		return 0, errors.New("schema is nested too deep")
+	}
+	for ; n > 0; n-- {
+		if i >= len(elements) {
+			return 0, errors.New("schema is truncated")
+		}
+		el := elements[i]
+		indent := strings.Repeat("\t", depth)
+
+		repetition := "required"
+		if el.Repetition != nil {
+			if *el.Repetition < 0 || int(*el.Repetition) >= len(repetitionNames) {
+				return 0, fmt.Errorf("unknown repetition type: %d", *el.Repetition)
+			}
+			repetition = repetitionNames[*el.Repetition]
+		}
+
+		annotation := el.LogicalType
+		if annotation == "" && el.ConvertedType != nil &&
+			*el.ConvertedType >= 0 && int(*el.ConvertedType) < len(convertedTypeNames) {
+			annotation = convertedTypeNames[*el.ConvertedType]
+		}
+		if annotation != "" {
+			annotation = " (" + annotation + ")"
+		}
+
+		if el.Type == nil {
+			fmt.Fprintf(b, "%s%s group %s%s {\n", indent, repetition, el.Name, annotation)
+			next, err := formatChildren(b, elements, i+1, int(el.NumChildren), depth+1)
+			if err != nil {
+				return 0, err
+			}
+			fmt.Fprintf(b, "%s}\n", indent)
+			i = next
+			continue
+		}
+
+		if *el.Type < 0 || int(*el.Type) >= len(physicalTypeNames) {
+			return 0, fmt.Errorf("unknown physical type: %d", *el.Type)
+		}
+		typ := physicalTypeNames[*el.Type]
+		if typ == "fixed_len_byte_array" {
+			typ = fmt.Sprintf("%s(%d)", typ, el.TypeLength)
+		}
+		fmt.Fprintf(b, "%s%s %s %s%s;\n", indent, repetition, typ, el.Name, annotation)
+		i++
+	}
+
+	return i, nil
+}
+
+// objectReaderAt reads ranges of an object in cloud storage.
+type objectReaderAt struct {
+	ctx    context.Context
+	client ObjectStore
+	bucket string
+	name   string
+}
+
+// ReadAt implements io.ReaderAt with a range request per call.
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	reader, err := r.client.GetObjectRangeReader(r.ctx, r.bucket, r.name, off, int64(len(p)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object range reader: %v", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	n, err := io.ReadFull(reader, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
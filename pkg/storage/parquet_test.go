@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadParquetInfo(t *testing.T) {
+	data := mockParquet()
+	info, err := readParquetInfo(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), info.NumRows)
+	assert.Equal(t, 3, info.NumRowGroups)
+	expectedSchema := "message row {\n" +
+		"\trequired int64 id (INT(64,true));\n" +
+		"\trequired binary name (STRING);\n" +
+		"\toptional int32 score (INT(32,true));\n" +
+		"}"
+	assert.Equal(t, expectedSchema, info.Schema)
+}
+
+func TestReadParquetInfoInvalid(t *testing.T) {
+	valid := mockParquet()
+	corruptedFooter := bytes.Clone(valid)
+	for i := len(valid) - 200; i < len(valid)-8; i++ {
+		corruptedFooter[i] = 0xff
+	}
+	hugeFooter := bytes.Clone(valid)
+	copy(hugeFooter[len(valid)-8:], []byte{0xff, 0xff, 0xff, 0x0f})
+
+	tests := map[string][]byte{
+		"too small":        []byte("PAR1PAR1"),
+		"not parquet":      bytes.Repeat(mockData(), 10),
+		"truncated":        valid[:len(valid)-100],
+		"missing header":   append([]byte("PAR0"), valid[4:]...),
+		"corrupted footer": corruptedFooter,
+		"footer too large": hugeFooter,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readParquetInfo(bytes.NewReader(data), int64(len(data)))
+			var invalid *InvalidParquetError
+			assert.True(t, errors.As(err, &invalid), "unexpected error: %v", err)
+		})
+	}
+}
+
+// sparseParquet serves the header and tail of a Parquet file of any size,
+// with the footer length in the tail and zeros everywhere else.
+type sparseParquet struct {
+	size       int64
+	footerSize uint32
+}
+
+func (p *sparseParquet) ReadAt(b []byte, off int64) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	if off == 0 {
+		copy(b, parquetMagic)
+	}
+	if off+int64(len(b)) == p.size {
+		tail := binary.LittleEndian.AppendUint32(nil, p.footerSize)
+		copy(b[len(b)-8:], append(tail, parquetMagic...))
+	}
+	return len(b), nil
+}
+
+func TestReadParquetInfoFooterCap(t *testing.T) {
+	// the footer fits in the file, but is not read in memory
+	r := &sparseParquet{size: 1 << 33, footerSize: 1<<32 - 1}
+	_, err := readParquetInfo(r, r.size)
+	var invalid *InvalidParquetError
+	require.True(t, errors.As(err, &invalid), "unexpected error: %v", err)
+	assert.ErrorContains(t, err, "exceeds the maximum")
+}
+
+func FuzzReadParquetInfo(f *testing.F) {
+	valid := mockParquet()
+	f.Add(valid)
+	f.Add(valid[:len(valid)-100])
+	f.Add([]byte("PAR1\x00\x00\x00\x00PAR1"))
+	f.Add([]byte("PAR1\x19\x1c\x1c\x1c\x1c\x00\x00\x00\x06\x00\x00\x00PAR1"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := readParquetInfo(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			var invalid *InvalidParquetError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		if info.NumRowGroups < 0 || info.Schema == "" {
+			t.Fatalf("unexpected info: %+v", info)
+		}
+	})
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/tablelandnetwork/basin-storage/pkg/ethereum"
+)
+
+// ErrPubConflict is returned when a provisioned pub exists on the contract for another address
+// than its owner. The CIDs of the pub are not added until an operator resolves the conflict.
+var ErrPubConflict = errors.New("pub exists for another owner")
+
+// ProvisionedPub is a pub provisioned by the uploader on its first upload,
+// that the checker creates on the contract before adding its first CID.
+type ProvisionedPub struct {
+	Pub           Pub
+	Owner         []byte
+	ProvisionedAt time.Time
+	// TxHash and Raw are the signed createPub tx submitted for the pub, they are empty
+	// until a tx is submitted, and again once a tx was dropped or reverted.
+	TxHash common.Hash
+	Raw    []byte
+	// CreatedAt is when the pub was found on the contract, it is zero until then.
+	CreatedAt time.Time
+}
+
+// ProvisionNamespace creates the namespace with the owner, unless it exists already.
+// The namespace is recorded as provisioned.
+func (db *DBClient) ProvisionNamespace(ctx context.Context, ns string, owner []byte) error {
+	_, err := db.DB.ExecContext(ctx,
+		`INSERT INTO namespaces (name, owner, provisioned_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO NOTHING`,
+		ns, owner)
+	if err != nil {
+		return fmt.Errorf("failed to provision namespace: %v", err)
+	}
+
+	return nil
+}
+
+// ProvisionPub records the pub as provisioned for the owner of its namespace, unless it is already.
+func (db *DBClient) ProvisionPub(ctx context.Context, pub Pub) error {
+	_, err := db.DB.ExecContext(ctx,
+		`INSERT INTO provisioned_pubs (ns_id, relation, owner)
+		SELECT id, $2, owner FROM namespaces WHERE name = $1
+		ON CONFLICT (ns_id, relation) DO NOTHING`,
+		pub.Namespace, pub.Relation)
+	if err != nil {
+		return fmt.Errorf("failed to provision pub: %v", err)
+	}
+
+	return nil
+}
+
+// ProvisionedPub returns the provisioning of the pub, or nil if the pub was not provisioned.
+func (db *DBClient) ProvisionedPub(ctx context.Context, pub Pub) (*ProvisionedPub, error) {
+	p := ProvisionedPub{Pub: pub}
+	var hash []byte
+	var createdAt sql.NullTime
+	err := db.DB.QueryRowContext(ctx,
+		`SELECT provisioned_pubs.owner, provisioned_pubs.provisioned_at, provisioned_pubs.tx_hash,
+			provisioned_pubs.raw_tx, provisioned_pubs.created_at
+		FROM provisioned_pubs
+		JOIN namespaces ON namespaces.id = provisioned_pubs.ns_id
+		WHERE namespaces.name = $1 AND provisioned_pubs.relation = $2`,
+		pub.Namespace, pub.Relation,
+	).Scan(&p.Owner, &p.ProvisionedAt, &hash, &p.Raw, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query provisioned pub: %v", err)
+	}
+
+	p.TxHash = common.BytesToHash(hash)
+	p.CreatedAt = createdAt.Time
+
+	return &p, nil
+}
+
+// UpdateProvisionedPub updates the createPub tx of a provisioned pub, and when it was created.
+func (db *DBClient) UpdateProvisionedPub(ctx context.Context, p ProvisionedPub) error {
+	var hash []byte
+	if len(p.Raw) > 0 {
+		hash = p.TxHash.Bytes()
+	}
+
+	_, err := db.DB.ExecContext(ctx,
+		`UPDATE provisioned_pubs SET tx_hash = $3, raw_tx = $4, created_at = $5
+		WHERE ns_id = (SELECT id FROM namespaces WHERE name = $1) AND relation = $2`,
+		p.Pub.Namespace, p.Pub.Relation, hash, p.Raw, nullTime(p.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to update provisioned pub: %v", err)
+	}
+
+	return nil
+}
+
+// namespaceOwner returns the owner of the namespace of the object. With AutoProvision, a missing
+// namespace is created on the first upload, owned by the signer of the object. With SignatureAny,
+// the signer must own another namespace, an object signed by anyone else is rejected.
+// It tells whether the namespace was provisioned by the object.
+func (u *FileUploader) namespaceOwner(ctx context.Context, pub Pub, hash, sign string) ([]byte, bool, error) {
+	owner, err := u.DBClient.NamespaceOwner(ctx, pub.Namespace)
+	if !errors.Is(err, ErrNamespaceNotFound) || !u.AutoProvision {
+		return owner, false, err
+	}
+
+	signer, err := u.provisioningSigner(ctx, hash, sign)
+	var rejected *RejectionError
+	if errors.As(err, &rejected) {
+		return nil, false, reject(hash, rejected.Reason)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := u.DBClient.ProvisionNamespace(ctx, pub.Namespace, signer.Bytes()); err != nil {
+		return nil, false, err
+	}
+	fmt.Println("Namespace provisioned", pub.Namespace, signer)
+
+	// another upload may have provisioned the namespace first, with another owner
+	owner, err = u.DBClient.NamespaceOwner(ctx, pub.Namespace)
+	return owner, true, err
+}
+
+// provisionPub records the pub of the object as provisioned, for the checker to create it on the
+// contract before it adds the first CID of the pub. A pub is only recorded once, by the first upload
+// to a namespace provisioned by an upload or to a pub that is not provisioned yet.
+func (u *FileUploader) provisionPub(ctx context.Context, pub Pub, nsProvisioned bool) error {
+	if !nsProvisioned {
+		p, err := u.DBClient.ProvisionedPub(ctx, pub)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			return nil
+		}
+	}
+
+	return u.DBClient.ProvisionPub(ctx, pub)
+}
+
+// provisioningSigner returns the signer of the object, that owns the namespace it provisions.
+// A signature that does not tell its signer is a RejectionError.
+func (u *FileUploader) provisioningSigner(ctx context.Context, hash, sign string) (common.Address, error) {
+	signers, err := recoverSigners(u.SignatureMode, hash, sign)
+	if err != nil {
+		return common.Address{}, &RejectionError{Reason: err}
+	}
+	if len(signers) == 1 {
+		return signers[0], nil
+	}
+
+	// a raw and an EIP-191 signature recover to different addresses, the signer is the one that owns
+	// a namespace already
+	for _, signer := range signers {
+		known, err := u.DBClient.IsNamespaceOwner(ctx, signer.Bytes())
+		if err != nil {
+			return common.Address{}, err
+		}
+		if known {
+			return signer, nil
+		}
+	}
+
+	return common.Address{}, &RejectionError{
+		Reason: fmt.Errorf("%w: in %s mode, the signer must own a namespace", ErrUnknownSigner, u.SignatureMode),
+	}
+}
+
+// provisionPub creates the pub of the job on the contract, if the pub was provisioned by the
+// uploader and not created yet. Like the txs of the jobs, the createPub tx is recorded before
+// it is sent. It returns false while the pub is not created, the job is then left for the next run.
+// A pub that exists on the contract for its owner is not created again, a pub that exists for
+// another address is an ErrPubConflict.
+func (sc *StatusChecker) provisionPub(ctx context.Context, job *UnfinishedJob, pub string) (bool, error) {
+	p, err := sc.DBClient.ProvisionedPub(ctx, job.Pub)
+	if err != nil {
+		return false, err
+	}
+	if p == nil || !p.CreatedAt.IsZero() {
+		return true, nil
+	}
+
+	owner := common.BytesToAddress(p.Owner)
+	exists, err := sc.contractClient.PubExists(ctx, owner, pub)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return true, sc.pubCreated(ctx, p, pub)
+	}
+
+	if len(p.Raw) == 0 {
+		signed, err := sc.signCreatePub(ctx, owner, pub)
+		if errors.Is(err, ethereum.ErrPubAlreadyExists) {
+			return sc.pubAlreadyExists(ctx, p, owner, pub)
+		}
+		if err != nil {
+			return false, err
+		}
+		if p.Raw, err = signed.MarshalBinary(); err != nil {
+			return false, fmt.Errorf("failed to encode tx: %v", err)
+		}
+		p.TxHash = signed.Hash()
+		if err := sc.DBClient.UpdateProvisionedPub(ctx, *p); err != nil {
+			return false, err
+		}
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(p.Raw); err != nil {
+		return false, fmt.Errorf("failed to decode tx: %v", err)
+	}
+	dropped := false
+	if err := sc.contractClient.SendTx(ctx, signed); err != nil && !strings.Contains(err.Error(), "already known") {
+		if !strings.Contains(err.Error(), "nonce too low") {
+			// the tx may have been sent, it is sent again by the next run
+			return false, err
+		}
+		dropped = true
+	}
+
+	var receipt *types.Receipt
+	if dropped {
+		// the nonce was used by another tx, this one is never mined unless it was already
+		receipt, err = sc.txReceipt(ctx, p.TxHash)
+	} else {
+		receipt, err = sc.pollReceipt(ctx, p.TxHash)
+	}
+	if err != nil {
+		return false, err
+	}
+	if receipt == nil && !dropped {
+		fmt.Printf("create pub tx not mined yet: %s, pub: %s\n", p.TxHash, pub)
+		return false, nil
+	}
+	if receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+		hash := p.TxHash
+		p.TxHash, p.Raw = common.Hash{}, nil
+		if err := sc.DBClient.UpdateProvisionedPub(ctx, *p); err != nil {
+			return false, err
+		}
+
+		// the pub may have been created by another tx, then createPub reverts
+		_, err := sc.contractClient.EstimateCreatePubGas(ctx, owner, pub)
+		if errors.Is(err, ethereum.ErrPubAlreadyExists) {
+			return sc.pubAlreadyExists(ctx, p, owner, pub)
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to estimate gas for creating pub: %v", err)
+		}
+		if receipt == nil {
+			return false, fmt.Errorf("create pub tx %s dropped", hash)
+		}
+		return false, fmt.Errorf("create pub tx %s reverted", hash)
+	}
+
+	fmt.Printf("create pub tx mined: %s, pub: %s\n", p.TxHash, pub)
+	return true, sc.pubCreated(ctx, p, pub)
+}
+
+// pubAlreadyExists handles a createPub that fails because the pub exists. The pub is created
+// if it exists for its owner, e.g. by the tx of another checker, otherwise it is a conflict.
+func (sc *StatusChecker) pubAlreadyExists(
+	ctx context.Context,
+	p *ProvisionedPub,
+	owner common.Address,
+	pub string,
+) (bool, error) {
+	exists, err := sc.contractClient.PubExists(ctx, owner, pub)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, fmt.Errorf("%w: %s, provisioned for %s", ErrPubConflict, pub, owner)
+	}
+
+	return true, sc.pubCreated(ctx, p, pub)
+}
+
+// pubCreated records that the provisioned pub was found on the contract.
+func (sc *StatusChecker) pubCreated(ctx context.Context, p *ProvisionedPub, pub string) error {
+	fmt.Printf("pub created: %s, owner: %s\n", pub, common.BytesToAddress(p.Owner))
+	p.CreatedAt = time.Now().UTC()
+	return sc.DBClient.UpdateProvisionedPub(ctx, *p)
+}
+
+// signCreatePub signs the tx that creates the pub for the owner.
+func (sc *StatusChecker) signCreatePub(
+	ctx context.Context,
+	owner common.Address,
+	pub string,
+) (*types.Transaction, error) {
+	txOpts, err := sc.contractClient.EstimateCreatePubGas(ctx, owner, pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate gas for creating pub: %w", err)
+	}
+
+	nonce, err := sc.contractClient.GetPendingNonce(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %v", err)
+	}
+	txOpts.Nonce = big.NewInt(int64(nonce))
+
+	fmt.Println("Creating pub: ", pub, owner, nonce)
+	tx, err := sc.contractClient.SignCreatePub(ctx, owner, pub, txOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tx: %v", err)
+	}
+
+	return tx, nil
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoProvision(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	conn := "memory://" + t.Name()
+	newUploader := func(
+		fname string,
+		key *ecdsa.PrivateKey,
+		signMode, mode SignatureMode,
+		autoProvision bool,
+	) *FileUploader {
+		path := filepath.Join(dir, "store", "mybucket", filepath.FromSlash(fname))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, mockParquet(), 0o600))
+		metadata := `{"timestamp": "1700248832", "hash": "` + mockParquetHash() + `", "signature": "` +
+			signHash(key, mockParquetHash(), signMode) + `"}`
+		require.NoError(t, os.WriteFile(path+".metadata.json", []byte(metadata), 0o600))
+
+		uploader, err := NewFileUploader(ctx, []byte(`{"bucket": "mybucket", "name": "`+fname+`"}`), &UploaderConfig{
+			ObjectStoreConfig:  ObjectStoreConfig{Store: ObjectStoreLocal, LocalStoreDir: filepath.Join(dir, "store")},
+			DealProviderConfig: DealProviderConfig{Provider: DealProviderLocal, LocalDir: filepath.Join(dir, "deals")},
+			CrdbConn:           conn,
+			SignatureMode:      string(mode),
+			AutoProvision:      autoProvision,
+		})
+		require.NoError(t, err)
+		return uploader
+	}
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	pub := Pub{Namespace: "foo.bar.baz", Relation: "relname"}
+
+	// without provisioning, the namespace must exist
+	err := newUploader(fname, testOwnerKey(), SignatureRaw, SignatureRaw, false).HandleEvent(ctx, EventTypeFinalized)
+	assert.ErrorContains(t, err, ErrNamespaceNotFound.Error())
+
+	// the first upload creates the namespace, owned by its signer, and provisions the pub
+	uploader := newUploader(fname, testOwnerKey(), SignatureRaw, SignatureRaw, true)
+	require.NoError(t, uploader.HandleEvent(ctx, EventTypeFinalized))
+	db := uploader.DBClient
+	owner, err := db.NamespaceOwner(ctx, pub.Namespace)
+	require.NoError(t, err)
+	assert.Equal(t, testOwner(), owner)
+	provisioned, err := db.ProvisionedPub(ctx, pub)
+	require.NoError(t, err)
+	require.NotNil(t, provisioned)
+	assert.Equal(t, testOwner(), provisioned.Owner)
+	assert.True(t, provisioned.CreatedAt.IsZero())
+
+	// an upload to another relation signed by anyone else is rejected, its pub is not provisioned
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	other := "foo.bar.baz/other/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-other-1.parquet"
+	err = newUploader(other, otherKey, SignatureRaw, SignatureRaw, true).HandleEvent(ctx, EventTypeFinalized)
+	var mismatch *SignatureMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	provisioned, err = db.ProvisionedPub(ctx, Pub{Namespace: "foo.bar.baz", Relation: "other"})
+	require.NoError(t, err)
+	assert.Nil(t, provisioned)
+
+	// in any mode, a new namespace is owned by the signer that owns another namespace,
+	// whether the signature is raw or EIP-191
+	for i, mode := range []SignatureMode{SignatureRaw, SignatureEIP191} {
+		ns := fmt.Sprintf("any%d.bar.baz", i)
+		fname := ns + "/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet"
+		require.NoError(t, newUploader(fname, testOwnerKey(), mode, SignatureAny, true).HandleEvent(ctx, EventTypeFinalized))
+		owner, err := db.NamespaceOwner(ctx, ns)
+		require.NoError(t, err)
+		assert.Equal(t, testOwner(), owner, mode)
+	}
+
+	// in any mode, a signer that owns no namespace cannot provision one
+	unknown := "any.other.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	err = newUploader(unknown, otherKey, SignatureEIP191, SignatureAny, true).HandleEvent(ctx, EventTypeFinalized)
+	assert.ErrorIs(t, err, ErrUnknownSigner)
+	_, err = db.NamespaceOwner(ctx, "any.other.baz")
+	assert.ErrorIs(t, err, ErrNamespaceNotFound)
+
+	// the checker creates the pub for the owner before adding the CID
+	bsc := &MockBasinStorage{
+		cids: []string{},
+	}
+	sc := StatusChecker{
+		StatusClient:   uploader.DealClient,
+		DBClient:       db,
+		contractClient: bsc,
+	}
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, map[string]common.Address{
+		"foo.bar.baz.relname":  common.BytesToAddress(testOwner()),
+		"any0.bar.baz.relname": common.BytesToAddress(testOwner()),
+		"any1.bar.baz.relname": common.BytesToAddress(testOwner()),
+	}, bsc.pubs)
+	assert.Len(t, bsc.cids, 3)
+	provisioned, err = db.ProvisionedPub(ctx, pub)
+	require.NoError(t, err)
+	assert.False(t, provisioned.CreatedAt.IsZero())
+	assert.NotEqual(t, common.Hash{}, provisioned.TxHash)
+	jobs, err := db.UnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// the next uploads to the pub do not provision it again
+	next := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-2.parquet" // nolint:lll
+	uploader = newUploader(next, testOwnerKey(), SignatureRaw, SignatureRaw, true)
+	counter := &provisionCounter{Crdb: uploader.DBClient}
+	uploader.DBClient = counter
+	require.NoError(t, uploader.HandleEvent(ctx, EventTypeFinalized))
+	assert.Zero(t, counter.pubs)
+}
+
+// provisionCounter counts the pubs provisioned.
+type provisionCounter struct {
+	Crdb
+	pubs int
+}
+
+func (c *provisionCounter) ProvisionPub(ctx context.Context, pub Pub) error {
+	c.pubs++
+	return c.Crdb.ProvisionPub(ctx, pub)
+}
+
+func TestStatusCheckerProvisionPub(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids:    []string{},
+		pending: true,
+	}
+	pub := Pub{Namespace: "testns", Relation: "testrel"}
+	jobCid := getCIDFromBytes([]byte("data for myfile2"))
+	db := NewMemDB()
+	addTestJobs(t, db, UnfinishedJob{Pub: pub, Cid: jobCid.Bytes()})
+	require.NoError(t, db.ProvisionPub(ctx, pub))
+	provisioned := func() *ProvisionedPub {
+		p, err := db.ProvisionedPub(ctx, pub)
+		require.NoError(t, err)
+		return p
+	}
+	sc := StatusChecker{
+		StatusClient:        &W3SProvider{Client: &mockW3sClient{}},
+		DBClient:            db,
+		contractClient:      bsc,
+		ReceiptTimeout:      10 * time.Millisecond,
+		ReceiptPollInterval: time.Millisecond,
+	}
+
+	// the createPub tx is recorded before it is sent, the CID waits for the pub
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobTxSubmitted, testJobs(db)[0].Status)
+	assert.NotEmpty(t, provisioned().Raw)
+	hash := provisioned().TxHash
+	assert.Empty(t, testTxs(db, jobCid.Bytes()))
+	assert.Equal(t, 1, bsc.sent)
+
+	// the pending tx is sent again, then the CID is added once the pub is created
+	bsc.pending = false
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	assert.Equal(t, hash, provisioned().TxHash)
+	assert.False(t, provisioned().CreatedAt.IsZero())
+	assert.Contains(t, bsc.pubs, "testns.testrel")
+	assert.Equal(t, []string{jobCid.String()}, bsc.cids)
+	assert.Equal(t, 3, bsc.sent)
+
+	// a pub found on the contract is not created again
+	p := provisioned()
+	p.CreatedAt = time.Time{}
+	require.NoError(t, db.UpdateProvisionedPub(ctx, *p))
+	otherCid := getCIDFromBytes([]byte("data for myfile"))
+	addTestJobs(t, db, UnfinishedJob{Pub: pub, Cid: otherCid.Bytes()})
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.False(t, provisioned().CreatedAt.IsZero())
+	assert.Equal(t, []string{jobCid.String(), otherCid.String()}, bsc.cids)
+	assert.Equal(t, 4, bsc.sent)
+}
+
+func TestStatusCheckerPubAlreadyExists(t *testing.T) {
+	ctx := context.Background()
+	other := common.HexToAddress("0x01")
+	newChecker := func(pub Pub, bsc *MockBasinStorage) (*StatusChecker, func() *ProvisionedPub) {
+		db := NewMemDB()
+		addTestJobs(t, db, UnfinishedJob{Pub: pub, Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes()})
+		require.NoError(t, db.ProvisionPub(ctx, pub))
+		provisioned := func() *ProvisionedPub {
+			p, err := db.ProvisionedPub(ctx, pub)
+			require.NoError(t, err)
+			return p
+		}
+		return &StatusChecker{
+			StatusClient:        &W3SProvider{Client: &mockW3sClient{}},
+			DBClient:            db,
+			contractClient:      bsc,
+			ReceiptTimeout:      10 * time.Millisecond,
+			ReceiptPollInterval: time.Millisecond,
+		}, provisioned
+	}
+
+	// a pub that exists for another owner is a conflict, its CIDs are not added
+	pub := Pub{Namespace: "testns", Relation: "otherrel"}
+	bsc := &MockBasinStorage{
+		cids: []string{},
+		pubs: map[string]common.Address{"testns.otherrel": other},
+	}
+	sc, provisioned := newChecker(pub, bsc)
+	err := sc.ProcessJobs(ctx)
+	require.ErrorContains(t, err, ErrPubConflict.Error())
+	assert.True(t, provisioned().CreatedAt.IsZero())
+	assert.Empty(t, provisioned().Raw)
+	assert.Equal(t, JobFailed, testJobs(sc.DBClient.(*MemDB))[0].Status)
+	assert.Empty(t, bsc.cids)
+	assert.Zero(t, bsc.sent)
+
+	// the conflict remains on the next runs
+	require.ErrorContains(t, sc.ProcessJobs(ctx), ErrPubConflict.Error())
+	assert.True(t, provisioned().CreatedAt.IsZero())
+	assert.Empty(t, bsc.cids)
+
+	// a createPub tx that reverts because another owner created the pub meanwhile is a conflict
+	pub = Pub{Namespace: "testns", Relation: "lastrel"}
+	bsc = &MockBasinStorage{
+		cids:    []string{},
+		pending: true,
+	}
+	sc, provisioned = newChecker(pub, bsc)
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.NotEmpty(t, provisioned().Raw)
+	hash := provisioned().TxHash
+	bsc.pubs = map[string]common.Address{"testns.lastrel": other}
+	bsc.pending = false
+	require.ErrorContains(t, sc.ProcessJobs(ctx), ErrPubConflict.Error())
+	assert.Equal(t, types.ReceiptStatusFailed, bsc.mined[hash].Status)
+	assert.Empty(t, provisioned().Raw)
+	assert.True(t, provisioned().CreatedAt.IsZero())
+	assert.Equal(t, JobFailed, testJobs(sc.DBClient.(*MemDB))[0].Status)
+	assert.Empty(t, bsc.cids)
+}
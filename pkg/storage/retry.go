@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// UploadStage is the step of an upload at which it failed.
+type UploadStage string
+
+const (
+	// StageFetch reads the generation and metadata of the object.
+	StageFetch UploadStage = "fetch"
+	// StageMetadata validates the name and the metadata of the object.
+	StageMetadata UploadStage = "metadata"
+	// StageVerify verifies the signature and the content of the object.
+	StageVerify UploadStage = "verify"
+	// StageArchive builds the CAR and sends it to the deal provider.
+	StageArchive UploadStage = "archive"
+	// StageCreateJob creates the job of the archived object.
+	StageCreateJob UploadStage = "create_job"
+)
+
+const (
+	defaultMaxAttempts  = 5
+	defaultRetryBackoff = time.Minute
+	maxRetryBackoff     = 24 * time.Hour
+
+	// retryBatchSize is the number of failed uploads retried in a single run.
+	retryBatchSize = 100
+)
+
+// FailedUpload is an upload that failed, and is either waiting to be retried,
+// or flagged as permanent for someone to look into.
+type FailedUpload struct {
+	Bucket        string
+	Object        string
+	Stage         UploadStage
+	Error         string
+	Attempts      int
+	Permanent     bool
+	NextAttemptAt time.Time
+}
+
+// backoff returns the delay before the next attempt, after the given number of attempts.
+func (u *FileUploader) backoff(attempts int) time.Duration {
+	delay := u.RetryBackoff
+	if delay <= 0 {
+		delay = defaultRetryBackoff
+	}
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// recordFailure records the failed upload of an object and returns the upload error.
+// Rejected objects, and objects that failed too many times, are flagged as permanent.
+func (u *FileUploader) recordFailure(
+	ctx context.Context,
+	bucket string,
+	fname string,
+	stage UploadStage,
+	uploadErr error,
+) error {
+	previous, err := u.DBClient.FailedUpload(ctx, bucket, fname)
+	if err != nil {
+		log.Printf("ERROR: failed to read failed upload: %v, file: %s", err, fname)
+		return uploadErr
+	}
+
+	attempts := 1
+	if previous != nil {
+		attempts = previous.Attempts + 1
+	}
+	maxAttempts := u.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	var rejection *RejectionError
+	permanent := errors.As(uploadErr, &rejection) || attempts >= maxAttempts
+
+	failure := FailedUpload{
+		Bucket:        bucket,
+		Object:        fname,
+		Stage:         stage,
+		Error:         uploadErr.Error(),
+		Attempts:      attempts,
+		Permanent:     permanent,
+		NextAttemptAt: time.Now().Add(u.backoff(attempts)).UTC(),
+	}
+	if err := u.DBClient.RecordFailedUpload(ctx, failure); err != nil {
+		log.Printf("ERROR: failed to record failed upload: %v, file: %s", err, fname)
+		return uploadErr
+	}
+	if permanent {
+		log.Printf("ERROR: upload failed permanently after %d attempts at %s: %v, file: %s",
+			attempts, stage, uploadErr, fname)
+	}
+
+	return uploadErr
+}
+
+// RetryFailedUploads uploads again the failed uploads whose backoff has elapsed.
+// Uploads that fail again are recorded with a longer backoff, so a failing object
+// does not stop the others from being retried.
+func (u *FileUploader) RetryFailedUploads(ctx context.Context) error {
+	failures, err := u.DBClient.FailedUploadsDue(ctx, time.Now().UTC(), retryBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get failed uploads: %v", err)
+	}
+
+	var retried, failed int
+	for _, f := range failures {
+		fmt.Printf("retrying upload: %s/%s, attempt %d\n", f.Bucket, f.Object, f.Attempts+1)
+		if err := u.UploadObject(ctx, f.Bucket, f.Object); err != nil {
+			log.Printf("ERROR: retry failed: %v, file: %s", err, f.Object)
+			failed++
+			continue
+		}
+		retried++
+	}
+	fmt.Printf("retried %d failed uploads, %d failed again\n", retried, failed)
+
+	return nil
+}
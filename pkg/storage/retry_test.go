@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/tablelandnetwork/basin-storage/mocks"
+)
+
+func TestRetryFailedUploads(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// the metadata cannot be read on the first attempt
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(nil, errors.New("unavailable")).Once()
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+		RetryBackoff:  time.Hour,
+	}
+
+	require.Error(t, uploader.UploadObject(ctx, "mybucket", fname))
+	failure, err := db.FailedUpload(ctx, "mybucket", fname)
+	require.NoError(t, err)
+	require.NotNil(t, failure)
+	assert.Equal(t, StageFetch, failure.Stage)
+	assert.Equal(t, 1, failure.Attempts)
+	assert.False(t, failure.Permanent)
+	assert.Contains(t, failure.Error, "unavailable")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), failure.NextAttemptAt, time.Minute)
+
+	// the backoff has not elapsed, nothing is retried
+	require.NoError(t, uploader.RetryFailedUploads(ctx))
+	assert.Empty(t, createdJobs(db))
+
+	// once the backoff elapsed, the upload is retried and the failure resolved
+	failure.NextAttemptAt = time.Now().Add(-time.Second)
+	require.NoError(t, db.RecordFailedUpload(ctx, *failure))
+	require.NoError(t, uploader.RetryFailedUploads(ctx))
+	mockStore.AssertExpectations(t)
+
+	assert.Len(t, createdJobs(db), 1)
+	failure, err = db.FailedUpload(ctx, "mybucket", fname)
+	require.NoError(t, err)
+	assert.Nil(t, failure)
+}
+
+func TestRetryFailedUploadsPermanent(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	// the object was deleted from the bucket
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(0), errors.New("not found"))
+
+	db := NewMemDB()
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DBClient:      db,
+		MaxAttempts:   3,
+		RetryBackoff:  -time.Second,
+	}
+
+	require.Error(t, uploader.UploadObject(ctx, "mybucket", fname))
+	for i := 0; i < 2; i++ {
+		f := testFailedUpload(t, db, fname)
+		f.NextAttemptAt = time.Now().Add(-time.Second)
+		require.NoError(t, db.RecordFailedUpload(ctx, *f))
+		require.NoError(t, uploader.RetryFailedUploads(ctx))
+	}
+
+	// flagged as permanent after the last attempt, and never retried again
+	failure, err := db.FailedUpload(ctx, "mybucket", fname)
+	require.NoError(t, err)
+	require.NotNil(t, failure)
+	assert.Equal(t, 3, failure.Attempts)
+	assert.True(t, failure.Permanent)
+	due, err := db.FailedUploadsDue(ctx, time.Now().Add(48*time.Hour), retryBatchSize)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	mockStore.AssertNumberOfCalls(t, "GetObjectGeneration", 3)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	u := &FileUploader{RetryBackoff: time.Minute}
+	assert.Equal(t, time.Minute, u.backoff(1))
+	assert.Equal(t, 2*time.Minute, u.backoff(2))
+	assert.Equal(t, 8*time.Minute, u.backoff(4))
+	assert.Equal(t, 24*time.Hour, u.backoff(100))
+
+	u = &FileUploader{}
+	assert.Equal(t, defaultRetryBackoff, u.backoff(1))
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
+)
+
+// S3Client implements the ObjectStore interface for S3 compatible stores, e.g. AWS S3 or MinIO.
+type S3Client struct {
+	Client    *minio.Client
+	EventData []byte
+}
+
+// NewS3Client creates a new S3Client.
+func NewS3Client(cfg ObjectStoreConfig, eventData []byte) (*S3Client, error) {
+	if cfg.S3Endpoint == "" {
+		return nil, fmt.Errorf("missing s3 endpoint")
+	}
+
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: !cfg.S3Insecure,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minio.New: %w", err)
+	}
+
+	return &S3Client{
+		Client:    client,
+		EventData: eventData,
+	}, nil
+}
+
+// GetObjectReader returns a reader for the specified object in the specified bucket.
+func (r *S3Client) GetObjectReader(ctx context.Context, bucketName, objectName string) (io.ReadCloser, error) {
+	return r.Client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+}
+
+// GetObjectRangeReader returns a reader for length bytes of the specified object,
+// starting at offset.
+func (r *S3Client) GetObjectRangeReader(
+	ctx context.Context,
+	bucketName, objectName string,
+	offset, length int64,
+) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, fmt.Errorf("set range: %s", err)
+	}
+	return r.Client.GetObject(ctx, bucketName, objectName, opts)
+}
+
+// GetObjectMetadata returns the user metadata for the specified object in the specified bucket.
+// S3 canonicalizes metadata keys, they are returned in lower case.
+func (r *S3Client) GetObjectMetadata(ctx context.Context, bucketName, objectName string) (map[string]string, error) {
+	info, err := r.Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("stat: %s", err)
+	}
+
+	metadata := make(map[string]string, len(info.UserMetadata))
+	for k, v := range info.UserMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+
+	return metadata, nil
+}
+
+// GetObjectSize returns the size in bytes of the specified object in the specified bucket.
+func (r *S3Client) GetObjectSize(ctx context.Context, bucketName, objectName string) (int64, error) {
+	info, err := r.Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("stat: %s", err)
+	}
+
+	return info.Size, nil
+}
+
+// GetObjectGeneration returns the generation of the specified object in the specified bucket.
+// S3 has no generation numbers, it is derived from the ETag and the last modification time.
+func (r *S3Client) GetObjectGeneration(ctx context.Context, bucketName, objectName string) (int64, error) {
+	info, err := r.Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("stat: %s", err)
+	}
+
+	return s3Generation(info.ETag, info.LastModified), nil
+}
+
+// s3Generation derives the generation of an S3 object from its ETag and last modification time.
+// The modification time only has a precision of a second, an object replaced within the same
+// second has the same modification time, but the ETag of its new content. Listings and headers
+// have the same ETag, but listings have milliseconds, the time is truncated to the second.
+func s3Generation(etag string, lastModified time.Time) int64 {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s-%d", strings.Trim(etag, `"`), lastModified.Unix())
+	// generations are positive, zero matches any generation
+	if generation := int64(h.Sum64() >> 1); generation != 0 {
+		return generation
+	}
+	return 1
+}
+
+// ListObjects lists the objects of the bucket with the prefix, after startAfter.
+func (r *S3Client) ListObjects(
+	ctx context.Context,
+	bucketName, prefix, startAfter string,
+	limit int,
+	fn func(name string, generation int64) error,
+) error {
+	// the listing is stopped once the limit is reached
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	listed := 0
+	for info := range r.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  true,
+	}) {
+		if listed == limit {
+			break
+		}
+		if info.Err != nil {
+			return fmt.Errorf("list: %s", info.Err)
+		}
+		if err := fn(info.Key, s3Generation(info.ETag, info.LastModified)); err != nil {
+			return err
+		}
+		listed++
+	}
+
+	return nil
+}
+
+// DeleteObject deletes the specified object in the specified bucket, if its generation still matches.
+// S3 has no conditional deletes, the generation is checked right before the delete.
+func (r *S3Client) DeleteObject(ctx context.Context, bucketName, objectName string, generation int64) error {
+	info, err := r.Client.StatObject(ctx, bucketName, objectName, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("stat: %s", err)
+	}
+	if generation != 0 && s3Generation(info.ETag, info.LastModified) != generation {
+		return ErrGenerationMismatch
+	}
+
+	if err := r.Client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("remove: %s", err)
+	}
+
+	return nil
+}
+
+// ParseEvent parses an S3 event notification to get the bucket name and object path.
+func (r *S3Client) ParseEvent() (string, string, error) {
+	var info struct {
+		Records []notification.Event
+	}
+	if err := json.Unmarshal(r.EventData, &info); err != nil {
+		return "", "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if len(info.Records) == 0 {
+		return "", "", fmt.Errorf("event has no records")
+	}
+
+	// object keys are URL encoded in event notifications
+	record := info.Records[0]
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode object key: %w", err)
+	}
+
+	return record.S3.Bucket.Name, key, nil
+}
+
+// ParseEventGeneration returns zero, S3 event notifications do not carry the
+// modification time that the generation of an S3 object is derived from.
+func (r *S3Client) ParseEventGeneration() (int64, error) {
+	return 0, nil
+}
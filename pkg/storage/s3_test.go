@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ParseEvent(t *testing.T) {
+	// a MinIO event notification, object keys are URL encoded
+	event := []byte(`{
+		"EventName": "s3:ObjectCreated:Put",
+		"Key": "mybucket/foo.bar.baz/relname/export%3Aabcd.parquet",
+		"Records": [{
+			"eventVersion": "2.0",
+			"eventSource": "minio:s3",
+			"eventName": "s3:ObjectCreated:Put",
+			"s3": {
+				"bucket": {"name": "mybucket"},
+				"object": {"key": "foo.bar.baz%2Frelname%2Fexport%3Aabcd.parquet", "size": 11}
+			}
+		}]
+	}`)
+	client, err := NewS3Client(ObjectStoreConfig{S3Endpoint: "localhost:9000"}, event)
+	require.NoError(t, err)
+
+	bucket, name, err := client.ParseEvent()
+	require.NoError(t, err)
+	assert.Equal(t, "mybucket", bucket)
+	assert.Equal(t, "foo.bar.baz/relname/export:abcd.parquet", name)
+
+	client.EventData = []byte(`{"Records": []}`)
+	_, _, err = client.ParseEvent()
+	assert.Error(t, err)
+}
+
+func TestS3Generation(t *testing.T) {
+	modified := time.Date(2023, time.November, 17, 19, 20, 32, 0, time.UTC)
+	generation := s3Generation("5eb63bbbe01eeed093cb22bb8f5acdc3", modified)
+	assert.Greater(t, generation, int64(0))
+
+	// listings have milliseconds and headers seconds, ETags may be quoted
+	assert.Equal(t, generation, s3Generation(`"5eb63bbbe01eeed093cb22bb8f5acdc3"`, modified.Add(250*time.Millisecond)))
+
+	// an object replaced within the same second gets a new generation
+	assert.NotEqual(t, generation, s3Generation("6f5902ac237024bdd0c176cb93063dc4", modified))
+	assert.NotEqual(t, generation, s3Generation("5eb63bbbe01eeed093cb22bb8f5acdc3", modified.Add(time.Second)))
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ShardRef locates one shard of a sharded object.
+type ShardRef struct {
+	Index  int    `json:"index"`  // Index is the position of the shard in the object.
+	Name   string `json:"name"`   // Name is the file name the shard was uploaded with.
+	Cid    string `json:"cid"`    // Cid is the root CID of the shard.
+	Offset int64  `json:"offset"` // Offset is the position in bytes of the shard in the object.
+	Size   int64  `json:"size"`   // Size is the length in bytes of the shard.
+}
+
+// ShardInfo holds the details of an uploaded shard that are stored with its job.
+type ShardInfo struct {
+	ShardRef
+	CarSize  int64  // CarSize is the length in bytes of the locally built CAR of the shard.
+	PieceCid string // PieceCid is the piece commitment of the locally built CAR of the shard.
+}
+
+// ShardManifest describes an object that was uploaded in shards.
+// The manifest is uploaded after the shards, and its CID is the CID of the job.
+type ShardManifest struct {
+	Name          string        `json:"name"`
+	Size          int64         `json:"size"`
+	Hash          string        `json:"hash"`
+	HashAlgorithm HashAlgorithm `json:"hash_algorithm"`
+	Shards        []ShardRef    `json:"shards"`
+}
+
+// ReadShardManifest decodes a shard manifest.
+func ReadShardManifest(r io.Reader) (*ShardManifest, error) {
+	var m ShardManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode shard manifest: %v", err)
+	}
+
+	return &m, nil
+}
+
+// Reassemble writes the shards of the object to w, in order. The content of each shard
+// is obtained from open. The size and digest of the reassembled object are checked
+// against the manifest.
+func (m *ShardManifest) Reassemble(w io.Writer, open func(ShardRef) (io.ReadCloser, error)) error {
+	hasher, err := m.HashAlgorithm.newHash()
+	if err != nil {
+		return err
+	}
+	w = io.MultiWriter(w, hasher)
+
+	var offset int64
+	for i, shard := range m.Shards {
+		if shard.Index != i || shard.Offset != offset {
+			return fmt.Errorf("shard %d is out of order", shard.Index)
+		}
+
+		r, err := open(shard)
+		if err != nil {
+			return fmt.Errorf("failed to open shard %d: %v", shard.Index, err)
+		}
+		n, err := io.Copy(w, r)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read shard %d: %v", shard.Index, err)
+		}
+		if n != shard.Size {
+			return fmt.Errorf("shard %d has %d bytes, expected %d", shard.Index, n, shard.Size)
+		}
+		offset += n
+	}
+	if offset != m.Size {
+		return fmt.Errorf("object has %d bytes, expected %d", offset, m.Size)
+	}
+
+	return verifyHash(m.HashAlgorithm, m.Hash, hasher.Sum(nil))
+}
+
+// shardName is the file name a shard of the object is uploaded with.
+func shardName(fname string, idx int) string {
+	return fmt.Sprintf("%s.shard%04d", fname, idx)
+}
+
+// manifestName is the file name the shard manifest of the object is uploaded with.
+func manifestName(fname string) string {
+	return fname + ".manifest.json"
+}
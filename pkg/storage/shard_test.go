@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardManifestReassemble(t *testing.T) {
+	shards := [][]byte{[]byte("hello"), []byte(" world")}
+	manifest := &ShardManifest{
+		Name:          "foo.bar.baz/relname/export.parquet",
+		Size:          11,
+		Hash:          "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad",
+		HashAlgorithm: HashKeccak256,
+		Shards: []ShardRef{
+			{Index: 0, Offset: 0, Size: 5},
+			{Index: 1, Offset: 5, Size: 6},
+		},
+	}
+	open := func(ref ShardRef) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(shards[ref.Index])), nil
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, manifest.Reassemble(&buf, open))
+	assert.Equal(t, []byte("hello world"), buf.Bytes())
+
+	// shards out of order are refused
+	manifest.Shards[0], manifest.Shards[1] = manifest.Shards[1], manifest.Shards[0]
+	assert.Error(t, manifest.Reassemble(io.Discard, open))
+	manifest.Shards[0], manifest.Shards[1] = manifest.Shards[1], manifest.Shards[0]
+
+	// a corrupted shard does not match the hash
+	shards[1] = []byte(" wOrld")
+	var mismatch *HashMismatchError
+	assert.True(t, errors.As(manifest.Reassemble(io.Discard, open), &mismatch))
+
+	// a truncated shard does not match its size
+	shards[1] = []byte(" wor")
+	assert.Error(t, manifest.Reassemble(io.Discard, open))
+}
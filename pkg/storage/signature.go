@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SignatureMode defines how the `signature` metadata was produced over the `hash` metadata.
+type SignatureMode string
+
+const (
+	// SignatureRaw is a secp256k1 signature over the hash itself. It is the default.
+	SignatureRaw SignatureMode = "raw"
+	// SignatureEIP191 is a secp256k1 signature over the EIP-191 personal message prefixed hash.
+	SignatureEIP191 SignatureMode = "eip191"
+	// SignatureAny accepts either a raw or an EIP-191 signature.
+	SignatureAny SignatureMode = "any"
+)
+
+// ParseSignatureMode parses the name of a signing mode.
+// An empty name selects the default mode.
+func ParseSignatureMode(name string) (SignatureMode, error) {
+	switch mode := SignatureMode(strings.ToLower(name)); mode {
+	case "":
+		return SignatureRaw, nil
+	case SignatureRaw, SignatureEIP191, SignatureAny:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported signature mode: %s", name)
+	}
+}
+
+// ErrUnknownSigner is returned when the signer of a signature cannot be told, to provision a namespace.
+var ErrUnknownSigner = errors.New("unknown signer")
+
+// SignatureMismatchError is returned when the signature was not made by the namespace owner.
+type SignatureMismatchError struct {
+	Namespace string
+	Owner     common.Address
+	Signers   []common.Address
+}
+
+func (e *SignatureMismatchError) Error() string {
+	signers := make([]string, len(e.Signers))
+	for i, s := range e.Signers {
+		signers[i] = s.Hex()
+	}
+	return fmt.Sprintf(
+		"signature mismatch: namespace %s is owned by %s, signed by %s",
+		e.Namespace, e.Owner.Hex(), strings.Join(signers, ", "))
+}
+
+// recoverSigner recovers the address that produced sig over digest.
+func recoverSigner(digest []byte, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length: %d", len(sig))
+	}
+
+	// Wallets commonly produce a recovery id of 27 or 28, crypto expects 0 or 1.
+	s := make([]byte, crypto.SignatureLength)
+	copy(s, sig)
+	if s[crypto.RecoveryIDOffset] >= 27 {
+		s[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(digest, s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover public key: %v", err)
+	}
+
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// verifySignature checks that the hex encoded signature over the hex encoded hash
+// was made by owner, according to the given mode.
+func verifySignature(mode SignatureMode, ns string, owner []byte, hash string, sign string) error {
+	if len(owner) != common.AddressLength {
+		return fmt.Errorf("invalid owner address for namespace %s: %x", ns, owner)
+	}
+	ownerAddr := common.BytesToAddress(owner)
+
+	digests, signBytes, err := signatureDigests(mode, hash, sign)
+	if err != nil {
+		return err
+	}
+
+	var signers []common.Address
+	for _, digest := range digests {
+		signer, err := recoverSigner(digest, signBytes)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(signer.Bytes(), ownerAddr.Bytes()) {
+			return nil
+		}
+		signers = append(signers, signer)
+	}
+
+	return &SignatureMismatchError{
+		Namespace: ns,
+		Owner:     ownerAddr,
+		Signers:   signers,
+	}
+}
+
+// recoverSigners recovers the addresses that may have produced the hex encoded signature over
+// the hex encoded hash, according to the mode. With SignatureAny, the signature recovers to
+// a different address for each digest, only one of them is the signer.
+func recoverSigners(mode SignatureMode, hash string, sign string) ([]common.Address, error) {
+	digests, signBytes, err := signatureDigests(mode, hash, sign)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]common.Address, len(digests))
+	for i, digest := range digests {
+		if signers[i], err = recoverSigner(digest, signBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	return signers, nil
+}
+
+// signatureDigests decodes the hex encoded hash and signature, and returns the digests
+// that the signature may have been made over according to the mode, along with the signature.
+func signatureDigests(mode SignatureMode, hash string, sign string) ([][]byte, []byte, error) {
+	hashBytes, err := hex.DecodeString(strings.TrimPrefix(hash, "0x"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode hash: %v", err)
+	}
+	signBytes, err := hex.DecodeString(strings.TrimPrefix(sign, "0x"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	switch mode {
+	case "", SignatureRaw:
+		return [][]byte{hashBytes}, signBytes, nil
+	case SignatureEIP191:
+		return [][]byte{accounts.TextHash(hashBytes)}, signBytes, nil
+	case SignatureAny:
+		return [][]byte{hashBytes, accounts.TextHash(hashBytes)}, signBytes, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported signature mode: %s", mode)
+	}
+}
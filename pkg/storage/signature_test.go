@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignature(t *testing.T) {
+	hash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	rawSig := signHash(testOwnerKey(), hash, SignatureRaw)
+	eip191Sig := signHash(testOwnerKey(), hash, SignatureEIP191)
+
+	// recovery id of 27/28, as produced by most wallets
+	legacySig := rawSig[:128] + "1b"
+	if strings.HasSuffix(rawSig, "01") {
+		legacySig = rawSig[:128] + "1c"
+	}
+
+	tests := []struct {
+		mode       SignatureMode
+		sign       string
+		shouldFail bool
+	}{
+		{mode: SignatureRaw, sign: rawSig},
+		{mode: SignatureRaw, sign: "0x" + rawSig},
+		{mode: SignatureRaw, sign: legacySig},
+		{mode: SignatureRaw, sign: eip191Sig, shouldFail: true},
+		{mode: SignatureEIP191, sign: eip191Sig},
+		{mode: SignatureEIP191, sign: rawSig, shouldFail: true},
+		{mode: SignatureAny, sign: rawSig},
+		{mode: SignatureAny, sign: eip191Sig},
+	}
+
+	for _, tt := range tests {
+		err := verifySignature(tt.mode, "testns", testOwner(), hash, tt.sign)
+		if tt.shouldFail {
+			var mismatch *SignatureMismatchError
+			assert.True(t, errors.As(err, &mismatch), "mode %s", tt.mode)
+		} else {
+			assert.NoError(t, err, "mode %s", tt.mode)
+		}
+	}
+}
+
+func TestVerifySignatureInvalid(t *testing.T) {
+	hash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	sign := signHash(testOwnerKey(), hash, SignatureRaw)
+
+	// truncated signature
+	err := verifySignature(SignatureRaw, "testns", testOwner(), hash, sign[:64])
+	assert.Error(t, err)
+
+	// not hex
+	err = verifySignature(SignatureRaw, "testns", testOwner(), hash, "zz")
+	assert.Error(t, err)
+
+	// owner is not an address
+	err = verifySignature(SignatureRaw, "testns", []byte("test_owner"), hash, sign)
+	assert.Error(t, err)
+
+	// a different owner
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	err = verifySignature(SignatureRaw, "testns", owner.Bytes(), hash, sign)
+	var mismatch *SignatureMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, owner, mismatch.Owner)
+}
+
+func TestParseSignatureMode(t *testing.T) {
+	mode, err := ParseSignatureMode("")
+	require.NoError(t, err)
+	assert.Equal(t, SignatureRaw, mode)
+
+	mode, err = ParseSignatureMode("EIP191")
+	require.NoError(t, err)
+	assert.Equal(t, SignatureEIP191, mode)
+
+	_, err = ParseSignatureMode("eip712")
+	assert.Error(t, err)
+}
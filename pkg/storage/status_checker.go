@@ -2,38 +2,57 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
-	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/tablelandnetwork/basin-storage/pkg/ethereum"
 	"github.com/textileio/go-tableland/pkg/wallet"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
-	w3s "github.com/web3-storage/go-w3s-client"
 )
 
 // StatusCheckerConfig defines the configuration for a StatusChecker.
 type StatusCheckerConfig struct {
-	W3SToken         string
+	DealProviderConfig
 	CrdbConn         string
 	PrivateKey       string
 	BackendURL       string
 	BasinStorageAddr string
 	ChainID          string
+	// WorkerID identifies the checker in the leases of the jobs it claims. Defaults to a unique ID.
+	WorkerID string
+	// LeaseDuration is how long the claimed jobs are leased to the checker, e.g. "10m".
+	LeaseDuration string
+	// ClaimBatchSize is the number of jobs claimed by a single run of the checker.
+	ClaimBatchSize string
 }
 
 // StatusChecker checks the status of a job and updates the status in the DB.
 type StatusChecker struct {
-	// StatusClient is a w3s.Client instance used to interact with W3S.
-	StatusClient w3s.Client
+	// StatusClient is a DealProvider instance used to check deals.
+	StatusClient DealProvider
 	// DBClient is a Crdb instance used to interact with CockroachDB.
 	DBClient Crdb
 	// contractClient is a BasinStorage contract interface
 	contractClient ethereum.BasinStorage
+
+	// WorkerID identifies the checker in the leases of the jobs it claims.
+	WorkerID string
+	// LeaseDuration is how long the claimed jobs are leased to the checker.
+	LeaseDuration time.Duration
+	// ClaimBatchSize is the number of jobs claimed by a single run of the checker.
+	ClaimBatchSize int
+	// ReceiptTimeout is how long the checker waits for the receipt of a tx.
+	ReceiptTimeout time.Duration
+	// ReceiptPollInterval is the delay between two requests of the receipt of a tx.
+	ReceiptPollInterval time.Duration
 }
 
 // NewStatusChecker creates a new StatusChecker.
@@ -69,94 +88,126 @@ func NewStatusChecker(ctx context.Context, cfg *StatusCheckerConfig) (*StatusChe
 		return nil, fmt.Errorf("failed to initialize ethereum client: %v", err)
 	}
 
-	// Initialize web3.storage client to upload file
-	w3sOpts := []w3s.Option{
-		w3s.WithToken(cfg.W3SToken),
-		w3s.WithHTTPClient(
-			&http.Client{
-				Timeout: 0, // no timeout
-			},
-		),
+	workerID := cfg.WorkerID
+	if workerID == "" {
+		workerID = newWorkerID()
+	}
+
+	leaseDuration := defaultLeaseDuration
+	if cfg.LeaseDuration != "" {
+		leaseDuration, err = time.ParseDuration(cfg.LeaseDuration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lease duration: %v", err)
+		}
+	}
+
+	claimBatchSize := defaultClaimBatchSize
+	if cfg.ClaimBatchSize != "" {
+		claimBatchSize, err = strconv.Atoi(cfg.ClaimBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read claim batch size: %v", err)
+		}
 	}
-	w3sClient, err := w3s.NewClient(w3sOpts...)
+
+	// Initialize deal provider to check deals
+	dealClient, err := NewDealProvider(cfg.DealProviderConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize web3.storage client: %v", err)
+		return nil, fmt.Errorf("failed to initialize deal provider: %v", err)
 	}
 
 	// Initialize cockroachdb client to store metadata
-	dbClient, err := NewDB(cfg.CrdbConn)
+	dbClient, err := NewCrdb(cfg.CrdbConn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize db client: %v", err)
 	}
 
 	return &StatusChecker{
-		StatusClient:   w3sClient,
+		StatusClient:   dealClient,
 		DBClient:       dbClient,
 		contractClient: ethClient,
+		WorkerID:       workerID,
+		LeaseDuration:  leaseDuration,
+		ClaimBatchSize: claimBatchSize,
 	}, nil
 }
 
-func (sc *StatusChecker) getStatus(ctx context.Context, CIDBytes []byte) (*w3s.Status, error) {
+func (sc *StatusChecker) getStatus(ctx context.Context, CIDBytes []byte) (*ContentStatus, error) {
 	jobCid, err := cid.Parse(CIDBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse cid: %v", err)
 	}
 	status, err := sc.StatusClient.Status(ctx, jobCid)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call w3s: %v", err)
+		return nil, fmt.Errorf("failed to call deal provider: %v", err)
 	}
 	return status, nil
 }
 
-// addCID prepares Tx to add a CID to the contract.
-func (sc *StatusChecker) addCID(
+// signAddCID prepares and signs the Tx that adds a CID to the contract, without sending it.
+func (sc *StatusChecker) signAddCID(
 	ctx context.Context,
 	pub string,
 	cid string,
 	timestamp int64,
-) error {
+) (*types.Transaction, error) {
 	// prepare tx opts with gas related params
 	txOpts, err := sc.contractClient.EstimateGas(ctx, pub, cid, timestamp)
 	if err != nil {
-		return fmt.Errorf("failed to estimate gas for adding cid: %v", err)
+		return nil, fmt.Errorf("failed to estimate gas for adding cid: %v", err)
 	}
 
 	// set nonce
 	nonce, err := sc.contractClient.GetPendingNonce(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get nonce: %v", err)
+		return nil, fmt.Errorf("failed to get nonce: %v", err)
 	}
 	txOpts.Nonce = big.NewInt(int64(nonce))
 
 	fmt.Println("Adding cid: ", pub, cid, timestamp, nonce)
-	if err = sc.contractClient.AddCID(ctx, pub, cid, timestamp, txOpts); err != nil {
-		return fmt.Errorf("failed to add cid to contract: %v", err)
+	tx, err := sc.contractClient.SignAddCID(ctx, pub, cid, timestamp, txOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tx: %v", err)
 	}
 
-	return nil
+	return tx, nil
 }
 
-// updateJobStatus Updates job status in DB.
+// failJob moves the job to failed with the error, which is returned.
+// The job is tried again on a next run.
+func (sc *StatusChecker) failJob(ctx context.Context, job *UnfinishedJob, err error) error {
+	if uerr := sc.updateJobStatus(ctx, job, JobTransition{
+		Status: JobFailed,
+		Error:  err.Error(),
+	}); uerr != nil {
+		log.Printf("ERROR: %v, job: %s, %x", uerr, job.Pub, job.Cid)
+	}
+	return err
+}
+
+// updateJobStatus moves the job to the status of the transition, unless it is there already.
 func (sc *StatusChecker) updateJobStatus(
 	ctx context.Context,
-	job UnfinishedJob,
-	status *w3s.Status,
+	job *UnfinishedJob,
+	transition JobTransition,
 ) error {
-	fdts := findEarliestDeal(status.Deals).Activation
-	if err := sc.DBClient.UpdateJobStatus(ctx, job.Cid, fdts); err != nil {
+	if job.Status == transition.Status {
+		return nil
+	}
+	if err := sc.DBClient.UpdateJobStatus(ctx, job.Cid, transition); err != nil {
 		return fmt.Errorf("failed to update job status: %v", err)
 	}
-	fmt.Printf("finished updating status for job: %s, %x \n", job.Pub, job.Cid)
+	fmt.Printf("job %s, %x moved from %s to %s\n", job.Pub, job.Cid, job.Status, transition.Status)
+	job.Status = transition.Status
 	return nil
 }
 
 // checkActiveDeals returns true if there are any
 // active deals for the job.
 func (sc *StatusChecker) checkActiveDeals(
-	status *w3s.Status,
+	status *ContentStatus,
 	job UnfinishedJob,
 ) bool {
-	// when there are no deals returned by W3S
+	// when there are no deals returned by the deal provider
 	if len(status.Deals) == 0 {
 		fmt.Printf(
 			"no deals found for job: %s, %x \n",
@@ -165,7 +216,7 @@ func (sc *StatusChecker) checkActiveDeals(
 	}
 
 	// when deals exist, check if they are active
-	deals := []w3s.Deal{}
+	deals := []Deal{}
 	for _, d := range takeActiveDeals(status.Deals) {
 		// filter out deals that are not active yet
 		fmt.Printf("deal status: %s \n", d.Status)
@@ -181,24 +232,69 @@ func (sc *StatusChecker) checkActiveDeals(
 	return true
 }
 
+// processJob moves the job forward in its lifecycle. A job waits for deals until its files
+// all have an active deal, then its CID is added to the contract and it is indexed.
 func (sc *StatusChecker) processJob(
 	ctx context.Context,
 	job UnfinishedJob,
 ) error {
-	fmt.Printf("checking status for job: %s, %x\n", job.Pub, job.Cid)
+	fmt.Printf("checking status for job: %s, %x, %s\n", job.Pub, job.Cid, job.Status)
 	pub := fmt.Sprintf("%s.%s", job.Pub.Namespace, job.Pub.Relation)
 
-	// Check Job status
-	status, err := sc.getStatus(ctx, job.Cid)
-	if err != nil {
-		return fmt.Errorf("failed to get status: %v", err)
+	// A sharded job is only indexed once its manifest and every shard have active deals.
+	// The job is activated when the last of its parts got its first deal activated.
+	var activation time.Time
+	for _, partCid := range append([][]byte{job.Cid}, job.Shards...) {
+		// Check Job status
+		status, err := sc.getStatus(ctx, partCid)
+		if err != nil {
+			return fmt.Errorf("failed to get status: %v", err)
+		}
+
+		// The deals are recorded on every check, whether they are active or not.
+		if len(status.Deals) > 0 {
+			if err := sc.DBClient.UpsertDeals(ctx, job.Cid, partCid, status.Deals); err != nil {
+				return fmt.Errorf("failed to record deals: %v", err)
+			}
+		}
+
+		// Find active activeDeals for the jobs
+		activeDeals := sc.checkActiveDeals(status, job)
+		if !activeDeals {
+			fmt.Println("skipping indexing cid")
+			if len(status.Deals) > 0 && job.Status == JobUploaded {
+				return sc.updateJobStatus(ctx, &job, JobTransition{Status: JobDealsPending})
+			}
+			return nil
+		}
+
+		if fdts := findEarliestDeal(status.Deals).Activation; fdts.After(activation) {
+			activation = fdts
+		}
 	}
 
-	// Find active activeDeals for the jobs
-	activeDeals := sc.checkActiveDeals(status, job)
-	if !activeDeals {
-		fmt.Println("skipping indexing cid")
-		return nil
+	// The tx waits for its receipt, the lease must outlive it so that no other
+	// checker claims the job meanwhile. A lost lease means another checker has it.
+	if err := sc.DBClient.RenewJobLease(ctx, sc.WorkerID, job.Cid, sc.leaseDuration()); err != nil {
+		if errors.Is(err, ErrLeaseLost) {
+			fmt.Printf("lease lost for job: %s, %x\n", job.Pub, job.Cid)
+			return nil
+		}
+		return fmt.Errorf("failed to renew job lease: %v", err)
+	}
+
+	// A job that was submitted already did not get its tx mined by the previous run,
+	// the recorded txs tell whether it is awaited or submitted again.
+	if job.Status != JobTxSubmitted {
+		if err := sc.updateJobStatus(ctx, &job, JobTransition{
+			Status:     JobDealsActive,
+			Activation: activation,
+		}); err != nil {
+			return err
+		}
+		if err := sc.updateJobStatus(ctx, &job, JobTransition{Status: JobTxSubmitted}); err != nil {
+			return err
+		}
 	}
 
 	cid, err := cid.Cast(job.Cid)
@@ -213,25 +309,33 @@ func (sc *StatusChecker) processJob(
 		ts = *job.Timestamp
 	}
 
-	if err := sc.addCID(ctx, pub, cid.String(), ts); err != nil {
-		return fmt.Errorf("failed to add cid: %v", err)
-	}
-
-	return sc.updateJobStatus(ctx, job, status)
+	return sc.indexJob(ctx, &job, pub, cid.String(), ts)
 }
 
-// ProcessJobs checks the status of all unfinished jobs.
-// If a job has active deals, it adds the "CID" to the BasinStorage contract.
-// If a job has no active deals, it does nothing.
-// If a job has already been activated, it does nothing.
-// Finally, it updates the job status in the DB.
+// ProcessJobs claims a batch of unfinished jobs and checks their status.
+// If a job has deals that are not active yet, it moves to deals_pending.
+// If a job has active deals, it moves to deals_active, and its "CID" is added
+// to the BasinStorage contract, moving it to tx_submitted, then to indexed.
+// If the CID cannot be added, the job moves to failed, and is tried again on a next run.
+// The txs are recorded in onchain_txs, a job whose tx is pending or mined is not submitted again.
+// The claimed jobs are leased to the checker until they are processed, so that several
+// checkers can run at once without adding the same CID twice.
 func (sc *StatusChecker) ProcessJobs(ctx context.Context) error {
-	unfinishedJobs, err := sc.DBClient.UnfinishedJobs(ctx)
+	claimedJobs, err := sc.DBClient.ClaimJobs(ctx, sc.WorkerID, sc.claimBatchSize(), sc.leaseDuration())
 	if err != nil {
-		return fmt.Errorf("failed to get unfinished jobs: %v", err)
+		return fmt.Errorf("failed to claim jobs: %v", err)
 	}
 
-	for _, job := range unfinishedJobs {
+	jobs := mergeAggregatedJobs(claimedJobs)
+	defer func() {
+		for _, job := range jobs {
+			if err := sc.DBClient.ReleaseJobLease(ctx, sc.WorkerID, job.Cid); err != nil {
+				log.Printf("ERROR: %v, job: %s, %x", err, job.Pub, job.Cid)
+			}
+		}
+	}()
+
+	for _, job := range jobs {
 		if err := sc.processJob(ctx, job); err != nil {
 			return fmt.Errorf("failed to process job: %v", err)
 		}
@@ -240,7 +344,41 @@ func (sc *StatusChecker) ProcessJobs(ctx context.Context) error {
 	return nil
 }
 
-func findEarliestDeal(deals []w3s.Deal) w3s.Deal {
+func (sc *StatusChecker) leaseDuration() time.Duration {
+	if sc.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return sc.LeaseDuration
+}
+
+func (sc *StatusChecker) claimBatchSize() int {
+	if sc.ClaimBatchSize <= 0 {
+		return defaultClaimBatchSize
+	}
+	return sc.ClaimBatchSize
+}
+
+// mergeAggregatedJobs merges the jobs of the objects of an aggregate, they share the root CID
+// of the aggregate, which is added to the contract once, with the latest of their timestamps.
+func mergeAggregatedJobs(jobs []UnfinishedJob) []UnfinishedJob {
+	var merged []UnfinishedJob
+	index := map[string]int{}
+	for _, job := range jobs {
+		key := fmt.Sprintf("%s.%s/%x", job.Pub.Namespace, job.Pub.Relation, job.Cid)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, job)
+			continue
+		}
+		if job.Timestamp != nil && (merged[i].Timestamp == nil || *job.Timestamp > *merged[i].Timestamp) {
+			merged[i].Timestamp = job.Timestamp
+		}
+	}
+	return merged
+}
+
+func findEarliestDeal(deals []Deal) Deal {
 	earliestDeal := deals[0]
 	for _, d := range deals {
 		if d.Activation.Before(earliestDeal.Activation) {
@@ -250,11 +388,11 @@ func findEarliestDeal(deals []w3s.Deal) w3s.Deal {
 	return earliestDeal
 }
 
-func takeActiveDeals(deals []w3s.Deal) []w3s.Deal {
-	activeDeals := []w3s.Deal{}
+func takeActiveDeals(deals []Deal) []Deal {
+	activeDeals := []Deal{}
 
 	for _, d := range deals {
-		if d.Status == w3s.DealStatusActive {
+		if d.Status == DealStatusActive {
 			activeDeals = append(activeDeals, d)
 		}
 	}
@@ -2,10 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStatusChecker(t *testing.T) {
@@ -13,33 +15,33 @@ func TestStatusChecker(t *testing.T) {
 	bsc := &MockBasinStorage{
 		cids: []string{},
 	}
-	db := &mockCrdb{
-		jobs: []UnfinishedJob{
-			{
-				Pub: Pub{Namespace: "testns", Relation: "testrel"},
-				Cid: getCIDFromBytes([]byte("data for myfile")).Bytes(),
-				// marked as active and deals are active on chain
-				// CID should be skipped
-				Activated: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
-			},
-			{
-				Pub: Pub{Namespace: "testns2", Relation: "testrel2"},
-				Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes(),
-				// not marked as active but deals are active on chain
-				// CID should be added
-				Activated: time.Time{},
-			},
-			{
-				Pub: Pub{Namespace: "testns", Relation: "testrel3"},
-				Cid: getCIDFromBytes([]byte("data for myfile3")).Bytes(),
-				// not marked as active and deals are in queue
-				// CID cannot be added
-				Activated: time.Time{},
-			},
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: getCIDFromBytes([]byte("data for myfile")).Bytes(),
+			// indexed and deals are active on chain
+			// CID should be skipped
+			Status:    JobIndexed,
+			Activated: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
 		},
-	}
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns2", Relation: "testrel2"},
+			Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes(),
+			// not marked as active but deals are active on chain
+			// CID should be added
+			Activated: time.Time{},
+		},
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel3"},
+			Cid: getCIDFromBytes([]byte("data for myfile3")).Bytes(),
+			// not marked as active and deals are in queue
+			// CID cannot be added
+			Activated: time.Time{},
+		},
+	)
 	sc := StatusChecker{
-		StatusClient:   &mockW3sClient{},
+		StatusClient:   &W3SProvider{Client: &mockW3sClient{}},
 		DBClient:       db,
 		contractClient: bsc,
 	}
@@ -51,8 +53,30 @@ func TestStatusChecker(t *testing.T) {
 	assert.Equal(t, 1, len(bsc.cids))
 	assert.Equal(t, expectedCidStr, bsc.cids[0])
 
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	assert.Equal(t, JobIndexed, testJobs(db)[1].Status)
+	assert.Equal(t, JobDealsPending, testJobs(db)[2].Status)
+
+	// the deals of the checked jobs are recorded, whether they are active or not
+	deals, err := db.PubDeals(ctx, Pub{Namespace: "testns2", Relation: "testrel2"})
+	assert.NoError(t, err)
+	require.Len(t, deals, 2)
+	assert.Equal(t, uint64(1), deals[0].DealID)
+	assert.Equal(t, "bar/foo", deals[0].DataModelSelector)
+	assert.Equal(t, DealStatusActive, deals[1].Status)
+	assert.Equal(t, time.Date(2021, time.January, 5, 5, 0, 0, 0, time.UTC), deals[1].Activation)
+	deals, err = db.PubDeals(ctx, Pub{Namespace: "testns", Relation: "testrel3"})
+	assert.NoError(t, err)
+	require.Len(t, deals, 2)
+	assert.Equal(t, DealStatusQueued, deals[0].Status)
+	assert.Equal(t, DealStatusPublished, deals[1].Status)
+	// the indexed job is not checked anymore
+	deals, err = db.PubDeals(ctx, Pub{Namespace: "testns", Relation: "testrel"})
+	assert.NoError(t, err)
+	assert.Empty(t, deals)
+
 	var ts time.Time
-	for _, j := range db.jobs {
+	for _, j := range testJobs(db) {
 		if j.Pub.Relation == "testrel" {
 			ts = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
 			assert.Equal(t, ts, j.Activated)
@@ -69,3 +93,260 @@ func TestStatusChecker(t *testing.T) {
 		}
 	}
 }
+
+func TestStatusCheckerShards(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids: []string{},
+	}
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes(),
+			// the manifest and one shard have active deals, the other shard is queued
+			// CID cannot be added
+			Shards: [][]byte{
+				getCIDFromBytes([]byte("data for myfile")).Bytes(),
+				getCIDFromBytes([]byte("data for myfile3")).Bytes(),
+			},
+		},
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel2"},
+			Cid: getCIDFromBytes([]byte("data for myfile")).Bytes(),
+			// the manifest and all shards have active deals
+			// CID should be added
+			Shards: [][]byte{
+				getCIDFromBytes([]byte("data for myfile")).Bytes(),
+				getCIDFromBytes([]byte("data for myfile2")).Bytes(),
+			},
+		},
+	)
+	sc := StatusChecker{
+		StatusClient:   &W3SProvider{Client: &mockW3sClient{}},
+		DBClient:       db,
+		contractClient: bsc,
+	}
+	assert.NoError(t, sc.ProcessJobs(ctx))
+
+	assert.Equal(t, []string{getCIDFromBytes([]byte("data for myfile")).String()}, bsc.cids)
+
+	// not activated
+	assert.Equal(t, time.Time{}, testJobs(db)[0].Activated)
+
+	// activated when the last part got its first active deal
+	assert.Equal(t, time.Date(2021, time.January, 5, 3, 0, 0, 0, time.UTC), testJobs(db)[1].Activated)
+}
+
+func TestStatusCheckerFailedTx(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids: []string{},
+		err:  errors.New("execution reverted"),
+	}
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes(),
+		},
+	)
+	sc := StatusChecker{
+		StatusClient:   &W3SProvider{Client: &mockW3sClient{}},
+		DBClient:       db,
+		contractClient: bsc,
+	}
+
+	// the deals are active, but the tx fails
+	assert.Error(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobFailed, testJobs(db)[0].Status)
+	require.Len(t, db.transitions, 3)
+	assert.Equal(t, JobDealsActive, db.transitions[0].to)
+	assert.Equal(t, JobTxSubmitted, db.transitions[1].to)
+	assert.Equal(t, JobFailed, db.transitions[2].to)
+	assert.Contains(t, db.transitions[2].err, "execution reverted")
+
+	// the failed job is indexed by the next run
+	bsc.err = nil
+	assert.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	assert.Equal(t, []string{getCIDFromBytes([]byte("data for myfile2")).String()}, bsc.cids)
+}
+
+func TestStatusCheckerTxs(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids:    []string{},
+		pending: true,
+	}
+	jobCid := getCIDFromBytes([]byte("data for myfile2"))
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: jobCid.Bytes(),
+		},
+	)
+	sc := StatusChecker{
+		StatusClient:        &W3SProvider{Client: &mockW3sClient{}},
+		DBClient:            db,
+		contractClient:      bsc,
+		ReceiptTimeout:      10 * time.Millisecond,
+		ReceiptPollInterval: time.Millisecond,
+	}
+
+	// the tx is recorded before it is sent, it is not mined in time
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobTxSubmitted, testJobs(db)[0].Status)
+	txs := testTxs(db, jobCid.Bytes())
+	require.Len(t, txs, 1)
+	assert.Equal(t, TxPending, txs[0].Status)
+	assert.Equal(t, uint64(100000), txs[0].GasLimit)
+	assert.NotEmpty(t, txs[0].Raw)
+	assert.Equal(t, 1, bsc.sent)
+
+	// the pending tx is sent again by the next run, no other tx is submitted
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Len(t, testTxs(db, jobCid.Bytes()), 1)
+	assert.Equal(t, 2, bsc.sent)
+	assert.Empty(t, bsc.cids)
+
+	// once mined, its receipt is recorded and the job indexed
+	bsc.pending = false
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	txs = testTxs(db, jobCid.Bytes())
+	require.Len(t, txs, 1)
+	assert.Equal(t, TxSuccess, txs[0].Status)
+	assert.Equal(t, uint64(1), txs[0].BlockNumber)
+	assert.Equal(t, uint64(21000), txs[0].GasUsed)
+	assert.False(t, txs[0].ReceiptAt.IsZero())
+	assert.Equal(t, []string{jobCid.String()}, bsc.cids)
+
+	// a job whose tx succeeded is indexed without submitting another tx
+	setTestJobStatus(db, jobCid.Bytes(), JobTxSubmitted)
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	assert.Len(t, testTxs(db, jobCid.Bytes()), 1)
+	assert.Equal(t, 2, bsc.sent)
+	assert.Equal(t, []string{jobCid.String()}, bsc.cids)
+}
+
+func TestStatusCheckerRevertedTx(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids:     []string{},
+		reverted: true,
+	}
+	jobCid := getCIDFromBytes([]byte("data for myfile2"))
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: jobCid.Bytes(),
+		},
+	)
+	sc := StatusChecker{
+		StatusClient:   &W3SProvider{Client: &mockW3sClient{}},
+		DBClient:       db,
+		contractClient: bsc,
+	}
+
+	// the reverted tx is recorded, and the job fails
+	assert.Error(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobFailed, testJobs(db)[0].Status)
+	txs := testTxs(db, jobCid.Bytes())
+	require.Len(t, txs, 1)
+	assert.Equal(t, TxReverted, txs[0].Status)
+
+	// the next run submits a new tx
+	bsc.reverted = false
+	require.NoError(t, sc.ProcessJobs(ctx))
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	txs = testTxs(db, jobCid.Bytes())
+	require.Len(t, txs, 2)
+	assert.Equal(t, TxSuccess, txs[1].Status)
+	assert.NotEqual(t, txs[0].Hash, txs[1].Hash)
+	assert.Equal(t, []string{jobCid.String()}, bsc.cids)
+}
+
+func TestJobStatusTransitions(t *testing.T) {
+	assert.True(t, JobUploaded.CanTransition(JobDealsPending))
+	assert.True(t, JobDealsPending.CanTransition(JobDealsActive))
+	assert.True(t, JobDealsActive.CanTransition(JobTxSubmitted))
+	assert.True(t, JobTxSubmitted.CanTransition(JobIndexed))
+	assert.True(t, JobTxSubmitted.CanTransition(JobFailed))
+	assert.True(t, JobFailed.CanTransition(JobDealsActive))
+
+	// deals must be active before the tx, and indexed jobs are final
+	assert.False(t, JobUploaded.CanTransition(JobTxSubmitted))
+	assert.False(t, JobDealsPending.CanTransition(JobIndexed))
+	assert.False(t, JobFailed.CanTransition(JobIndexed))
+	assert.False(t, JobIndexed.CanTransition(JobFailed))
+	assert.False(t, JobIndexed.CanTransition(JobUploaded))
+}
+
+func TestStatusCheckerLeases(t *testing.T) {
+	ctx := context.Background()
+	bsc := &MockBasinStorage{
+		cids: []string{},
+	}
+	db := NewMemDB()
+	addTestJobs(t, db,
+		UnfinishedJob{
+			Pub: Pub{Namespace: "testns", Relation: "testrel"},
+			Cid: getCIDFromBytes([]byte("data for myfile2")).Bytes(),
+		},
+	)
+	checker := func(worker string) *StatusChecker {
+		return &StatusChecker{
+			StatusClient:   &W3SProvider{Client: &mockW3sClient{}},
+			DBClient:       db,
+			contractClient: bsc,
+			WorkerID:       worker,
+			LeaseDuration:  time.Minute,
+		}
+	}
+
+	// the job is leased to another checker, it is skipped
+	claimed, err := db.ClaimJobs(ctx, "other", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, checker("checker").ProcessJobs(ctx))
+	assert.Empty(t, bsc.cids)
+	assert.Equal(t, JobUploaded, testJobs(db)[0].Status)
+
+	// a batch is bounded, but returns the jobs leased to the checker already,
+	// the other checker cannot renew a released lease
+	claimed, err = db.ClaimJobs(ctx, "third", 0, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	claimed, err = db.ClaimJobs(ctx, "other", 0, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	require.NoError(t, db.ReleaseJobLease(ctx, "other", testJobs(db)[0].Cid))
+	assert.ErrorIs(t, db.RenewJobLease(ctx, "other", testJobs(db)[0].Cid, time.Minute), ErrLeaseLost)
+
+	// once released, the job is claimed and indexed, and its lease released
+	require.NoError(t, checker("checker").ProcessJobs(ctx))
+	assert.Equal(t, []string{getCIDFromBytes([]byte("data for myfile2")).String()}, bsc.cids)
+	assert.Equal(t, JobIndexed, testJobs(db)[0].Status)
+	for _, job := range db.jobs {
+		assert.Empty(t, job.leaseOwner)
+	}
+
+	// an expired lease can be claimed by another checker
+	addTestJobs(t, db, UnfinishedJob{
+		Pub: Pub{Namespace: "testns", Relation: "testrel2"},
+		Cid: getCIDFromBytes([]byte("data for myfile3")).Bytes(),
+	})
+	claimed, err = db.ClaimJobs(ctx, "other", 10, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	time.Sleep(5 * time.Millisecond)
+	claimed, err = db.ClaimJobs(ctx, "checker", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.ErrorIs(t, db.RenewJobLease(ctx, "other", claimed[0].Cid, time.Minute), ErrLeaseLost)
+	assert.NoError(t, db.RenewJobLease(ctx, "checker", claimed[0].Cid, time.Minute))
+}
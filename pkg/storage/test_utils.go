@@ -3,28 +3,90 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	eth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/ipld/go-car"
 	mh "github.com/multiformats/go-multihash"
+	"github.com/tablelandnetwork/basin-storage/pkg/ethereum"
 
 	w3s "github.com/web3-storage/go-w3s-client"
 	w3http "github.com/web3-storage/go-w3s-client/http"
 )
 
-// Mock interface for w3s.Client.
+// Mock interface for w3s.Client. It also serves the /car endpoint of web3.storage,
+// see newTestW3SProvider.
 type mockW3sClient struct {
-	Files []fs.File
+	Files []mockFile
+	// PutCid overrides the cid returned by the /car endpoint, when defined.
+	PutCid cid.Cid
+
+	mu sync.Mutex
+	// dags are the blocks received for the root of a CAR, until its DAG is complete.
+	dags map[cid.Cid]blockstore.Blockstore
+}
+
+// mockFile is a file that was put to the mock w3s client.
+type mockFile struct {
+	Name string
+	Size int64
+	Data []byte
 }
 
 func mockData() []byte {
 	return []byte("hello world")
 }
 
+// mockParquet returns a Parquet export of 5 rows in 3 row groups.
+func mockParquet() []byte {
+	data, err := os.ReadFile("testdata/export.parquet")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// mockParquetHash returns the hex encoded keccak256 digest of mockParquet.
+func mockParquetHash() string {
+	return hex.EncodeToString(crypto.Keccak256(mockParquet()))
+}
+
+// mockRangeReader serves the range reads of a mocked object with content data.
+func mockRangeReader(data []byte) func(context.Context, string, string, int64, int64) (io.ReadCloser, error) {
+	return func(_ context.Context, _, _ string, offset, length int64) (io.ReadCloser, error) {
+		return &MockReadCloser{Reader: bytes.NewReader(data[offset : offset+length])}, nil
+	}
+}
+
 func getCIDFromBytes(mockData []byte) cid.Cid {
 	hashedData := sha256.Sum256(mockData)
 	multihash, _ := mh.Encode(hashedData[:], mh.SHA2_256)
@@ -32,9 +94,129 @@ func getCIDFromBytes(mockData []byte) cid.Cid {
 	return cidV1
 }
 
-func (m *mockW3sClient) Put(_ context.Context, file fs.File, _ ...w3s.PutOption) (cid.Cid, error) {
-	m.Files = append(m.Files, file)
-	return getCIDFromBytes(mockData()), nil
+// getRootFromBytes returns the root CID that web3.storage derives for a file.
+func getRootFromBytes(data []byte, name string) cid.Cid {
+	file := NewIntermediateFile(&MockReadCloser{Reader: bytes.NewReader(data)}, name, int64(len(data)))
+	root, _ := writeCAR(context.Background(), file, io.Discard)
+	return root
+}
+
+// Put is not used, files are uploaded to the /car endpoint.
+func (m *mockW3sClient) Put(_ context.Context, _ fs.File, _ ...w3s.PutOption) (cid.Cid, error) {
+	return cid.Undef, errors.New("files are uploaded to the /car endpoint")
+}
+
+// ServeHTTP serves the /car endpoint of web3.storage. The blocks of the parts of a CAR are kept
+// until the DAG of its root is complete, then the files of the DAG are recorded.
+func (m *mockW3sClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/car" {
+		http.NotFound(w, r)
+		return
+	}
+	cr, err := car.NewCarReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root := cr.Header.Roots[0]
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dags == nil {
+		m.dags = map[cid.Cid]blockstore.Blockstore{}
+	}
+	bs, ok := m.dags[root]
+	if !ok {
+		bs = blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+		m.dags[root] = bs
+	}
+	for {
+		block, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := bs.Put(r.Context(), block); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	files, err := readDAGFiles(r.Context(), bs, root)
+	if err != nil && !format.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		m.Files = append(m.Files, files...)
+		delete(m.dags, root)
+	}
+
+	if m.PutCid.Defined() {
+		root = m.PutCid
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"cid": root.String()})
+}
+
+// readDAGFiles reads the files of the UnixFS directory of the root, by path. A single file is
+// wrapped in a directory. It fails with a not found error until every block of the DAG is in
+// the blockstore.
+func readDAGFiles(ctx context.Context, bs blockstore.Blockstore, root cid.Cid) ([]mockFile, error) {
+	dag := merkledag.NewDAGService(bserv.New(bs, nil))
+	if err := dagComplete(ctx, dag, root); err != nil {
+		return nil, err
+	}
+	node, err := dag.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []mockFile
+	var walk func(node format.Node, dir string) error
+	walk = func(node format.Node, dir string) error {
+		d, err := uio.NewDirectoryFromNode(dag, node)
+		if err != nil {
+			return err
+		}
+		return d.ForEachLink(ctx, func(l *format.Link) error {
+			n, err := l.GetNode(ctx, dag)
+			if err != nil {
+				return err
+			}
+			name := path.Join(dir, l.Name)
+			r, err := uio.NewDagReader(ctx, n, dag)
+			if errors.Is(err, uio.ErrIsDir) {
+				return walk(n, name)
+			}
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			files = append(files, mockFile{Name: name, Size: int64(len(data)), Data: data})
+			return nil
+		})
+	}
+	return files, walk(node, "")
+}
+
+// dagComplete fails with a not found error while a block of the DAG of the root is missing.
+func dagComplete(ctx context.Context, dag format.DAGService, root cid.Cid) error {
+	node, err := dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	for _, l := range node.Links() {
+		if err := dagComplete(ctx, dag, l.Cid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *mockW3sClient) Get(_ context.Context, _ cid.Cid) (*w3http.Web3Response, error) {
@@ -139,60 +321,49 @@ func (mrc *MockReadCloser) Close() error {
 	return nil
 }
 
-type mockCrdb struct {
-	jobs []UnfinishedJob
+// testOwnerKey returns the key of the namespace owner used in tests.
+func testOwnerKey() *ecdsa.PrivateKey {
+	key, _ := crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	return key
 }
 
-func (m *mockCrdb) CreateJob(
-	_ context.Context,
-	cidStr string,
-	fname string,
-	timestamp *int64,
-	cacheDuration int64,
-	_ string,
-	_ string,
-) error {
-	cid, _ := cid.Decode(cidStr)
-	pub, err := extractPub(fname)
-	if err != nil {
-		return err
-	}
-	m.jobs = append(m.jobs, UnfinishedJob{
-		Pub:       pub,
-		Cid:       cid.Bytes(),
-		Activated: time.Time{},
-		Timestamp: timestamp,
-		ExpiresAt: time.Unix(*timestamp+cacheDuration, 0),
-	})
-	return nil
-}
-
-func (m *mockCrdb) UnfinishedJobs(_ context.Context) ([]UnfinishedJob, error) {
-	var t time.Time
-	ufj := []UnfinishedJob{}
-	for _, job := range m.jobs {
-		if job.Activated == t {
-			ufj = append(ufj, job)
-		}
-	}
-	return ufj, nil
+// testOwner returns the address of the namespace owner used in tests.
+func testOwner() []byte {
+	return crypto.PubkeyToAddress(testOwnerKey().PublicKey).Bytes()
 }
 
-func (m *mockCrdb) UpdateJobStatus(_ context.Context, cid []byte, activation time.Time) error {
-	for i, job := range m.jobs {
-		if bytes.Equal(job.Cid, cid) {
-			m.jobs[i].Activated = activation
-			break
-		}
+// signHash signs the hex encoded hash with the key, and returns the hex encoded signature.
+func signHash(key *ecdsa.PrivateKey, hash string, mode SignatureMode) string {
+	digest, _ := hex.DecodeString(hash)
+	if mode == SignatureEIP191 {
+		digest = accounts.TextHash(digest)
 	}
-	return nil
+	sig, _ := crypto.Sign(digest, key)
+	return hex.EncodeToString(sig)
 }
 
 // MockBasinStorage is the mock type for BasinStorage Contract.
 type MockBasinStorage struct {
+	// cids are the cids added by the mined txs.
 	cids []string
+	// err, when set, is returned by SignAddCID.
+	err error
+	// pending, when set, keeps the sent txs from being mined.
+	pending bool
+	// reverted, when set, reverts the mined txs.
+	reverted bool
+	// sent counts the txs sent, including the ones sent again.
+	sent  int
+	nonce uint64
+	txs   map[common.Hash]*types.Transaction
+	mined map[common.Hash]*types.Receipt
+	// pubs are the owners of the pubs created by the mined txs.
+	pubs map[string]common.Address
 }
 
+// createPubPrefix prefixes the data of the mock txs that create a pub.
+const createPubPrefix = "createPub:"
+
 // EstimateGas is a mock implementation of BasinStorage.EstimateGas.
 func (c *MockBasinStorage) EstimateGas(
 	_ context.Context,
@@ -207,18 +378,152 @@ func (c *MockBasinStorage) EstimateGas(
 func (c *MockBasinStorage) GetPendingNonce(
 	_ context.Context,
 ) (uint64, error) {
-	return 0, nil
+	return c.nonce, nil
 }
 
-// AddCID is a mock implementation of BasinStorage.AddCID.
-func (c *MockBasinStorage) AddCID(
+// SignAddCID is a mock implementation of BasinStorage.SignAddCID. The cid is the data of the tx.
+func (c *MockBasinStorage) SignAddCID(
 	_ context.Context,
 	_ string,
-	cids string,
+	cid string,
 	_ int64,
-	_ *bind.TransactOpts,
-) error {
-	time.Sleep(1 * time.Second) // fake delay
-	c.cids = append(c.cids, cids)
+	opts *bind.TransactOpts,
+) (*types.Transaction, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.nonce++
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     opts.Nonce.Uint64(),
+		Gas:       100000,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Data:      []byte(cid),
+	}), nil
+}
+
+// PubExists is a mock implementation of BasinStorage.PubExists.
+func (c *MockBasinStorage) PubExists(_ context.Context, owner common.Address, pub string) (bool, error) {
+	created, ok := c.pubs[pub]
+	return ok && created == owner, nil
+}
+
+// EstimateCreatePubGas is a mock implementation of BasinStorage.EstimateCreatePubGas.
+// Like the contract, it fails when the pub exists, whichever its owner.
+func (c *MockBasinStorage) EstimateCreatePubGas(
+	_ context.Context,
+	_ common.Address,
+	pub string,
+) (*bind.TransactOpts, error) {
+	if _, ok := c.pubs[pub]; ok {
+		return nil, fmt.Errorf("%w: %s", ethereum.ErrPubAlreadyExists, pub)
+	}
+	return &bind.TransactOpts{}, nil
+}
+
+// SignCreatePub is a mock implementation of BasinStorage.SignCreatePub. The pub is the data of the tx,
+// and the owner its recipient.
+func (c *MockBasinStorage) SignCreatePub(
+	_ context.Context,
+	owner common.Address,
+	pub string,
+	opts *bind.TransactOpts,
+) (*types.Transaction, error) {
+	c.nonce++
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     opts.Nonce.Uint64(),
+		To:        &owner,
+		Gas:       100000,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Data:      []byte(createPubPrefix + pub),
+	}), nil
+}
+
+// SendTx is a mock implementation of BasinStorage.SendTx.
+func (c *MockBasinStorage) SendTx(_ context.Context, tx *types.Transaction) error {
+	if c.txs == nil {
+		c.txs = map[common.Hash]*types.Transaction{}
+	}
+	c.sent++
+	if _, ok := c.txs[tx.Hash()]; ok {
+		return errors.New("already known")
+	}
+	c.txs[tx.Hash()] = tx
 	return nil
 }
+
+// TxReceipt is a mock implementation of BasinStorage.TxReceipt. The sent txs are
+// mined when their receipt is requested, unless they are pending.
+func (c *MockBasinStorage) TxReceipt(_ context.Context, hash common.Hash) (*types.Receipt, error) {
+	if receipt, ok := c.mined[hash]; ok {
+		return receipt, nil
+	}
+	tx, ok := c.txs[hash]
+	if !ok || c.pending {
+		return nil, eth.NotFound
+	}
+	if c.mined == nil {
+		c.mined = map[common.Hash]*types.Receipt{}
+	}
+	receipt := &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		TxHash:      hash,
+		BlockNumber: big.NewInt(int64(len(c.mined) + 1)),
+		GasUsed:     21000,
+	}
+	if c.reverted {
+		receipt.Status = types.ReceiptStatusFailed
+	} else if pub, ok := strings.CutPrefix(string(tx.Data()), createPubPrefix); ok {
+		if c.pubs == nil {
+			c.pubs = map[string]common.Address{}
+		}
+		if _, ok := c.pubs[pub]; ok {
+			receipt.Status = types.ReceiptStatusFailed
+		} else {
+			c.pubs[pub] = *tx.To()
+		}
+	} else {
+		c.cids = append(c.cids, string(tx.Data()))
+	}
+	c.mined[hash] = receipt
+	return receipt, nil
+}
+
+// randomFile is a file of size random bytes, that are generated as the file is read.
+// Random bytes are not deduplicated when they are chunked, each chunk is another block.
+func randomFile(name string, size int64) fs.File {
+	r := io.LimitReader(rand.New(rand.NewSource(size)), size)
+	return NewIntermediateFile(io.NopCloser(r), name, size)
+}
+
+// peakHeapGrowth runs f and returns by how much the heap grew at most while f was running.
+func peakHeapGrowth(f func()) uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base, peak := stats.HeapAlloc, stats.HeapAlloc
+
+	done, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	f()
+	close(done)
+	<-sampled
+
+	return peak - base
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Types of the Thrift compact protocol.
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+// thriftMaxDepth bounds the nesting of skipped values.
+const thriftMaxDepth = 64
+
+// thriftReader decodes the subset of the Thrift compact protocol needed
+// to read Parquet file metadata.
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func newThriftReader(data []byte) *thriftReader {
+	return &thriftReader{r: bytes.NewReader(data)}
+}
+
+func (t *thriftReader) readVarint() (uint64, error) {
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read varint: %v", err)
+	}
+	return v, nil
+}
+
+func (t *thriftReader) readInt() (int64, error) {
+	v, err := t.readVarint()
+	if err != nil {
+		return 0, err
+	}
+	// zigzag decoding
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (t *thriftReader) readI32() (int32, error) {
+	v, err := t.readInt()
+	return int32(v), err
+}
+
+func (t *thriftReader) readByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read byte: %v", err)
+	}
+	return b, nil
+}
+
+func (t *thriftReader) readBinary() ([]byte, error) {
+	n, err := t.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(t.r.Len()) {
+		return nil, fmt.Errorf("binary length %d exceeds remaining %d bytes", n, t.r.Len())
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(t.r, b); err != nil {
+		return nil, fmt.Errorf("failed to read binary: %v", err)
+	}
+	return b, nil
+}
+
+// readBool reads a boolean struct field, whose value is encoded in its type.
+func (t *thriftReader) readBool(typ byte) bool {
+	return typ == thriftTrue
+}
+
+// readList reads a list header and returns the type and number of its elements.
+func (t *thriftReader) readList() (byte, int, error) {
+	b, err := t.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := int(b >> 4)
+	if size == 15 {
+		n, err := t.readVarint()
+		if err != nil {
+			return 0, 0, err
+		}
+		// every element takes at least one byte
+		if n > uint64(t.r.Len()) {
+			return 0, 0, fmt.Errorf("list size %d exceeds remaining %d bytes", n, t.r.Len())
+		}
+		size = int(n)
+	}
+	return b & 0x0f, size, nil
+}
+
+// readStruct reads the fields of a struct until its stop field. The field func must
+// consume the value of every field, or skip it.
+func (t *thriftReader) readStruct(field func(id int16, typ byte) error) error {
+	var id int16
+	for {
+		b, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		typ := b & 0x0f
+		if typ == thriftStop {
+			return nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := t.readInt()
+			if err != nil {
+				return err
+			}
+			id = int16(v)
+		}
+		if err := field(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// skip reads and discards a value of the given type.
+func (t *thriftReader) skip(typ byte) error {
+	return t.skipDepth(typ, 0)
+}
+
+func (t *thriftReader) skipDepth(typ byte, depth int) error {
+	if depth > thriftMaxDepth {
+		return fmt.Errorf("values are nested too deep")
+	}
+
+	switch typ {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := t.readByte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := t.readVarint()
+		return err
+	case thriftDouble:
+		_, err := t.r.Seek(8, io.SeekCurrent)
+		return err
+	case thriftBinary:
+		_, err := t.readBinary()
+		return err
+	case thriftList, thriftSet:
+		elemType, size, err := t.readList()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := t.skipElem(elemType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftMap:
+		size, err := t.readVarint()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if size > uint64(t.r.Len()) {
+			return fmt.Errorf("map size %d exceeds remaining %d bytes", size, t.r.Len())
+		}
+		types, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := t.skipElem(types>>4, depth+1); err != nil {
+				return err
+			}
+			if err := t.skipElem(types&0x0f, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftStruct:
+		return t.readStruct(func(_ int16, typ byte) error {
+			return t.skipDepth(typ, depth+1)
+		})
+	default:
+		return fmt.Errorf("unknown thrift type: %d", typ)
+	}
+}
+
+// skipElem skips an element of a list, set or map. Unlike struct fields,
+// boolean elements are encoded in a byte.
+func (t *thriftReader) skipElem(typ byte, depth int) error {
+	if typ == thriftTrue || typ == thriftFalse {
+		_, err := t.readByte()
+		return err
+	}
+	return t.skipDepth(typ, depth)
+}
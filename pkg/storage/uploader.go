@@ -1,78 +1,231 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"strconv"
-
-	w3s "github.com/web3-storage/go-w3s-client"
+	"time"
 )
 
-// FileUploader download a file from GCS and uploads to web3.storage.
+// FileUploader download a file from an object store and uploads it to a deal provider.
 type FileUploader struct {
-	StorageClient GCS        // StorageClient is a GCS instance used to interact with GCS.
-	DealClient    w3s.Client // DealClient is a w3s.Client instance used to interact with W3S.
-	DBClient      Crdb       // DBClient is a Crdb instance used to interact with CockroachDB.
+	StorageClient ObjectStore  // StorageClient is an ObjectStore instance used to read exported files.
+	DealClient    DealProvider // DealClient is a DealProvider instance used to archive files.
+	DBClient      Crdb         // DBClient is a Crdb instance used to interact with CockroachDB.
+
+	// HashAlgorithm is the digest used to verify the object against its `hash` metadata.
+	HashAlgorithm HashAlgorithm
+	// SignatureMode defines how the `signature` metadata is verified against the namespace owner.
+	SignatureMode SignatureMode
+	// ShardSize is the size in bytes above which objects are uploaded in shards. Zero disables sharding.
+	ShardSize int64
+	// MaxAttempts is the number of attempts after which a failed upload is flagged as permanent.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry of a failed upload, it doubles on every attempt.
+	RetryBackoff time.Duration
+	// AggregateSize is the size in bytes up to which objects are archived in aggregates. Zero disables aggregation.
+	AggregateSize int64
+	// AggregateTarget is the size in bytes at which an aggregate is archived without waiting for its window.
+	AggregateTarget int64
+	// AggregateWindow is how long small objects wait for other objects of their relation.
+	AggregateWindow time.Duration
+	// AutoProvision creates the namespace of an object on its first upload, owned by the signer of the
+	// object, and records its pub for the checker to create it on the contract.
+	AutoProvision bool
+	// Keys resolves the encryption key references of namespaces. Files of a namespace with a key
+	// reference are encrypted before they are sent to the deal provider.
+	Keys KeyProvider
 }
 
 // UploaderConfig defines the configuration for a FileUploader.
 type UploaderConfig struct {
-	W3SToken string
-	CrdbConn string
+	ObjectStoreConfig
+	DealProviderConfig
+	CrdbConn      string
+	HashAlgorithm string
+	SignatureMode string
+	ShardSize     string
+	MaxAttempts   string
+	RetryBackoff  string
+	// EncryptionKeys is a comma separated list of ref=hexkey pairs, see ParseKeyRing.
+	EncryptionKeys  string
+	AggregateSize   string
+	AggregateTarget string
+	AggregateWindow string
+	AutoProvision   bool
 }
 
 // NewFileUploader creates a new FileUploader.
 func NewFileUploader(ctx context.Context, eventData []byte, cfg *UploaderConfig) (*FileUploader, error) {
-	// Initialize GCS client to download file
+	// Initialize object store client to download file
 	// bucket name and file name are passed in the CloudEvent
-	storageClient, err := NewGCSClient(ctx, eventData)
+	storageClient, err := NewObjectStore(ctx, cfg.ObjectStoreConfig, eventData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize storage client: %v", err)
 	}
 
-	// Initialize web3.storage client to upload file
-	w3sOpts := []w3s.Option{
-		w3s.WithToken(cfg.W3SToken),
-		w3s.WithHTTPClient(
-			&http.Client{
-				Timeout: 0, // no timeout
-			},
-		),
+	// Initialize deal provider to upload file
+	dealClient, err := NewDealProvider(cfg.DealProviderConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize deal provider: %v", err)
+	}
+
+	hashAlg, err := ParseHashAlgorithm(cfg.HashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash algorithm: %v", err)
 	}
-	w3sClient, err := w3s.NewClient(w3sOpts...)
+
+	signMode, err := ParseSignatureMode(cfg.SignatureMode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize web3.storage client: %v", err)
+		return nil, fmt.Errorf("failed to read signature mode: %v", err)
+	}
+
+	var shardSize int64
+	if cfg.ShardSize != "" {
+		shardSize, err = strconv.ParseInt(cfg.ShardSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shard size: %v", err)
+		}
+	}
+
+	maxAttempts := defaultMaxAttempts
+	if cfg.MaxAttempts != "" {
+		maxAttempts, err = strconv.Atoi(cfg.MaxAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read max attempts: %v", err)
+		}
+	}
+
+	retryBackoff := defaultRetryBackoff
+	if cfg.RetryBackoff != "" {
+		retryBackoff, err = time.ParseDuration(cfg.RetryBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read retry backoff: %v", err)
+		}
+	}
+
+	var aggregateSize int64
+	if cfg.AggregateSize != "" {
+		aggregateSize, err = strconv.ParseInt(cfg.AggregateSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read aggregate size: %v", err)
+		}
+	}
+
+	aggregateTarget := int64(defaultAggregateTarget)
+	if cfg.AggregateTarget != "" {
+		aggregateTarget, err = strconv.ParseInt(cfg.AggregateTarget, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read aggregate target: %v", err)
+		}
+	}
+
+	aggregateWindow := defaultAggregateWindow
+	if cfg.AggregateWindow != "" {
+		aggregateWindow, err = time.ParseDuration(cfg.AggregateWindow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read aggregate window: %v", err)
+		}
+	}
+
+	keys, err := ParseKeyRing(cfg.EncryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption keys: %v", err)
 	}
 
 	// Initialize cockroachdb client to store metadata
-	dbClient, err := NewDB(cfg.CrdbConn)
+	dbClient, err := NewCrdb(cfg.CrdbConn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize cockroachdb client: %v", err)
 	}
 
 	u := &FileUploader{
 		StorageClient: storageClient,
-		DealClient:    w3sClient,
+		DealClient:    dealClient,
 		DBClient:      dbClient,
+		HashAlgorithm: hashAlg,
+		SignatureMode: signMode,
+		ShardSize:     shardSize,
+		MaxAttempts:   maxAttempts,
+		RetryBackoff:  retryBackoff,
+		Keys:          keys,
+		AutoProvision: cfg.AutoProvision,
+
+		AggregateSize:   aggregateSize,
+		AggregateTarget: aggregateTarget,
+		AggregateWindow: aggregateWindow,
 	}
 
 	return u, nil
 }
 
-// Upload downloads a file from GCS and uploads it to web3.storage.
+// Upload downloads the file of the event from the object store and uploads it to the deal provider.
 func (u *FileUploader) Upload(ctx context.Context) error {
 	bucket, fname, err := u.StorageClient.ParseEvent()
 	if err != nil {
 		return fmt.Errorf("failed to parse event: %v", err)
 	}
 
-	reader, err := u.StorageClient.GetObjectReader(
-		ctx, bucket, fname)
+	return u.UploadObject(ctx, bucket, fname)
+}
+
+// UploadObject downloads a file from the object store and uploads it to the deal provider.
+// A failure is recorded in the failed uploads, so the object can be retried later,
+// and a success clears any previous failure of the object.
+func (u *FileUploader) UploadObject(ctx context.Context, bucket, fname string) error {
+	stage := StageFetch
+	if err := u.uploadObject(ctx, bucket, fname, &stage); err != nil {
+		return u.recordFailure(ctx, bucket, fname, stage, err)
+	}
+
+	if err := u.DBClient.ResolveFailedUpload(ctx, bucket, fname); err != nil {
+		return fmt.Errorf("failed to resolve failed upload: %v", err)
+	}
+
+	return nil
+}
+
+// uploadObject uploads a file, keeping stage up to date with its progress.
+// The rejection of the object generation is recorded.
+func (u *FileUploader) uploadObject(ctx context.Context, bucket, fname string, stage *UploadStage) error {
+	generation, err := u.StorageClient.GetObjectGeneration(ctx, bucket, fname)
+	if err != nil {
+		return fmt.Errorf("failed to get object generation: %v", err)
+	}
+
+	err = u.uploadGeneration(ctx, bucket, fname, generation, stage)
+	var rejected *RejectionError
+	if errors.As(err, &rejected) {
+		if rerr := u.DBClient.RejectUpload(
+			ctx, bucket, fname, generation, rejected.Hash, rejected.Reason.Error()); rerr != nil {
+			return fmt.Errorf("failed to record rejection (%v): %v", rejected.Reason, rerr)
+		}
+	}
+
+	return err
+}
+
+// uploadGeneration uploads a generation of a file, keeping stage up to date with its progress.
+func (u *FileUploader) uploadGeneration(
+	ctx context.Context,
+	bucket, fname string,
+	generation int64,
+	stage *UploadStage,
+) error {
+	// The same object generation can be delivered more than once,
+	// e.g. every metadata update triggers a new event.
+	exists, err := u.DBClient.JobExists(ctx, bucket, fname, generation)
 	if err != nil {
-		return fmt.Errorf("failed to get object reader: %v", err)
+		return fmt.Errorf("failed to check existing job: %v", err)
+	}
+	if exists {
+		fmt.Println("Job already exists, skipping", bucket, fname, generation)
+		return nil
 	}
 
 	metadata, err := u.StorageClient.GetObjectMetadata(ctx, bucket, fname)
@@ -80,63 +233,402 @@ func (u *FileUploader) Upload(ctx context.Context) error {
 		return fmt.Errorf("failed to get object metadata: %v", err)
 	}
 
-	defer func() {
-		if err := reader.Close(); err != nil {
-			log.Fatalf("error when closing cloud storage reader: %v", err)
+	// Malformed metadata does not get better with retries, the exporter has to fix it.
+	*stage = StageMetadata
+	exportName, err := ParseExportName(fname)
+	if err != nil {
+		return reject(metadata[MetadataHash], err)
+	}
+	meta, err := ParseUploadMetadata(metadata)
+	if err != nil {
+		return reject(metadata[MetadataHash], err)
+	}
+	if meta.Timestamp == nil {
+		ts := exportName.Timestamp.Unix()
+		meta.Timestamp = &ts
+		fmt.Println("timestamp is missing, using the export timestamp", fname, ts)
+	}
+	hash := meta.Hash
+
+	// Verify the object before anything is sent to the deal client,
+	// only the namespace owner can get data archived, and
+	// a tampered or truncated object must never make it to Filecoin.
+	*stage = StageVerify
+	if err := u.verifyOwner(ctx, fname, hash, meta.Signature); err != nil {
+		return err
+	}
+
+	size, err := u.StorageClient.GetObjectSize(ctx, bucket, fname)
+	if err != nil {
+		return fmt.Errorf("failed to get object size: %v", err)
+	}
+
+	// Only Parquet exports are archived. The footer is read with range requests,
+	// so the schema can be stored with the job without reading the whole object.
+	info, err := readParquetInfo(&objectReaderAt{
+		ctx:    ctx,
+		client: u.StorageClient,
+		bucket: bucket,
+		name:   fname,
+	}, size)
+	var invalid *InvalidParquetError
+	if errors.As(err, &invalid) {
+		return reject(hash, invalid)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read parquet footer: %v", err)
+	}
+	fmt.Println("Parquet verified", bucket, fname, info.NumRows, info.NumRowGroups)
+
+	job := JobInfo{
+		Bucket:        bucket,
+		FileName:      fname,
+		Generation:    generation,
+		Timestamp:     meta.Timestamp,
+		CacheDuration: meta.CacheDuration,
+		Signature:     meta.Signature,
+		Hash:          hash,
+		Parquet:       *info,
+	}
+
+	// Small objects are archived later, along with other small objects of the relation.
+	*stage = StageArchive
+	if u.AggregateSize > 0 && size <= u.AggregateSize {
+		return u.addPending(ctx, job, size)
+	}
+
+	// Objects above the shard size are uploaded in parts,
+	// under a manifest that lists the parts in order.
+	enc, err := u.namespaceEncryption(ctx, fname)
+	if err != nil {
+		return err
+	}
+	var archived *archive
+	if u.ShardSize > 0 && size > u.ShardSize {
+		archived, err = u.archiveSharded(ctx, bucket, fname, hash, size, enc)
+	} else {
+		archived, err = u.archiveObject(ctx, bucket, fname, hash, size, enc)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Upload successful :", archived.CAR.Root)
+
+	*stage = StageCreateJob
+	job.Cid = archived.CAR.Root.String()
+	job.CarSize = archived.CAR.Size
+	job.PieceCid = archived.CAR.PieceCid.String()
+	job.Shards = archived.Shards
+	job.KeyRef = enc.ref()
+	err = u.DBClient.CreateJob(ctx, job)
+	if err == ErrJobExists {
+		// a concurrent delivery of the same generation created the job first
+		fmt.Println("Job already exists, skipping", bucket, fname, generation)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("DB insert successful", fname)
+
+	return nil
+}
+
+// archive is the result of archiving an object with the deal provider.
+type archive struct {
+	CAR    *LocalCAR   // CAR is the local CAR of the object, or of its manifest when sharded.
+	Shards []ShardInfo // Shards are the ordered parts of a sharded object.
+}
+
+// archiveObject uploads the object as a single file. The object is streamed once to
+// compute its digest and build its CAR locally, and once more to upload it.
+func (u *FileUploader) archiveObject(
+	ctx context.Context,
+	bucket string,
+	fname string,
+	hash string,
+	size int64,
+	enc *encryption,
+) (*archive, error) {
+	hasher, err := u.HashAlgorithm.newHash()
+	if err != nil {
+		return nil, err
+	}
+
+	open := func() (io.ReadCloser, error) {
+		return u.StorageClient.GetObjectReader(ctx, bucket, fname)
+	}
+	verify := func() error {
+		if err := verifyHash(u.HashAlgorithm, hash, hasher.Sum(nil)); err != nil {
+			return reject(hash, err)
 		}
-	}()
+		fmt.Println("Hash verified", bucket, fname)
+		return nil
+	}
 
-	data, err := io.ReadAll(reader)
+	localCAR, err := u.putFile(ctx, fname, size, open, hasher, verify, enc)
 	if err != nil {
-		return fmt.Errorf("failed to read object: %v", err)
+		return nil, err
 	}
 
-	fmt.Println("Read successful", bucket, fname)
+	return &archive{CAR: localCAR}, nil
+}
 
-	file := NewIntermediateFile(data, fname)
-	cid, err := u.DealClient.Put(ctx, file)
+// archiveSharded verifies the digest of the whole object, uploads each shard
+// of the object as a separate file, and finally uploads the shard manifest.
+func (u *FileUploader) archiveSharded(
+	ctx context.Context,
+	bucket string,
+	fname string,
+	hash string,
+	size int64,
+	enc *encryption,
+) (*archive, error) {
+	reader, err := u.StorageClient.GetObjectReader(ctx, bucket, fname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object reader: %v", err)
+	}
+	digest, err := u.HashAlgorithm.Digest(reader)
+	if cerr := reader.Close(); cerr != nil {
+		log.Fatalf("error when closing cloud storage reader: %v", cerr)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %v", err)
+		return nil, fmt.Errorf("failed to read object: %v", err)
 	}
+	if err := verifyHash(u.HashAlgorithm, hash, digest); err != nil {
+		return nil, reject(hash, err)
+	}
+	fmt.Println("Hash verified", bucket, fname)
 
-	fmt.Println("Upload successful :", cid)
+	manifest := &ShardManifest{
+		Name:          fname,
+		Size:          size,
+		Hash:          hash,
+		HashAlgorithm: u.HashAlgorithm,
+	}
+	var shards []ShardInfo
+	for offset, idx := int64(0), 0; offset < size; offset, idx = offset+u.ShardSize, idx+1 {
+		offset, length := offset, u.ShardSize
+		if offset+length > size {
+			length = size - offset
+		}
 
-	var timestamp *int64
-	if _, ok := metadata["timestamp"]; !ok {
-		fmt.Println("timestamp is missing", fname)
-	} else {
-		t, err := strconv.ParseInt(metadata["timestamp"], 10, 64)
+		name := shardName(fname, idx)
+		open := func() (io.ReadCloser, error) {
+			return u.StorageClient.GetObjectRangeReader(ctx, bucket, fname, offset, length)
+		}
+		localCAR, err := u.putFile(ctx, name, length, open, nil, nil, enc)
 		if err != nil {
-			return fmt.Errorf("failed to parse timestamp: %v", err)
+			return nil, fmt.Errorf("failed to upload shard %d: %w", idx, err)
 		}
-		timestamp = &t
+		fmt.Println("Shard upload successful :", idx, localCAR.Root)
+
+		ref := ShardRef{
+			Index:  idx,
+			Name:   enc.name(name),
+			Cid:    localCAR.Root.String(),
+			Offset: offset,
+			Size:   length,
+		}
+		manifest.Shards = append(manifest.Shards, ref)
+		shards = append(shards, ShardInfo{
+			ShardRef: ref,
+			CarSize:  localCAR.Size,
+			PieceCid: localCAR.PieceCid.String(),
+		})
 	}
 
-	var cacheDutation int64
-	if _, ok := metadata["cache_duration"]; ok {
-		duration, err := strconv.ParseInt(metadata["cache_duration"], 10, 64)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode shard manifest: %v", err)
+	}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	localCAR, err := u.putFile(ctx, manifestName(fname), int64(len(data)), open, nil, nil, enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload shard manifest: %w", err)
+	}
+
+	return &archive{CAR: localCAR, Shards: shards}, nil
+}
+
+// putFile streams a file once to build its CAR locally, and once more to upload it
+// to the deal provider, checking that the provider derived the same root CID.
+// While the CAR is built, the content is also written to tee, if not nil.
+// The verify func, if not nil, is called before anything is uploaded.
+// With an encryption, the file is encrypted before it is archived, the tee still gets the plaintext.
+func (u *FileUploader) putFile(
+	ctx context.Context,
+	name string,
+	size int64,
+	open func() (io.ReadCloser, error),
+	tee io.Writer,
+	verify func() error,
+	enc *encryption,
+) (*LocalCAR, error) {
+	var salt []byte
+	if enc != nil {
+		// Both passes must produce the same ciphertext, they share the salt.
+		var err error
+		if salt, err = newSalt(); err != nil {
+			return nil, err
+		}
+		name, size = enc.name(name), EncryptedSize(size)
+	}
+	read := func(tee io.Writer) (io.ReadCloser, error) {
+		reader, err := open()
 		if err != nil {
-			return fmt.Errorf("failed to parse timestamp: %v", err)
+			return nil, fmt.Errorf("failed to get object reader: %v", err)
+		}
+		var r io.Reader = reader
+		if tee != nil {
+			r = io.TeeReader(r, tee)
+		}
+		if enc != nil {
+			if r, err = newEncryptReader(r, enc.Key, salt); err != nil {
+				_ = reader.Close()
+				return nil, fmt.Errorf("failed to encrypt: %v", err)
+			}
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, reader}, nil
+	}
+
+	reader, err := read(tee)
+	if err != nil {
+		return nil, err
+	}
+
+	localCAR, err := func() (*LocalCAR, error) {
+		file := NewIntermediateFile(reader, name, size)
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Fatalf("error when closing cloud storage reader: %v", err)
+			}
+		}()
+		return buildCAR(ctx, file)
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build car: %v", err)
+	}
+
+	if verify != nil {
+		if err := verify(); err != nil {
+			return nil, err
 		}
-		cacheDutation = duration
 	}
+	fmt.Println("Local CAR built", localCAR.Root, localCAR.Size, localCAR.PieceCid)
+
+	reader, err = read(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The object is streamed to the deal client, it is never read in full into memory.
+	file := NewIntermediateFile(reader, name, size)
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Fatalf("error when closing cloud storage reader: %v", err)
+		}
+	}()
 
-	sign, ok := metadata["signature"]
-	if !ok {
-		return fmt.Errorf("signature is missing")
+	cid, err := u.DealClient.Put(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %v", err)
 	}
 
-	hash, ok := metadata["hash"]
-	if !ok {
-		return fmt.Errorf("hash is missing")
+	// The deal provider must have archived exactly the bytes we built locally.
+	if !cid.Equals(localCAR.Root) {
+		mismatch := &CIDMismatchError{Local: localCAR.Root, Provider: cid}
+		log.Printf("ERROR: %v, file: %s", mismatch, name)
+		return nil, fmt.Errorf("failed to upload file: %w", mismatch)
 	}
 
-	err = u.DBClient.CreateJob(ctx, cid.String(), fname, timestamp, cacheDutation, sign, hash)
+	return localCAR, nil
+}
+
+// namespaceEncryption returns the encryption of the namespace of the file,
+// or nil if the namespace does not encrypt its files.
+func (u *FileUploader) namespaceEncryption(ctx context.Context, fname string) (*encryption, error) {
+	pub, err := extractPub(fname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract pub: %v", err)
+	}
+
+	ref, err := u.DBClient.NamespaceKeyRef(ctx, pub.Namespace)
 	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace key ref: %v", err)
+	}
+	if ref == "" {
+		return nil, nil
+	}
+
+	if u.Keys == nil {
+		return nil, fmt.Errorf("namespace %s is encrypted, but no encryption keys are configured", pub.Namespace)
+	}
+	key, err := u.Keys.Key(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %v", err)
+	}
+
+	return &encryption{Ref: ref, Key: key}, nil
+}
+
+// verifyOwner checks that the signature over the hash was made by the owner of the namespace.
+// With AutoProvision, the namespace is created if it does not exist, and the pub is provisioned.
+// A signature that is malformed or made by anyone else is recorded as a rejection.
+func (u *FileUploader) verifyOwner(ctx context.Context, fname, hash, sign string) error {
+	pub, err := extractPub(fname)
+	if err != nil {
+		return fmt.Errorf("failed to extract pub: %v", err)
+	}
+
+	owner, nsProvisioned, err := u.namespaceOwner(ctx, pub, hash, sign)
+	var rejected *RejectionError
+	if errors.As(err, &rejected) {
 		return err
 	}
+	if err != nil {
+		return fmt.Errorf("failed to get namespace owner: %v", err)
+	}
 
-	fmt.Println("DB insert successful", fname)
+	if err := verifySignature(u.SignatureMode, pub.Namespace, owner, hash, sign); err != nil {
+		return reject(hash, err)
+	}
+
+	if u.AutoProvision {
+		if err := u.provisionPub(ctx, pub, nsProvisioned); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Signature verified", fname)
 
 	return nil
 }
+
+// RejectionError is returned when an object is refused by the uploader.
+// A rejected object is never retried.
+type RejectionError struct {
+	Reason error
+	Hash   string // Hash is the hash in the metadata of the object, if any.
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("object rejected: %v", e.Reason)
+}
+
+func (e *RejectionError) Unwrap() error {
+	return e.Reason
+}
+
+// reject returns the rejection of an object with the hash of its metadata,
+// it is recorded by uploadObject.
+func reject(hash string, reason error) error {
+	return &RejectionError{Reason: reason, Hash: hash}
+}
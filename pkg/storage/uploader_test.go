@@ -3,68 +3,72 @@ package storage
 import (
 	"bytes"
 	"context"
-	"io/fs"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ipfs/go-cid"
 	"github.com/tablelandnetwork/basin-storage/mocks"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUploader(t *testing.T) {
 	ctx := context.Background()
-	mockGCS := new(mocks.GCS)
+	mockStore := new(mocks.ObjectStore)
 
 	// Mocking the returned values for the ParseEventData method
-	fname := "foo.bar.baz/relname/exportabcd1234-2.0.parquet"
-	mockGCS.On("ParseEvent").Return("mybucket", fname, nil)
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
 
-	// Mocking the returned reader for the GetObjectReader method
-	mockReadCloser := &MockReadCloser{Reader: bytes.NewReader(mockData())}
-	mockGCS.On("GetObjectReader", ctx, "mybucket", fname).Return(mockReadCloser, nil)
+	hash := mockParquetHash()
+
+	// Mocking the returned reader for the GetObjectReader method,
+	// the object is read once for verification and once for the upload
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+
+	// the parquet footer is read with range requests
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
 	metadata := map[string]string{
 		"timestamp":      "1700248832",
 		"cache_duration": "100",
-		"signature":      "25ee57b44817278828f3ad3f47dfe440cf2f729524b7ae445a933cf78e22d8583084048b47676f8c64daae85b937dda79ee2596b924710eebbff94652e5e2f9500", // nolint:lll
-		"hash":           "f00a989b4f86fd3bd6d347b03c59bba377bcaac57f3b43addfad9da1bca51938",
+		"signature":      signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":           hash,
 	}
-	mockGCS.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
 
 	uploader := FileUploader{
-		StorageClient: mockGCS,
-		DealClient: &mockW3sClient{
-			Files: []fs.File{},
-		},
-		DBClient: &mockCrdb{
-			jobs: []UnfinishedJob{},
-		},
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      newTestMemDB(t, "foo.bar.baz"),
 	}
 
 	err := uploader.Upload(ctx)
 
-	// Assert that mockGCS.GetObjectReader was called with the correct arguments
-	mockGCS.AssertExpectations(t)
+	// Assert that mockStore.GetObjectReader was called with the correct arguments
+	mockStore.AssertExpectations(t)
 	assert.NoError(t, err)
 
-	files := uploader.DealClient.(*mockW3sClient).Files
+	files := uploader.DealClient.(*W3SProvider).Client.(*mockW3sClient).Files
 	assert.Equal(t, 1, len(files))
 
-	fStat, err := files[0].Stat()
-	assert.NoError(t, err)
-	assert.Equal(t, fname, fStat.Name())
-	assert.Equal(t, int64(11), fStat.Size())
-
-	// Read the file contents that was send to (mocked) w3s
-	buf := make([]byte, 11)
-	_, err = files[0].Read(buf)
-	assert.NoError(t, err)
-
-	err = files[0].Close()
-	assert.NoError(t, err)
-
-	assert.Equal(t, mockData(), buf)
+	// The file contents that were sent to (mocked) w3s
+	assert.Equal(t, fname, files[0].Name)
+	assert.Equal(t, int64(len(mockParquet())), files[0].Size)
+	assert.Equal(t, mockParquet(), files[0].Data)
 
 	jobs, err := uploader.DBClient.UnfinishedJobs(ctx)
 	assert.NoError(t, err)
@@ -75,8 +79,308 @@ func TestUploader(t *testing.T) {
 
 	cid, err := cid.Parse(jobs[0].Cid)
 	assert.NoError(t, err)
-	assert.Equal(t, getCIDFromBytes(mockData()).String(), cid.String())
+	assert.Equal(t, getRootFromBytes(mockParquet(), fname).String(), cid.String())
+
+	// the local car is stored with the job
+	created := createdJobs(uploader.DBClient.(*MemDB))
+	assert.Equal(t, 1, len(created))
+	assert.Greater(t, created[0].CarSize, int64(len(mockParquet())))
+	assert.True(t, strings.HasPrefix(created[0].PieceCid, "baga"))
+
+	// the parquet footer is stored with the job
+	assert.Equal(t, int64(5), created[0].Parquet.NumRows)
+	assert.Equal(t, 3, created[0].Parquet.NumRowGroups)
+	assert.Contains(t, created[0].Parquet.Schema, "required binary name (STRING);")
 
 	assert.Equal(t, int64(1700248832), *jobs[0].Timestamp)
-	assert.Equal(t, time.Unix(1700248832+100, 0), jobs[0].ExpiresAt)
+
+	// the object is cached for the duration of its metadata, in minutes
+	stored := testJobs(uploader.DBClient.(*MemDB))[0]
+	assert.Equal(t, fname, stored.CachePath)
+	assert.WithinDuration(t, time.Now().Add(100*time.Minute), stored.ExpiresAt, time.Minute)
+}
+
+func TestUploaderHashMismatch(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// the content does not match the hash of "hello world"
+	hash := "47173285a8d7341e5e972fc677286384f802f8ef42a5ec5f03bbfa254cb01fad"
+	mockReadCloser := &MockReadCloser{Reader: bytes.NewReader(mockParquet())}
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).Return(mockReadCloser, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+		HashAlgorithm: HashKeccak256,
+	}
+
+	err := uploader.Upload(ctx)
+	mockStore.AssertExpectations(t)
+
+	var mismatch *HashMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, HashKeccak256, mismatch.Algorithm)
+
+	// a rejected object is never retried
+	assert.True(t, testFailedUpload(t, db, fname).Permanent)
+
+	// nothing is sent to the deal client and no job is created
+	assert.Equal(t, 0, len(uploader.DealClient.(*W3SProvider).Client.(*mockW3sClient).Files))
+	assert.Empty(t, testJobs(db))
+	assert.Equal(t, []string{fname}, rejectedPaths(db))
+}
+
+func TestUploaderSignatureMismatch(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// signed by someone other than the namespace owner
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(otherKey, hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{}),
+		DBClient:      db,
+	}
+
+	err = uploader.Upload(ctx)
+	mockStore.AssertExpectations(t)
+
+	var mismatch *SignatureMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, "foo.bar.baz", mismatch.Namespace)
+	assert.Equal(t, []common.Address{crypto.PubkeyToAddress(otherKey.PublicKey)}, mismatch.Signers)
+	assert.Equal(t, StageVerify, testFailedUpload(t, db, fname).Stage)
+	assert.True(t, testFailedUpload(t, db, fname).Permanent)
+
+	// the object is never read, nothing is sent to the deal client and no job is created
+	assert.Equal(t, 0, len(uploader.DealClient.(*W3SProvider).Client.(*mockW3sClient).Files))
+	assert.Empty(t, testJobs(db))
+	assert.Equal(t, []string{fname}, rejectedPaths(db))
+}
+
+func TestUploaderCIDMismatch(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+
+	// the provider returns a cid of different bytes
+	db := newTestMemDB(t, "foo.bar.baz")
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, &mockW3sClient{PutCid: getCIDFromBytes(mockData())}),
+		DBClient:      db,
+	}
+
+	err := uploader.Upload(ctx)
+	mockStore.AssertExpectations(t)
+
+	var mismatch *CIDMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, getRootFromBytes(mockParquet(), fname), mismatch.Local)
+	assert.Equal(t, getCIDFromBytes(mockData()), mismatch.Provider)
+	assert.Empty(t, testJobs(db))
+}
+
+func TestUploaderDuplicateDelivery(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// the object is only read for the first delivery
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet()))
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil).Once()
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil).Once()
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	dealClient := &mockW3sClient{}
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, dealClient),
+		DBClient:      db,
+	}
+
+	require.NoError(t, uploader.Upload(ctx))
+	require.NoError(t, uploader.Upload(ctx))
+	mockStore.AssertExpectations(t)
+
+	assert.Equal(t, 1, len(dealClient.Files))
+	created := createdJobs(db)
+	require.Equal(t, 1, len(created))
+	assert.Equal(t, "mybucket", created[0].Bucket)
+	assert.Equal(t, fname, created[0].FileName)
+	assert.Equal(t, int64(1700248832000000), created[0].Generation)
+
+	// a job created concurrently is not an error
+	assert.ErrorIs(t, db.CreateJob(ctx, created[0]), ErrJobExists)
+}
+
+func TestUploaderSharded(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// the whole object is read once to verify its hash, the footer is read
+	// with three range requests, and each shard is read once to build its car
+	// and once for the upload
+	mockStore.On("GetObjectReader", ctx, "mybucket", fname).
+		Return(&MockReadCloser{Reader: bytes.NewReader(mockParquet())}, nil).Once()
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(mockParquet())).Times(9)
+	hash := mockParquetHash()
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(mockParquet())), nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	dealClient := &mockW3sClient{}
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, dealClient),
+		DBClient:      db,
+		ShardSize:     600,
+	}
+
+	require.NoError(t, uploader.Upload(ctx))
+	mockStore.AssertExpectations(t)
+
+	// three shards of at most 600 bytes, then the manifest
+	require.Equal(t, 4, len(dealClient.Files))
+	assert.Equal(t, mockParquet()[:600], dealClient.Files[0].Data)
+	assert.Equal(t, mockParquet()[600:1200], dealClient.Files[1].Data)
+	assert.Equal(t, mockParquet()[1200:], dealClient.Files[2].Data)
+	assert.Equal(t, fname+".shard0002", dealClient.Files[2].Name)
+	assert.Equal(t, fname+".manifest.json", dealClient.Files[3].Name)
+
+	// the job references the manifest, and its shards in order
+	created := createdJobs(db)
+	require.Equal(t, 1, len(created))
+	job := created[0]
+	assert.Equal(t, getRootFromBytes(dealClient.Files[3].Data, fname+".manifest.json").String(), job.Cid)
+	require.Equal(t, 3, len(job.Shards))
+	for i, shard := range job.Shards {
+		assert.Equal(t, i, shard.Index)
+		assert.Equal(t, int64(i*600), shard.Offset)
+		assert.Equal(t, getRootFromBytes(dealClient.Files[i].Data, dealClient.Files[i].Name).String(), shard.Cid)
+		assert.True(t, strings.HasPrefix(shard.PieceCid, "baga"))
+	}
+	require.Equal(t, 3, len(testJobs(db)[0].Shards))
+
+	// the object can be reassembled from the manifest
+	manifest, err := ReadShardManifest(bytes.NewReader(dealClient.Files[3].Data))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	err = manifest.Reassemble(&buf, func(ref ShardRef) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(dealClient.Files[ref.Index].Data)), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mockParquet(), buf.Bytes())
+}
+
+func TestUploaderInvalidParquet(t *testing.T) {
+	ctx := context.Background()
+	mockStore := new(mocks.ObjectStore)
+
+	fname := "foo.bar.baz/relname/2023-11-17/202311171920320000000000000000000-3ab461ed932d5f1c-1-2-00000000-relname-1.parquet" // nolint:lll
+	mockStore.On("ParseEvent").Return("mybucket", fname, nil)
+	mockStore.On("GetObjectGeneration", ctx, "mybucket", fname).Return(int64(1700248832000000), nil)
+
+	// the hash and signature are valid, but the content is not parquet
+	data := bytes.Repeat(mockData(), 10)
+	hash := hex.EncodeToString(crypto.Keccak256(data))
+	mockStore.EXPECT().GetObjectRangeReader(ctx, "mybucket", fname, mock.Anything, mock.Anything).
+		RunAndReturn(mockRangeReader(data)).Once()
+	mockStore.On("GetObjectSize", ctx, "mybucket", fname).Return(int64(len(data)), nil)
+	metadata := map[string]string{
+		"timestamp": "1700248832",
+		"signature": signHash(testOwnerKey(), hash, SignatureRaw),
+		"hash":      hash,
+	}
+	mockStore.On("GetObjectMetadata", ctx, "mybucket", fname).Return(metadata, nil)
+
+	db := newTestMemDB(t, "foo.bar.baz")
+	dealClient := &mockW3sClient{}
+	uploader := FileUploader{
+		StorageClient: mockStore,
+		DealClient:    newTestW3SProvider(t, dealClient),
+		DBClient:      db,
+	}
+
+	err := uploader.Upload(ctx)
+	mockStore.AssertExpectations(t)
+
+	var invalid *InvalidParquetError
+	assert.True(t, errors.As(err, &invalid))
+
+	// nothing is sent to the deal client and no job is created
+	assert.Equal(t, 0, len(dealClient.Files))
+	assert.Empty(t, testJobs(db))
+	assert.Equal(t, []string{fname}, rejectedPaths(db))
 }
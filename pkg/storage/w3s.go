@@ -1,24 +1,38 @@
 package storage
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"net/http"
 	"time"
+
+	"github.com/alanshaw/go-carbites"
+	"github.com/ipfs/go-cid"
+	w3s "github.com/web3-storage/go-w3s-client"
 )
 
-// IntermediateFile implements fs.File and is used to wrap the data read from GCS.
+// IntermediateFile implements fs.File and is used to stream the data read from the object store.
 // This is needed because the Put method of the w3s.Client interface expects a fs.File.
 // The Put method is used to upload the data to web3.storage.
+// The data is never buffered in full, it is read from the underlying reader as the
+// file is consumed, and the size is taken from the object attributes.
 type IntermediateFile struct {
-	data *bytes.Reader
-	name string
+	reader io.ReadCloser
+	name   string
+	size   int64
+	closed bool
 }
 
 // NewIntermediateFile creates a new IntermediateFile instance.
-func NewIntermediateFile(data []byte, name string) *IntermediateFile {
+func NewIntermediateFile(reader io.ReadCloser, name string, size int64) *IntermediateFile {
 	return &IntermediateFile{
-		data: bytes.NewReader(data),
-		name: name,
+		reader: reader,
+		name:   name,
+		size:   size,
 	}
 }
 
@@ -26,17 +40,22 @@ func NewIntermediateFile(data []byte, name string) *IntermediateFile {
 
 // Stat returns a fs.FileInfo describing the file.
 func (f *IntermediateFile) Stat() (fs.FileInfo, error) {
-	return &fileInfo{name: f.name, size: f.data.Size()}, nil
+	return &fileInfo{name: f.name, size: f.size}, nil
 }
 
 // Read reads up to len(p) bytes into p.
 func (f *IntermediateFile) Read(p []byte) (n int, err error) {
-	return f.data.Read(p)
+	return f.reader.Read(p)
 }
 
-// Close noop for an in memory virtual file.
+// Close closes the underlying reader. It is safe to call Close more than once,
+// the file may be closed by the deal client as well as by its owner.
 func (f *IntermediateFile) Close() error {
-	return nil
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.reader.Close()
 }
 
 type fileInfo struct {
@@ -52,3 +71,166 @@ func (fi *fileInfo) Mode() fs.FileMode  { return 0o444 } // Read-only
 func (fi *fileInfo) ModTime() time.Time { return time.Now() }
 func (fi *fileInfo) IsDir() bool        { return false }
 func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// w3sEndpoint is the endpoint of the web3.storage API.
+const w3sEndpoint = "https://api.web3.storage"
+
+// w3sCarSize is the size of the parts a CAR is split into to be uploaded, as the web3.storage client does.
+const w3sCarSize = 10 << 20
+
+// W3SProvider is a DealProvider backed by web3.storage.
+type W3SProvider struct {
+	// Client reads the status of the content. Files are not put with it, it holds their DAG
+	// and CAR in memory.
+	Client w3s.Client
+
+	// Endpoint and Token are used to upload the CARs of files.
+	Endpoint   string
+	Token      string
+	HTTPClient *http.Client
+	// carSize is the size of the parts of a CAR, it defaults to w3sCarSize.
+	carSize int
+}
+
+// NewW3SProvider creates a new W3SProvider.
+func NewW3SProvider(token string) (*W3SProvider, error) {
+	hc := &http.Client{
+		Timeout: 0, // no timeout
+	}
+	w3sOpts := []w3s.Option{
+		w3s.WithToken(token),
+		w3s.WithHTTPClient(hc),
+	}
+	w3sClient, err := w3s.NewClient(w3sOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize web3.storage client: %v", err)
+	}
+
+	return &W3SProvider{
+		Client:     w3sClient,
+		Endpoint:   w3sEndpoint,
+		Token:      token,
+		HTTPClient: hc,
+	}, nil
+}
+
+// Put uploads the file to web3.storage. The DAG of the file is built in a temporary datastore
+// on disk, and its CAR is uploaded in parts that are read from it.
+func (p *W3SProvider) Put(ctx context.Context, file fs.File) (cid.Cid, error) {
+	if p.Token == "" {
+		return cid.Undef, errors.New("missing web3.storage token")
+	}
+
+	d, err := addDAG(ctx, file)
+	if err != nil {
+		return cid.Undef, err
+	}
+	defer d.Close()
+
+	carSize := p.carSize
+	if carSize == 0 {
+		carSize = w3sCarSize
+	}
+	// every part of the CAR has the root of the DAG, the root the provider derived for a part
+	// is returned if it differs, for the uploader to report the mismatch
+	root := d.Root
+	spltr, err := carbites.NewTreewalkSplitterFromBlockReader(d.Root, d.Blocks, carSize)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to split car: %v", err)
+	}
+	for {
+		r, err := spltr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return cid.Undef, fmt.Errorf("failed to split car: %v", err)
+		}
+
+		partRoot, err := p.putCar(ctx, r)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if !partRoot.Equals(d.Root) {
+			root = partRoot
+		}
+	}
+
+	return root, nil
+}
+
+// putCar uploads a part of a CAR, and returns the root CID of the DAG.
+func (p *W3SProvider) putCar(ctx context.Context, r io.Reader) (cid.Cid, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint+"/car", r)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/car")
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+
+	hc := p.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to upload car: %v", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return cid.Undef, fmt.Errorf("unexpected response status: %d", res.StatusCode)
+	}
+
+	var out struct {
+		Cid string `json:"cid"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return cid.Undef, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return cid.Parse(out.Cid)
+}
+
+// Status returns the pin and deal status from web3.storage.
+func (p *W3SProvider) Status(ctx context.Context, c cid.Cid) (*ContentStatus, error) {
+	status, err := p.Client.Status(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	deals := make([]Deal, len(status.Deals))
+	for i, d := range status.Deals {
+		var sp string
+		if !d.StorageProvider.Empty() {
+			sp = d.StorageProvider.String()
+		}
+		deals[i] = Deal{
+			DealID:            d.DealID,
+			StorageProvider:   sp,
+			Status:            DealStatus(d.Status),
+			PieceCid:          d.PieceCid,
+			DataCid:           d.DataCid,
+			DataModelSelector: d.DataModelSelector,
+			Activation:        d.Activation,
+			Created:           d.Created,
+			Updated:           d.Updated,
+		}
+	}
+
+	return &ContentStatus{
+		Cid:     status.Cid,
+		DagSize: status.DagSize,
+		Created: status.Created,
+		Deals:   deals,
+	}, nil
+}
+
+// Deals returns the deals from web3.storage.
+func (p *W3SProvider) Deals(ctx context.Context, c cid.Cid) ([]Deal, error) {
+	status, err := p.Status(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return status.Deals, nil
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	basinstorage "github.com/tablelandnetwork/basin-storage/pkg/storage"
+)
+
+func TestCacheConfig(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+	crdbConn := fmt.Sprintf(
+		"postgresql://root@%s/basin_test?sslmode=disable",
+		os.Getenv("CRDB_HOST"))
+
+	db, err := sql.Open("postgres", crdbConn)
+	require.NoError(t, err)
+	defer func() {
+		_, err := db.Exec("DROP DATABASE IF EXISTS basin_test")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	}()
+	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS basin_test")
+	require.NoError(t, err)
+
+	// a database created before the migrations may hold several rows of a relation
+	migrations, err := basinstorage.Migrations()
+	require.NoError(t, err)
+	_, err = (&basinstorage.Migrator{DB: db, Migrations: migrations[:1]}).Up(ctx)
+	require.NoError(t, err)
+	owner := crypto.PubkeyToAddress(testOwnerKey(t).PublicKey)
+	_, err = db.Exec("INSERT INTO namespaces (name, owner) VALUES ('esfbmltndstj', $1)", owner.Bytes())
+	require.NoError(t, err)
+	for _, duration := range []int64{10, 20} {
+		_, err = db.Exec(
+			`INSERT INTO cache_config (ns_id, relation, duration)
+			SELECT id, 'ksvraapqfiyf', $1 FROM namespaces WHERE name = 'esfbmltndstj'`, duration)
+		require.NoError(t, err)
+	}
+
+	// the migrations keep the last row of the relation
+	_, err = (&basinstorage.Migrator{DB: db, Migrations: migrations}).Up(ctx)
+	require.NoError(t, err)
+	client := &basinstorage.DBClient{DB: db}
+	configs, err := client.CacheConfigs(ctx, "esfbmltndstj")
+	require.NoError(t, err)
+	assert.Equal(t, []basinstorage.CacheConfig{
+		{Namespace: "esfbmltndstj", Relation: "ksvraapqfiyf", Duration: 20},
+	}, configs)
+
+	// setting the config of a relation twice leaves a single row
+	for _, duration := range []int64{30, 40} {
+		require.NoError(t, client.SetCacheConfig(ctx, basinstorage.CacheConfig{
+			Namespace: "esfbmltndstj",
+			Relation:  "ksvraapqfiyf",
+			Duration:  duration,
+		}))
+	}
+	var rows int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM cache_config").Scan(&rows))
+	assert.Equal(t, 1, rows)
+	configs, err = client.CacheConfigs(ctx, "esfbmltndstj")
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, int64(40), configs[0].Duration)
+}
@@ -83,7 +83,7 @@ func TestChecker(t *testing.T) {
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 
 	query := `
-		SELECT namespaces.name, jobs.cid, jobs.relation, jobs.activated
+		SELECT namespaces.name, jobs.cid, jobs.relation, jobs.activated, jobs.status
 		FROM namespaces, jobs
 		WHERE namespaces.id = jobs.ns_id
 		AND jobs.cid = $1
@@ -99,6 +99,7 @@ func TestChecker(t *testing.T) {
 		relName   string
 		cid       []byte
 		activated sql.NullString
+		status    string
 	}
 
 	var results []result
@@ -107,7 +108,8 @@ func TestChecker(t *testing.T) {
 		var nsName string
 		var relation string
 		var activated sql.NullString
-		if err := rows.Scan(&nsName, &cid, &relation, &activated); err != nil {
+		var status string
+		if err := rows.Scan(&nsName, &cid, &relation, &activated, &status); err != nil {
 			require.NoError(t, err)
 		}
 		results = append(results, result{
@@ -115,6 +117,7 @@ func TestChecker(t *testing.T) {
 			relName:   relation,
 			cid:       cid,
 			activated: activated,
+			status:    status,
 		})
 	}
 	defer func() {
@@ -128,4 +131,5 @@ func TestChecker(t *testing.T) {
 	value, err := results[0].activated.Value()
 	require.NoError(t, err)
 	assert.Equal(t, "2023-09-26T08:09:30Z", value)
+	assert.Equal(t, "indexed", results[0].status)
 }
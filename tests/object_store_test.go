@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tablelandnetwork/basin-storage/pkg/storage"
+)
+
+// TestS3Store runs the S3 object store against a local MinIO, see compose.yml.
+func TestS3Store(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "localhost:9000"
+	}
+	cfg := storage.ObjectStoreConfig{
+		Store:       storage.ObjectStoreS3,
+		S3Endpoint:  endpoint,
+		S3AccessKey: "minioadmin",
+		S3SecretKey: "minioadmin",
+		S3Insecure:  true,
+	}
+
+	bucketName := "tableland-entrypoint"
+	objectName := "esfbmltndstj/ksvraapqfiyf/export17860a3b03221a1b0000000000000001-n901064813195493377.0.parquet"
+	event := fmt.Sprintf(
+		`{"Records": [{"s3": {"bucket": {"name": "%s"}, "object": {"key": "%s"}}}]}`, bucketName, objectName)
+	store, err := storage.NewObjectStore(ctx, cfg, []byte(event))
+	require.NoError(t, err)
+	client := store.(*storage.S3Client).Client
+
+	// upload an object with metadata
+	exists, err := client.BucketExists(ctx, bucketName)
+	require.NoError(t, err)
+	if !exists {
+		require.NoError(t, client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{}))
+	}
+	data := []byte("hello world")
+	_, err = client.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{UserMetadata: map[string]string{"hash": "abcd", "cache_duration": "100"}})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{}))
+	}()
+
+	bucket, name, err := store.ParseEvent()
+	require.NoError(t, err)
+	assert.Equal(t, bucketName, bucket)
+	assert.Equal(t, objectName, name)
+
+	reader, err := store.GetObjectReader(ctx, bucket, name)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, data, content)
+
+	reader, err = store.GetObjectRangeReader(ctx, bucket, name, 6, 5)
+	require.NoError(t, err)
+	content, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, []byte("world"), content)
+
+	metadata, err := store.GetObjectMetadata(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", metadata["hash"])
+	assert.Equal(t, "100", metadata["cache_duration"])
+
+	size, err := store.GetObjectSize(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	generation, err := store.GetObjectGeneration(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.Greater(t, generation, int64(0))
+
+	// the object is listed with its generation
+	var listed []string
+	err = store.ListObjects(ctx, bucket, "esfbmltndstj/", "", 10, func(name string, gen int64) error {
+		listed = append(listed, name)
+		assert.Equal(t, generation, gen)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{objectName}, listed)
+	listed = nil
+	err = store.ListObjects(ctx, bucket, "esfbmltndstj/", objectName, 10, func(name string, _ int64) error {
+		listed = append(listed, name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+
+	// an object replaced within the same second gets a new generation
+	data = []byte("hello there")
+	_, err = client.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{UserMetadata: map[string]string{"hash": "abcd", "cache_duration": "100"}})
+	require.NoError(t, err)
+	replaced, err := store.GetObjectGeneration(ctx, bucket, name)
+	require.NoError(t, err)
+	assert.NotEqual(t, generation, replaced)
+
+	// only the current generation is deleted
+	err = store.DeleteObject(ctx, bucket, name, generation)
+	assert.ErrorIs(t, err, storage.ErrGenerationMismatch)
+	generation = replaced
+	require.NoError(t, store.DeleteObject(ctx, bucket, name, generation))
+	err = store.DeleteObject(ctx, bucket, name, generation)
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+}
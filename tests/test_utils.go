@@ -2,7 +2,9 @@ package tests
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strconv"
@@ -13,17 +15,26 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/require"
 	"github.com/tablelandnetwork/basin-storage/pkg/ethereum"
+	basinstorage "github.com/tablelandnetwork/basin-storage/pkg/storage"
 	"github.com/textileio/go-tableland/pkg/wallet"
 	"golang.org/x/crypto/sha3"
 )
 
 const functionsPort = "8293"
 
-func uploadRandomBytesToGCS(t *testing.T, data []byte, bucketName, objectName string) {
+// testOwnerKey returns the key of the owner of the test namespace.
+func testOwnerKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := crypto.HexToECDSA("ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	require.NoError(t, err)
+	return key
+}
+
+func uploadBytesToGCS(t *testing.T, data []byte, bucketName, objectName string) {
 	ctx := context.Background()
 
 	// Create a client
@@ -37,16 +48,22 @@ func uploadRandomBytesToGCS(t *testing.T, data []byte, bucketName, objectName st
 	bucket := client.Bucket(bucketName)
 	object := bucket.Object(objectName)
 
-	// Create a writer and write the random bytes
+	// Create a writer and write the bytes
 	wc := object.NewWriter(ctx)
 	_, err = wc.Write(data)
 	require.NoError(t, err)
 	require.NoError(t, wc.Close())
 
-	// Set the metadata
+	// Set the metadata, the hash must match the uploaded bytes
+	// and be signed by the namespace owner
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write(data)
+	hash := hasher.Sum(nil)
+	sig, err := crypto.Sign(hash, testOwnerKey(t))
+	require.NoError(t, err)
 	metadata := map[string]string{
-		"signature": "25ee57b44817278828f3ad3f47dfe440cf2f729524b7ae445a933cf78e22d8583084048b47676f8c64daae85b937dda79ee2596b924710eebbff94652e5e2f9500", // nolint
-		"hash":      "f00a989b4f86fd3bd6d347b03c59bba377bcaac57f3b43addfad9da1bca51938",                                                                   // nolint
+		"signature": hex.EncodeToString(sig),
+		"hash":      hex.EncodeToString(hash),
 	}
 	attrs := storage.ObjectAttrsToUpdate{
 		Metadata: metadata,
@@ -78,48 +95,13 @@ func setupDB(t *testing.T, db *sql.DB) {
 	_, err := db.Exec("CREATE DATABASE IF NOT EXISTS basin_test")
 	require.NoError(t, err)
 
-	_, err = db.Exec(
-		`CREATE TABLE IF NOT EXISTS namespaces
-	(
-		id     BIGSERIAL   PRIMARY KEY,
-		name   VARCHAR(32) UNIQUE NOT NULL,
-		owner  BYTEA NOT NULL,
-		last_export TIMESTAMPTZ
-	)`)
-	require.NoError(t, err)
-
-	_, err = db.Exec("INSERT INTO namespaces (name, owner) VALUES ('esfbmltndstj', 'test_owner')")
+	m, err := basinstorage.NewMigrator(db)
 	require.NoError(t, err)
-
-	_, err = db.Exec(
-		`CREATE TABLE IF NOT EXISTS jobs
-		(
-			id BIGSERIAL PRIMARY KEY,
-			ns_id BIGINT,
-			cid BYTEA NOT NULL,
-			relation TEXT NOT NULL,
-			activated TIMESTAMP,
-			timestamp BIGINT,
-			cache_path TEXT,
-			expires_at TIMESTAMP,
-			signature bytea,
-			hash bytea,
-			CONSTRAINT fk_namespace
-			FOREIGN KEY(ns_id)
-			REFERENCES namespaces(id)
-		)`)
+	_, err = m.Up(context.Background())
 	require.NoError(t, err)
 
-	_, err = db.Exec(
-		`CREATE TABLE IF NOT EXISTS cache_config
-		(
-			ns_id BIGINT NOT NULL,
-			relation TEXT NOT NULL,
-			duration BIGINT,
-			CONSTRAINT fk_namespace
-			FOREIGN KEY(ns_id)
-			REFERENCES namespaces(id)
-		);`)
+	owner := crypto.PubkeyToAddress(testOwnerKey(t).PublicKey)
+	_, err = db.Exec("INSERT INTO namespaces (name, owner) VALUES ('esfbmltndstj', $1)", owner.Bytes())
 	require.NoError(t, err)
 }
 
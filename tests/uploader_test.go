@@ -3,7 +3,6 @@ package tests
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"io"
@@ -87,15 +86,12 @@ func TestUploader(t *testing.T) {
 		require.NoError(t, funcframework.Start(functionsPort))
 	}()
 
-	// Upload random bytes to GCS for testing
+	// Upload a parquet export to GCS for testing
 	bucketName := "tableland-entrypoint"
-	objectName := "esfbmltndstj/ksvraapqfiyf/export17860a3b03221a1b0000000000000001-n901064813195493377.0.parquet"
-	// 1MB
-	size := 1 * 1024 * 1024
-	data := make([]byte, size)
-	_, err = rand.Read(data)
+	objectName := "esfbmltndstj/ksvraapqfiyf/2023-08-29/202308291525552525242120000000000-3ab461ed932d5f1c-1-2-00000000-ksvraapqfiyf-1.parquet" // nolint:lll
+	data, err := os.ReadFile("../pkg/storage/testdata/export.parquet")
 	require.NoError(t, err)
-	uploadRandomBytesToGCS(t, data, bucketName, objectName)
+	uploadBytesToGCS(t, data, bucketName, objectName)
 	defer deleteObjectFromGCS(t, bucketName, objectName)
 
 	// Wait for for test file to be uploaded to GCS